@@ -103,6 +103,7 @@ func addTask() *db.Task {
 		TemplateID: int(templateID),
 		Status: "testing",
 		UserID: &userPathTestUser.ID,
+		Initiator: db.TaskUserInitiator,
 		Created: db.GetParsedTime(time.Now()),
 	}
 	if err := db.Mysql.Insert(&t); err != nil {
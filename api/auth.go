@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/fiftin/semaphore/db"
 	"github.com/fiftin/semaphore/util"
 	"github.com/gorilla/context"
@@ -18,35 +19,32 @@ func authentication(next http.Handler) http.Handler {
 		var userID int
 
 		if authHeader := strings.ToLower(r.Header.Get("authorization")); len(authHeader) > 0 && strings.Contains(authHeader, "bearer") {
-			var token db.APIToken
-			if err := db.Mysql.SelectOne(&token, "select * from user__token where id=? and expired=0", strings.Replace(authHeader, "bearer ", "", 1)); err != nil {
-				if err == sql.ErrNoRows {
-					w.WriteHeader(http.StatusUnauthorized)
-					return
-				}
-
-				panic(err)
+			tokenUserID, ok := findTokenUserID(strings.Replace(authHeader, "bearer ", "", 1))
+			if !ok {
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidAPIToken, nil)
+				return
 			}
 
-			userID = token.UserID
+			userID = tokenUserID
+			context.Set(r, "api_token_id", strings.Replace(authHeader, "bearer ", "", 1))
 		} else {
 			// fetch session from cookie
-			cookie, err := r.Cookie("semaphore")
+			cookie, err := r.Cookie(util.Config.CookieName)
 			if err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgNotLoggedIn, nil)
 				return
 			}
 
 			value := make(map[string]interface{})
-			if err = util.Cookie.Decode("semaphore", cookie.Value, &value); err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
+			if err = util.Cookie.Decode(util.Config.CookieName, cookie.Value, &value); err != nil {
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidSession, nil)
 				return
 			}
 
 			user, ok := value["user"]
 			sessionVal, okSession := value["session"]
 			if !ok || !okSession {
-				w.WriteHeader(http.StatusUnauthorized)
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidSession, nil)
 				return
 			}
 
@@ -56,18 +54,18 @@ func authentication(next http.Handler) http.Handler {
 			// fetch session
 			var session db.Session
 			if err := db.Mysql.SelectOne(&session, "select * from session where id=? and user_id=? and expired=0", sessionID, userID); err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidSession, nil)
 				return
 			}
 
-			if time.Since(session.LastActive).Hours() > 7*24 {
+			if time.Since(session.LastActive) > sessionLifetime {
 				// more than week old unused session
 				// destroy.
 				if _, err := db.Mysql.Exec("update session set expired=1 where id=?", sessionID); err != nil {
 					panic(err)
 				}
 
-				w.WriteHeader(http.StatusUnauthorized)
+				util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgSessionExpired, nil)
 				return
 			}
 
@@ -79,7 +77,7 @@ func authentication(next http.Handler) http.Handler {
 		user, err := db.FetchUser(userID)
 		if err != nil {
 			fmt.Println("Can't find user", err)
-			w.WriteHeader(http.StatusUnauthorized)
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgUserNotFound, nil)
 			return
 		}
 
@@ -88,3 +86,62 @@ func authentication(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// findTokenUserID returns the id of the user owning an active API token
+func findTokenUserID(tokenID string) (int, bool) {
+	var token db.APIToken
+	if err := db.Mysql.SelectOne(&token, "select * from user__token where id=? and expired=0", tokenID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false
+		}
+
+		panic(err)
+	}
+
+	return token.UserID, true
+}
+
+// wsAuthentication authenticates websocket upgrades. Browsers can't set the Authorization header
+// when connecting a websocket, so the API token may be passed in the token query parameter instead.
+// Requests without the parameter are authenticated as usual
+func wsAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenID, ok := r.URL.Query()["token"]
+		if !ok {
+			authentication(next).ServeHTTP(w, r)
+			return
+		}
+
+		userID, ok := findTokenUserID(strings.ToLower(tokenID[0]))
+		if !ok {
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidAPIToken, nil)
+			return
+		}
+		context.Set(r, "api_token_id", strings.ToLower(tokenID[0]))
+
+		user, err := db.FetchUser(userID)
+		if err != nil {
+			log.Warn("Can't find the user of the API token: " + err.Error())
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgUserNotFound, nil)
+			return
+		}
+
+		context.Set(r, "user", user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mustBeAdmin ensures that the user is a system administrator, it guards the endpoints only admins can use
+func mustBeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.Get(r, "user").(*db.User)
+		if !user.Admin {
+			log.Warn(user.Username + " is not permitted to " + r.Method + " " + r.URL.Path)
+			util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgAdminRequired, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,7 +1,12 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/csv"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -14,10 +19,11 @@ import (
 func getEvents(w http.ResponseWriter, r *http.Request, limit uint64) {
 	user := context.Get(r, "user").(*db.User)
 
-	q := squirrel.Select("event.*, p.name as project_name").
+	// the columns depend on the format
+	q := squirrel.Select().
 		From("event").
 		LeftJoin("project as p on event.project_id=p.id").
-		OrderBy("created desc")
+		OrderBy("event.created desc")
 
 	if limit > 0 {
 		q = q.Limit(limit)
@@ -33,9 +39,25 @@ func getEvents(w http.ResponseWriter, r *http.Request, limit uint64) {
 			Where("p.id IS NULL or pu.user_id=?", user.ID)
 	}
 
+	from, to, ok := parseEventsRange(w, r)
+	if !ok {
+		return
+	}
+	if from != nil {
+		q = q.Where("event.created>=?", *from)
+	}
+	if to != nil {
+		q = q.Where("event.created<?", *to)
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeEventsCSV(w, r, q)
+		return
+	}
+
 	var events []db.Event
 
-	query, args, err := q.ToSql()
+	query, args, err := q.Columns("event.*, p.name as project_name").ToSql()
 	util.LogWarning(err)
 	if _, err := db.Mysql.Select(&events, query, args...); err != nil {
 		panic(err)
@@ -70,6 +92,13 @@ func getEvents(w http.ResponseWriter, r *http.Request, limit uint64) {
 		}
 	}
 
+	if r.URL.Query().Get("humanize") == "1" {
+		now := time.Now().UTC()
+		for i := range events {
+			events[i].CreatedHuman = util.RelativeTime(events[i].Created, now)
+		}
+	}
+
 	util.WriteJSON(w, http.StatusOK, events)
 }
 
@@ -80,3 +109,121 @@ func getLastEvents(w http.ResponseWriter, r *http.Request) {
 func getAllEvents(w http.ResponseWriter, r *http.Request) {
 	getEvents(w, r, 0)
 }
+
+// eventsDateFormat is the format of dates in the from and to parameters, besides RFC 3339 timestamps
+const eventsDateFormat = "2006-01-02"
+
+// parseEventsRange reads the from and to parameters of the events endpoints, nil when they are not given.
+// A date as to covers the whole day. It writes a bad request response if they are invalid
+func parseEventsRange(w http.ResponseWriter, r *http.Request) (from *time.Time, to *time.Time, ok bool) {
+	query := r.URL.Query()
+
+	for _, param := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		val := query.Get(param.name)
+		if len(val) == 0 {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			if t, err = time.Parse(eventsDateFormat, val); err == nil && param.name == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		if err != nil {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidDate, nil, param.name)
+			return nil, nil, false
+		}
+
+		t = t.UTC()
+		*param.value = &t
+	}
+
+	if from != nil && to != nil && !to.After(*from) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgToNotAfterFrom, nil)
+		return nil, nil, false
+	}
+
+	return from, to, true
+}
+
+// csvEscape keeps spreadsheets from evaluating a field as a formula
+func csvEscape(field string) string {
+	if len(field) > 0 && strings.ContainsRune("=+-@", rune(field[0])) {
+		return "'" + field
+	}
+
+	return field
+}
+
+// writeEventsCSV streams the events of the query as a csv attachment, with the playbook of task events as object name
+func writeEventsCSV(w http.ResponseWriter, r *http.Request, q squirrel.SelectBuilder) {
+	q = q.Columns("event.created", "event.project_id", "p.name", "event.object_type", "event.object_id",
+		"case when length(t.playbook) > 0 then t.playbook else tpl.playbook end", "event.description").
+		LeftJoin("task as t on event.object_type='task' and t.id=event.object_id").
+		LeftJoin("project__template as tpl on t.template_id=tpl.id")
+
+	query, args, err := q.ToSql()
+	util.LogWarning(err)
+
+	rows, err := db.Mysql.Db.Query(query, args...)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close() //nolint: errcheck
+
+	filename := "events.csv"
+	if project, ok := context.GetOk(r, "project"); ok {
+		filename = "project-" + strconv.Itoa(project.(db.Project).ID) + "-events.csv"
+	}
+
+	w.Header().Set("content-type", "text/csv; charset=utf-8")
+	w.Header().Set("content-disposition", "attachment; filename=\""+filename+"\"")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"created", "project_id", "project_name", "object_type", "object_id", "object_name", "description"}); err != nil {
+		return
+	}
+
+	for i := 0; rows.Next(); i++ {
+		var (
+			created                                          time.Time
+			projectID, objectID                              sql.NullInt64
+			projectName, objectType, objectName, description sql.NullString
+		)
+
+		if err := rows.Scan(&created, &projectID, &projectName, &objectType, &objectID, &objectName, &description); err != nil {
+			util.LogWarning(err)
+			return
+		}
+
+		record := []string{created.UTC().Format(time.RFC3339), "", csvEscape(projectName.String), objectType.String, "",
+			csvEscape(objectName.String), csvEscape(description.String)}
+		if projectID.Valid {
+			record[1] = strconv.FormatInt(projectID.Int64, 10)
+		}
+		if objectID.Valid {
+			record[4] = strconv.FormatInt(objectID.Int64, 10)
+		}
+
+		if err := writer.Write(record); err != nil {
+			// the client went away
+			return
+		}
+
+		if i%1000 == 999 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	writer.Flush()
+	util.LogWarning(rows.Err())
+}
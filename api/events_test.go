@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseEventsRange(t *testing.T) {
+	r := httptest.NewRequest("GET", "/events?from=2020-03-01&to=2020-03-31", nil)
+	from, to, ok := parseEventsRange(httptest.NewRecorder(), r)
+	if !ok || !from.Equal(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("a date as to must cover the whole day, got %v %v", from, to)
+	}
+
+	r = httptest.NewRequest("GET", "/events?to=2020-03-31T12:00:00%2B02:00", nil)
+	if from, to, ok = parseEventsRange(httptest.NewRecorder(), r); !ok || from != nil || !to.Equal(time.Date(2020, 3, 31, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected range %v %v", from, to)
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2020-03-02&to=2020-03-01"} {
+		if _, _, ok := parseEventsRange(httptest.NewRecorder(), httptest.NewRequest("GET", "/events?"+query, nil)); ok {
+			t.Errorf("%q must be rejected", query)
+		}
+	}
+}
+
+func TestCSVEscape(t *testing.T) {
+	if csvEscape("=HYPERLINK(\"x\")") != "'=HYPERLINK(\"x\")" || csvEscape("Task ID 1 created") != "Task ID 1 created" {
+		t.Fatal("only fields starting like a formula must be escaped")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
 	"net/mail"
 	"strings"
@@ -148,7 +149,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 				panic(err)
 			}
 		} else {
-			w.WriteHeader(http.StatusUnauthorized)
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidCredentials, nil)
 			return
 		}
 	} else if err != nil {
@@ -157,14 +158,14 @@ func login(w http.ResponseWriter, r *http.Request) {
 
 	// check if ldap user & no ldap user found
 	if user.External && ldapUser == nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidCredentials, nil)
 		return
 	}
 
 	// non-ldap login
 	if !user.External {
 		if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(login.Password)); err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidCredentials, nil)
 			return
 		}
 
@@ -175,7 +176,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 		UserID:     user.ID,
 		Created:    time.Now(),
 		LastActive: time.Now(),
-		IP:         r.Header.Get("X-Real-IP"),
+		IP:         getRemoteIP(r),
 		UserAgent:  r.Header.Get("user-agent"),
 		Expired:    false,
 	}
@@ -183,7 +184,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	encoded, err := util.Cookie.Encode("semaphore", map[string]interface{}{
+	encoded, err := util.Cookie.Encode(util.Config.CookieName, map[string]interface{}{
 		"user":    user.ID,
 		"session": session.ID,
 	})
@@ -191,22 +192,27 @@ func login(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:  "semaphore",
-		Value: encoded,
-		Path:  "/",
-	})
+	http.SetCookie(w, util.NewSessionCookie(encoded, time.Time{}))
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:    "semaphore",
-		Value:   "",
-		Expires: time.Now().Add(24 * 7 * time.Hour * -1),
-		Path:    "/",
-	})
+	http.SetCookie(w, util.NewSessionCookie("", time.Now().Add(24*7*time.Hour*-1)))
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// getRemoteIP returns the address of the client, as reported by a proxy in X-Real-IP when present
+func getRemoteIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); len(ip) > 0 {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -31,7 +32,7 @@ func EnvironmentMiddleware(next http.Handler) http.Handler {
 		var env db.Environment
 		if err := db.Mysql.SelectOne(&env, query, args...); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgEnvironmentNotFound, nil)
 				return
 			}
 
@@ -75,6 +76,23 @@ func GetEnvironment(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
+	for i := range env {
+		if err := env[i].RedactSecrets(); err != nil {
+			panic(err)
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, env)
+}
+
+// GetEnvironmentItem returns a single environment of the project, its secrets are redacted
+func GetEnvironmentItem(w http.ResponseWriter, r *http.Request) {
+	env := context.Get(r, "environment").(db.Environment)
+
+	if err := env.RedactSecrets(); err != nil {
+		panic(err)
+	}
+
 	util.WriteJSON(w, http.StatusOK, env)
 }
 
@@ -88,13 +106,26 @@ func UpdateEnvironment(w http.ResponseWriter, r *http.Request) {
 
 	var js map[string]interface{}
 	if json.Unmarshal([]byte(env.JSON), &js) != nil {
-		util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "JSON is not valid",
-		})
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidJSON, nil)
+		return
+	}
+
+	if _, ok := js[db.TaskVarsName]; ok {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgReservedVar, nil, db.TaskVarsName)
+		return
+	}
+
+	if nameTaken("project__environment", "name", true, oldEnv.ProjectID, env.Name, oldEnv.ID) {
+		writeNameTaken(w, r, "environment", env.Name)
 		return
 	}
 
-	if _, err := db.Mysql.Exec("update project__environment set name=?, json=? where id=?", env.Name, env.JSON, oldEnv.ID); err != nil {
+	if err := env.EncryptSecrets(&oldEnv); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if _, err := db.Mysql.Exec("update project__environment set name=?, json=?, secrets=? where id=?", env.Name, env.JSON, env.EncryptedSecrets, oldEnv.ID); err != nil {
 		panic(err)
 	}
 
@@ -112,13 +143,26 @@ func AddEnvironment(w http.ResponseWriter, r *http.Request) {
 
 	var js map[string]interface{}
 	if json.Unmarshal([]byte(env.JSON), &js) != nil {
-		util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "JSON is not valid",
-		})
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidJSON, nil)
 		return
 	}
 
-	res, err := db.Mysql.Exec("insert into project__environment set project_id=?, name=?, json=?, password=?", project.ID, env.Name, env.JSON, env.Password)
+	if _, ok := js[db.TaskVarsName]; ok {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgReservedVar, nil, db.TaskVarsName)
+		return
+	}
+
+	if nameTaken("project__environment", "name", true, project.ID, env.Name, 0) {
+		writeNameTaken(w, r, "environment", env.Name)
+		return
+	}
+
+	if err := env.EncryptSecrets(nil); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	res, err := db.Mysql.Exec("insert into project__environment set project_id=?, name=?, json=?, password=?, secrets=?", project.ID, env.Name, env.JSON, env.Password, env.EncryptedSecrets)
 	if err != nil {
 		panic(err)
 	}
@@ -138,7 +182,13 @@ func AddEnvironment(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	env.ID = insertIDInt
+	env.ProjectID = project.ID
+	if err := env.RedactSecrets(); err != nil {
+		panic(err)
+	}
+
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/environment/"+strconv.Itoa(env.ID), env)
 }
 
 // RemoveEnvironment deletes an environment from the database
@@ -152,8 +202,7 @@ func RemoveEnvironment(w http.ResponseWriter, r *http.Request) {
 
 	if templatesC > 0 {
 		if len(r.URL.Query().Get("setRemoved")) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"error": "Environment is in use by one or more templates",
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgEnvironmentInUse, map[string]interface{}{
 				"inUse": true,
 			})
 
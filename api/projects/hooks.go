@@ -0,0 +1,129 @@
+package projects
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// minHookSecretLength is the shortest secret accepted for hooks, payloads can't be verified without one
+const minHookSecretLength = 16
+
+// hookResponse is a hook with the url git providers post to
+type hookResponse struct {
+	db.Hook
+	URL string `json:"url"`
+}
+
+// GetTemplateHook returns the hook of a template, without its secret
+func GetTemplateHook(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	var hook db.Hook
+	if err := db.Mysql.SelectOne(&hook, "select * from project__template_hook where template_id=?", template.ID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTemplateHasNoHook, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	hook.Secret = ""
+	util.WriteJSON(w, http.StatusOK, hookResponse{Hook: hook, URL: hookURL(hook.Token)})
+}
+
+// UpdateTemplateHook creates the hook of a template or replaces its secret and branches, the token of an existing hook is kept
+func UpdateTemplateHook(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	var hook db.Hook
+	if err := util.Bind(w, r, &hook); err != nil {
+		return
+	}
+
+	if hook.Branches != nil && len(*hook.Branches) == 0 {
+		hook.Branches = nil
+	}
+
+	if len(hook.Secret) < minHookSecretLength {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgHookSecretTooShort, nil, minHookSecretLength)
+		return
+	}
+
+	if err := db.ValidateHookBranches(hook.Branches); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	token, err := db.Mysql.SelectStr("select token from project__template_hook where template_id=?", template.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(token) == 0 {
+		tokenBytes := make([]byte, 20)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			panic(err)
+		}
+		token = hex.EncodeToString(tokenBytes)
+	}
+
+	if _, err := db.Mysql.Exec("insert into project__template_hook set template_id=?, token=?, secret=?, branches=? on duplicate key update secret=values(secret), branches=values(branches)", template.ID, token, hook.Secret, hook.Branches); err != nil {
+		panic(err)
+	}
+
+	objType := "template"
+	desc := "Template ID " + strconv.Itoa(template.ID) + " hook updated"
+	if err := (db.Event{
+		ProjectID:   &template.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &template.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	hook.TemplateID = template.ID
+	hook.Token = token
+	hook.Secret = ""
+	util.WriteJSON(w, http.StatusOK, hookResponse{Hook: hook, URL: hookURL(token)})
+}
+
+// RemoveTemplateHook deletes the hook of a template, pushes no longer run it
+func RemoveTemplateHook(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	if _, err := db.Mysql.Exec("delete from project__template_hook where template_id=?", template.ID); err != nil {
+		panic(err)
+	}
+
+	objType := "template"
+	desc := "Template ID " + strconv.Itoa(template.ID) + " hook removed"
+	if err := (db.Event{
+		ProjectID:   &template.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &template.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hookURL returns the url of a hook, relative to the web root when web_host isn't set
+func hookURL(token string) string {
+	url := util.WebPath() + "api/hooks/" + token
+	if util.WebHostURL != nil {
+		url = util.WebHostURL.Scheme + "://" + util.WebHostURL.Host + url
+	}
+
+	return url
+}
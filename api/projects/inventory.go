@@ -6,6 +6,7 @@ import (
 
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/fiftin/semaphore/db"
@@ -38,7 +39,7 @@ func InventoryMiddleware(next http.Handler) http.Handler {
 		var inventory db.Inventory
 		if err := db.Mysql.SelectOne(&inventory, query, args...); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgInventoryNotFound, nil)
 				return
 			}
 
@@ -84,30 +85,67 @@ func GetInventory(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, inv)
 }
 
+// GetInventoryItem returns a single inventory of the project
+func GetInventoryItem(w http.ResponseWriter, r *http.Request) {
+	util.WriteJSON(w, http.StatusOK, context.Get(r, "inventory").(db.Inventory))
+}
+
 // AddInventory creates an inventory in the database
 func AddInventory(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 	var inventory struct {
-		Name      string `json:"name" binding:"required"`
-		KeyID     *int   `json:"key_id"`
-		SSHKeyID  int    `json:"ssh_key_id"`
-		Type      string `json:"type"`
-		Inventory string `json:"inventory"`
+		Name       string  `json:"name" binding:"required"`
+		KeyID      *int    `json:"key_id"`
+		SSHKeyID   int     `json:"ssh_key_id"`
+		Type       string  `json:"type"`
+		Inventory  string  `json:"inventory"`
+		Vars       *string `json:"vars"`
+		Limits     *string `json:"limits"`
+		Production bool    `json:"production"`
 	}
 
 	if err := util.Bind(w, r, &inventory); err != nil {
 		return
 	}
 
+	if !isValidVars(inventory.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgVarsNotObject, nil)
+		return
+	}
+
+	if hasReservedVar(inventory.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgReservedVar, nil, db.TaskVarsName)
+		return
+	}
+
+	if inventory.Limits != nil && strings.TrimSpace(*inventory.Limits) == "" {
+		inventory.Limits = nil
+	}
+
+	if err := db.ValidateInventoryLimits(inventory.Limits); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
 	switch inventory.Type {
 	case "static", "file":
 		break
+	case "url":
+		if err := db.ValidateInventoryURL(inventory.Inventory); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
 	default:
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidInventoryType, nil)
 		return
 	}
 
-	res, err := db.Mysql.Exec("insert into project__inventory set project_id=?, name=?, type=?, key_id=?, ssh_key_id=?, inventory=?", project.ID, inventory.Name, inventory.Type, inventory.KeyID, inventory.SSHKeyID, inventory.Inventory)
+	if nameTaken("project__inventory", "name", true, project.ID, inventory.Name, 0) {
+		writeNameTaken(w, r, "inventory", inventory.Name)
+		return
+	}
+
+	res, err := db.Mysql.Exec("insert into project__inventory set project_id=?, name=?, type=?, key_id=?, ssh_key_id=?, inventory=?, vars=?, limits=?, production=?", project.ID, inventory.Name, inventory.Type, inventory.KeyID, inventory.SSHKeyID, inventory.Inventory, inventory.Vars, inventory.Limits, inventory.Production)
 	if err != nil {
 		panic(err)
 	}
@@ -128,16 +166,19 @@ func AddInventory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	inv := db.Inventory{
-		ID:        insertIDInt,
-		Name:      inventory.Name,
-		ProjectID: project.ID,
-		Inventory: inventory.Inventory,
-		KeyID:     inventory.KeyID,
-		SSHKeyID:  &inventory.SSHKeyID,
-		Type:      inventory.Type,
+		ID:         insertIDInt,
+		Name:       inventory.Name,
+		ProjectID:  project.ID,
+		Inventory:  inventory.Inventory,
+		KeyID:      inventory.KeyID,
+		SSHKeyID:   &inventory.SSHKeyID,
+		Type:       inventory.Type,
+		Vars:       inventory.Vars,
+		Limits:     inventory.Limits,
+		Production: inventory.Production,
 	}
 
-	util.WriteJSON(w, http.StatusCreated, inv)
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/inventory/"+strconv.Itoa(inv.ID), inv)
 }
 
 // IsValidInventoryPath tests a path to ensure it is below the cwd
@@ -166,17 +207,39 @@ func UpdateInventory(w http.ResponseWriter, r *http.Request) {
 	oldInventory := context.Get(r, "inventory").(db.Inventory)
 
 	var inventory struct {
-		Name      string `json:"name" binding:"required"`
-		KeyID     *int   `json:"key_id"`
-		SSHKeyID  int    `json:"ssh_key_id"`
-		Type      string `json:"type"`
-		Inventory string `json:"inventory"`
+		Name       string  `json:"name" binding:"required"`
+		KeyID      *int    `json:"key_id"`
+		SSHKeyID   int     `json:"ssh_key_id"`
+		Type       string  `json:"type"`
+		Inventory  string  `json:"inventory"`
+		Vars       *string `json:"vars"`
+		Limits     *string `json:"limits"`
+		Production bool    `json:"production"`
 	}
 
 	if err := util.Bind(w, r, &inventory); err != nil {
 		return
 	}
 
+	if !isValidVars(inventory.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgVarsNotObject, nil)
+		return
+	}
+
+	if hasReservedVar(inventory.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgReservedVar, nil, db.TaskVarsName)
+		return
+	}
+
+	if inventory.Limits != nil && strings.TrimSpace(*inventory.Limits) == "" {
+		inventory.Limits = nil
+	}
+
+	if err := db.ValidateInventoryLimits(inventory.Limits); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
 	switch inventory.Type {
 	case "static":
 		break
@@ -184,12 +247,22 @@ func UpdateInventory(w http.ResponseWriter, r *http.Request) {
 		if !IsValidInventoryPath(inventory.Inventory) {
 			panic("Invalid inventory path")
 		}
+	case "url":
+		if err := db.ValidateInventoryURL(inventory.Inventory); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
 	default:
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidInventoryType, nil)
 		return
 	}
 
-	if _, err := db.Mysql.Exec("update project__inventory set name=?, type=?, key_id=?, ssh_key_id=?, inventory=? where id=?", inventory.Name, inventory.Type, inventory.KeyID, inventory.SSHKeyID, inventory.Inventory, oldInventory.ID); err != nil {
+	if nameTaken("project__inventory", "name", true, oldInventory.ProjectID, inventory.Name, oldInventory.ID) {
+		writeNameTaken(w, r, "inventory", inventory.Name)
+		return
+	}
+
+	if _, err := db.Mysql.Exec("update project__inventory set name=?, type=?, key_id=?, ssh_key_id=?, inventory=?, vars=?, limits=?, production=? where id=?", inventory.Name, inventory.Type, inventory.KeyID, inventory.SSHKeyID, inventory.Inventory, inventory.Vars, inventory.Limits, inventory.Production, oldInventory.ID); err != nil {
 		panic(err)
 	}
 
@@ -211,18 +284,14 @@ func UpdateInventory(w http.ResponseWriter, r *http.Request) {
 func RemoveInventory(w http.ResponseWriter, r *http.Request) {
 	inventory := context.Get(r, "inventory").(db.Inventory)
 
-	templatesC, err := db.Mysql.SelectInt("select count(1) from project__template where project_id=? and inventory_id=?", inventory.ProjectID, inventory.ID)
-	if err != nil {
-		panic(err)
-	}
-
-	if templatesC > 0 {
-		if len(r.URL.Query().Get("setRemoved")) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"error": "Inventory is in use by one or more templates",
-				"inUse": true,
-			})
+	if refs := getInventoryReferences(inventory); len(refs) > 0 {
+		if !isForcedRemoval(r) {
+			writeInUse(w, r, util.MsgInventoryInUse, refs)
+			return
+		}
 
+		if !isAdmin(context.Get(r, "project").(db.Project), context.Get(r, "user").(*db.User)) {
+			util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgAdminRemoveInventoryInUse, nil)
 			return
 		}
 
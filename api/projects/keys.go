@@ -2,7 +2,14 @@ package projects
 
 import (
 	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -23,7 +30,7 @@ func KeyMiddleware(next http.Handler) http.Handler {
 		var key db.AccessKey
 		if err := db.Mysql.SelectOne(&key, "select * from access_key where project_id=? and id=?", project.ID, keyID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgKeyNotFound, nil)
 				return
 			}
 
@@ -38,6 +45,7 @@ func KeyMiddleware(next http.Handler) http.Handler {
 // GetKeys retrieves sorted keys from the database
 func GetKeys(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
 	var keys []db.AccessKey
 
 	sort := r.URL.Query().Get("sort")
@@ -52,15 +60,25 @@ func GetKeys(w http.ResponseWriter, r *http.Request) {
 		"ak.type",
 		"ak.project_id",
 		"ak.key",
-		"ak.removed").
+		"ak.removed",
+		"ak.description",
+		"ak.created",
+		"ak.last_used",
+		"ak.restricted",
+		"ak.created_by").
 		From("access_key ak")
 
+	if !isAdmin(project, user) {
+		q = q.Where("(ak.restricted=0 or ak.created_by=?)", user.ID)
+	}
+
+	// type can list several types separated by commas
 	if t := r.URL.Query().Get("type"); len(t) > 0 {
-		q = q.Where("type=?", t)
+		q = q.Where(squirrel.Eq{"type": strings.Split(t, ",")})
 	}
 
 	switch sort {
-	case "name", "type":
+	case "name", "type", "created", "last_used":
 		q = q.Where("ak.project_id=?", project.ID).
 			OrderBy("ak." + sort + " " + order)
 	default:
@@ -78,12 +96,106 @@ func GetKeys(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, keys)
 }
 
+// GetKey returns a single key of the project without its secret,
+// restricted keys are only visible to admins and to their creator
+func GetKey(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+	key := context.Get(r, "accessKey").(db.AccessKey)
+
+	if key.Restricted && !isAdmin(project, user) && (key.CreatedBy == nil || *key.CreatedBy != user.ID) {
+		util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgKeyNotFound, nil)
+		return
+	}
+
+	key.Secret = nil
+	util.WriteJSON(w, http.StatusOK, key)
+}
+
+// maxKeyFileSize is the largest key file accepted by a multipart upload
+const maxKeyFileSize = 64 << 10
+
+// bindKey reads a key from the request with readKey, either way the key must have a name
+func bindKey(w http.ResponseWriter, r *http.Request, key *db.AccessKey) error {
+	if err := readKey(w, r, key); err != nil {
+		return err
+	}
+
+	if len(strings.TrimSpace(key.Name)) == 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgKeyNameEmpty, nil)
+		return errors.New("the key has no name")
+	}
+
+	return nil
+}
+
+// readKey reads a key from a JSON body, or from a multipart form whose secret field is the key file.
+// Uploading the file keeps private keys byte for byte, pasting them into JSON easily mangles the newlines
+func readKey(w http.ResponseWriter, r *http.Request, key *db.AccessKey) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return util.Bind(w, r, key)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxKeyFileSize+(16<<10))
+	if err := r.ParseMultipartForm(maxKeyFileSize); err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidForm, nil, err.Error())
+		return err
+	}
+
+	key.Name = r.FormValue("name")
+	key.Type = r.FormValue("type")
+	if description := r.FormValue("description"); len(description) > 0 {
+		key.Description = &description
+	}
+	// an omitted field keeps the value key already has
+	if _, ok := r.MultipartForm.Value["restricted"]; ok {
+		key.Restricted = r.FormValue("restricted") == "true" || r.FormValue("restricted") == "1"
+	}
+	if public := r.FormValue("key"); len(public) > 0 {
+		key.Key = &public
+	}
+
+	file, _, err := r.FormFile("secret")
+	if err == http.ErrMissingFile {
+		return nil
+	} else if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidKeyFile, nil, err.Error())
+		return err
+	}
+	defer file.Close() //nolint: errcheck
+
+	content, err := ioutil.ReadAll(io.LimitReader(file, maxKeyFileSize+1))
+	if err == nil && len(content) > maxKeyFileSize {
+		err = errors.New("the key file is larger than " + strconv.Itoa(maxKeyFileSize) + " bytes")
+	}
+	if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidKeyFile, nil, err.Error())
+		return err
+	}
+
+	secret := string(content)
+	key.Secret = &secret
+
+	return nil
+}
+
+// withTrailingNewline terminates a private key with a newline, which ssh requires
+func withTrailingNewline(secret string) string {
+	if strings.HasSuffix(secret, "\n") {
+		return secret
+	}
+
+	return secret + "\n"
+}
+
 // AddKey adds a new key to the database
 func AddKey(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
 	var key db.AccessKey
 
-	if err := util.Bind(w, r, &key); err != nil {
+	if err := bindKey(w, r, &key); err != nil {
 		return
 	}
 
@@ -92,21 +204,35 @@ func AddKey(w http.ResponseWriter, r *http.Request) {
 		break
 	case "ssh":
 		if key.Secret == nil || len(*key.Secret) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-				"error": "SSH Secret empty",
-			})
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgSSHSecretEmpty, nil)
+			return
+		}
+	case "login_password":
+		if key.Key == nil || len(*key.Key) == 0 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgLoginEmpty, nil)
 			return
 		}
 	default:
-		util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "Invalid key type",
-		})
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidKeyType, nil)
 		return
 	}
 
-	secret := *key.Secret + "\n"
+	if key.Type == "login_password" && (key.Secret == nil || len(*key.Secret) == 0) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgPasswordEmpty, nil)
+		return
+	}
 
-	res, err := db.Mysql.Exec("insert into access_key set name=?, type=?, project_id=?, `key`=?, secret=?", key.Name, key.Type, project.ID, key.Key, secret)
+	secret := withTrailingNewline(*key.Secret)
+	if key.Type == "login_password" {
+		var err error
+		if secret, err = util.EncryptSecret(*key.Secret); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+	created := db.GetParsedTime(time.Now().UTC())
+
+	res, err := db.Mysql.Exec("insert into access_key set name=?, description=?, type=?, project_id=?, `key`=?, secret=?, created=?, restricted=?, created_by=?", key.Name, key.Description, key.Type, project.ID, key.Key, secret, created, key.Restricted, user.ID)
 	if err != nil {
 		panic(err)
 	}
@@ -126,16 +252,24 @@ func AddKey(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	key.ID = insertIDInt
+	key.ProjectID = &project.ID
+	key.Secret = nil
+	key.Created = &created
+	key.LastUsed = nil
+	key.CreatedBy = &user.ID
+
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/keys/"+strconv.Itoa(key.ID), key)
 }
 
 // UpdateKey updates key in database
 // nolint: gocyclo
 func UpdateKey(w http.ResponseWriter, r *http.Request) {
-	var key db.AccessKey
 	oldKey := context.Get(r, "accessKey").(db.AccessKey)
 
-	if err := util.Bind(w, r, &key); err != nil {
+	// restricted is kept when the body omits it
+	key := db.AccessKey{Restricted: oldKey.Restricted}
+	if err := bindKey(w, r, &key); err != nil {
 		return
 	}
 
@@ -144,27 +278,40 @@ func UpdateKey(w http.ResponseWriter, r *http.Request) {
 		break
 	case "ssh":
 		if key.Secret == nil || len(*key.Secret) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-				"error": "SSH Secret empty",
-			})
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgSSHSecretEmpty, nil)
+			return
+		}
+	case "login_password":
+		if key.Key == nil || len(*key.Key) == 0 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgLoginEmpty, nil)
 			return
 		}
 	default:
-		util.WriteJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "Invalid key type",
-		})
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidKeyType, nil)
 		return
 	}
 
 	if key.Secret == nil || len(*key.Secret) == 0 {
+		if key.Type != oldKey.Type && key.Type == "login_password" {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgPasswordEmpty, nil)
+			return
+		}
+
 		// override secret
 		key.Secret = oldKey.Secret
+	} else if key.Type == "login_password" {
+		secret, err := util.EncryptSecret(*key.Secret)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		key.Secret = &secret
 	} else {
-		secret := *key.Secret + "\n"
+		secret := withTrailingNewline(*key.Secret)
 		key.Secret = &secret
 	}
 
-	if _, err := db.Mysql.Exec("update access_key set name=?, type=?, `key`=?, secret=? where id=?", key.Name, key.Type, key.Key, key.Secret, oldKey.ID); err != nil {
+	if _, err := db.Mysql.Exec("update access_key set name=?, description=?, type=?, `key`=?, secret=?, restricted=? where id=?", key.Name, key.Description, key.Type, key.Key, key.Secret, key.Restricted, oldKey.ID); err != nil {
 		panic(err)
 	}
 
@@ -186,23 +333,9 @@ func UpdateKey(w http.ResponseWriter, r *http.Request) {
 func RemoveKey(w http.ResponseWriter, r *http.Request) {
 	key := context.Get(r, "accessKey").(db.AccessKey)
 
-	templatesC, err := db.Mysql.SelectInt("select count(1) from project__template where project_id=? and ssh_key_id=?", *key.ProjectID, key.ID)
-	if err != nil {
-		panic(err)
-	}
-
-	inventoryC, err := db.Mysql.SelectInt("select count(1) from project__inventory where project_id=? and ssh_key_id=?", *key.ProjectID, key.ID)
-	if err != nil {
-		panic(err)
-	}
-
-	if templatesC > 0 || inventoryC > 0 {
-		if len(r.URL.Query().Get("setRemoved")) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"error": "Key is in use by one or more templates / inventory",
-				"inUse": true,
-			})
-
+	if refs := getKeyReferences(key); len(refs) > 0 {
+		if !isForcedRemoval(r) {
+			writeInUse(w, r, util.MsgKeyInUse, refs)
 			return
 		}
 
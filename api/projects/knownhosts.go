@@ -0,0 +1,133 @@
+package projects
+
+import (
+	stdcontext "context"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// keyscanTimeout limits how long scanning the keys of a host may take
+const keyscanTimeout = 30 * time.Second
+
+// keyscanHostRegexp matches the hosts ssh-keyscan may be run for, names or ip addresses which can't be taken for an option
+var keyscanHostRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:\[\]][A-Za-z0-9_.:\[\]-]*$`)
+
+// mergeKnownHosts appends the scanned host keys which the known hosts don't have yet, and returns the result
+// with the lines which were added
+func mergeKnownHosts(knownHosts string, scanned string) (string, []string) {
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(knownHosts, "\n") {
+		existing[strings.Join(strings.Fields(line), " ")] = true
+	}
+
+	added := []string{}
+	for _, line := range strings.Split(scanned, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		line = strings.Join(fields, " ")
+		if existing[line] {
+			continue
+		}
+
+		existing[line] = true
+		added = append(added, line)
+	}
+
+	if len(added) == 0 {
+		return knownHosts, added
+	}
+
+	if len(knownHosts) > 0 && !strings.HasSuffix(knownHosts, "\n") {
+		knownHosts += "\n"
+	}
+
+	return knownHosts + strings.Join(added, "\n") + "\n", added
+}
+
+// AddKnownHost adds the current host keys of a host to the known hosts of the project, read with ssh-keyscan
+func AddKnownHost(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var body struct {
+		Host string `json:"host" binding:"required"`
+		Port int    `json:"port"`
+	}
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	if !keyscanHostRegexp.MatchString(body.Host) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidHost, nil)
+		return
+	}
+
+	if body.Port == 0 {
+		body.Port = 22
+	} else if body.Port < 1 || body.Port > 65535 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidPort, nil)
+		return
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), keyscanTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ssh-keyscan", "-T", "10", "-p", strconv.Itoa(body.Port), body.Host).Output() //nolint: gas
+	if err != nil && len(out) == 0 {
+		msg := "ssh-keyscan failed: " + err.Error()
+		if ctx.Err() == stdcontext.DeadlineExceeded {
+			msg = util.Localize(util.RequestLanguage(r), util.MsgTimedOut, "ssh-keyscan")
+		}
+
+		util.WriteError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if len(strings.TrimSpace(string(out))) == 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNoHostKeys, nil, body.Host)
+		return
+	}
+
+	knownHosts := ""
+	if project.KnownHosts != nil {
+		knownHosts = *project.KnownHosts
+	}
+
+	merged, added := mergeKnownHosts(knownHosts, string(out))
+	if err := db.ValidateKnownHosts(merged); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if len(added) > 0 {
+		if _, err := db.Mysql.Exec("update project set known_hosts=? where id=?", merged, project.ID); err != nil {
+			panic(err)
+		}
+
+		desc := "Host keys of " + body.Host + " added to known hosts"
+		objType := "Project"
+		if err := (db.Event{
+			ProjectID:   &project.ID,
+			ObjectType:  &objType,
+			ObjectID:    &project.ID,
+			Description: &desc,
+		}.Insert()); err != nil {
+			panic(err)
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"added":       added,
+		"known_hosts": merged,
+	})
+}
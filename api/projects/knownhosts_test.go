@@ -0,0 +1,21 @@
+package projects
+
+import "testing"
+
+func TestMergeKnownHosts(t *testing.T) {
+	knownHosts := "# curated\nweb1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIA"
+	scanned := "web1 ssh-ed25519  AAAAC3NzaC1lZDI1NTE5AAAAIA\nweb1 ssh-rsa AAAAB3NzaC1yc2E=\n# web1:22 SSH-2.0-OpenSSH\n"
+
+	merged, added := mergeKnownHosts(knownHosts, scanned)
+	if len(added) != 1 || added[0] != "web1 ssh-rsa AAAAB3NzaC1yc2E=" {
+		t.Fatalf("only the new key must be added, got %q", added)
+	}
+
+	if merged != knownHosts+"\nweb1 ssh-rsa AAAAB3NzaC1yc2E=\n" {
+		t.Fatalf("unexpected known hosts %q", merged)
+	}
+
+	if again, added := mergeKnownHosts(merged, scanned); len(added) != 0 || again != merged {
+		t.Fatalf("scanning again must not change the known hosts, added %q", added)
+	}
+}
@@ -0,0 +1,39 @@
+package projects
+
+import (
+	"net/http"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/masterminds/squirrel"
+)
+
+// nameTaken reports whether another object of the project already uses the name.
+// excludeID is the id of the object being renamed, 0 for new objects.
+// Objects marked as removed don't reserve their names
+func nameTaken(table string, column string, softRemoved bool, projectID int, name string, excludeID int) bool {
+	q := squirrel.Select("count(1)").
+		From(table).
+		Where("project_id=?", projectID).
+		Where(column+"=?", name).
+		Where("id!=?", excludeID)
+
+	if softRemoved {
+		q = q.Where("removed=0")
+	}
+
+	query, args, err := q.ToSql()
+	util.LogWarning(err)
+
+	count, err := db.Mysql.SelectInt(query, args...)
+	if err != nil {
+		panic(err)
+	}
+
+	return count > 0
+}
+
+// writeNameTaken responds that the name is already used in the project
+func writeNameTaken(w http.ResponseWriter, r *http.Request, objType string, name string) {
+	util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgNameTaken, nil, name, objType)
+}
@@ -2,13 +2,15 @@ package projects
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/fiftin/semaphore/db"
 
 	"github.com/fiftin/semaphore/util"
 	"github.com/gorilla/context"
-	"github.com/masterminds/squirrel"
 )
 
 // ProjectMiddleware ensures a project exists and loads it to the context
@@ -21,24 +23,35 @@ func ProjectMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		query, args, err := squirrel.Select("p.*").
-			From("project as p").
-			Join("project__user as pu on pu.project_id=p.id").
-			Where("p.id=?", projectID).
-			Where("pu.user_id=?", user.ID).
-			ToSql()
-		util.LogWarning(err)
+		role, err := roles.get(user.ID, projectID)
+		if err != nil {
+			panic(err)
+		}
+
+		if !role.Member {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgProjectNotFound, nil)
+			return
+		}
 
 		var project db.Project
-		if err := db.Mysql.SelectOne(&project, query, args...); err != nil {
+		if err := db.Mysql.SelectOne(&project, "select * from project where id=?", projectID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				roles.invalidate(0, projectID)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgProjectNotFound, nil)
 				return
 			}
 
 			panic(err)
 		}
 
+		if user.LastProjectID == nil || *user.LastProjectID != project.ID {
+			if _, err := db.Mysql.Exec("update user set last_project_id=? where id=?", project.ID, user.ID); err != nil {
+				panic(err)
+			}
+
+			user.LastProjectID = &project.ID
+		}
+
 		context.Set(r, "project", project)
 		next.ServeHTTP(w, r)
 	})
@@ -46,7 +59,12 @@ func ProjectMiddleware(next http.Handler) http.Handler {
 
 //GetProject returns a project details
 func GetProject(w http.ResponseWriter, r *http.Request) {
-	util.WriteJSON(w, http.StatusOK, context.Get(r, "project"))
+	project := context.Get(r, "project").(db.Project)
+	if err := project.RedactWebhookHeaders(); err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, project)
 }
 
 // MustBeAdmin ensures that the user has administrator rights
@@ -55,33 +73,207 @@ func MustBeAdmin(next http.Handler) http.Handler {
 		project := context.Get(r, "project").(db.Project)
 		user := context.Get(r, "user").(*db.User)
 
-		userC, err := db.Mysql.SelectInt("select count(1) from project__user as pu join user as u on pu.user_id=u.id where pu.user_id=? and pu.project_id=? and pu.admin=1", user.ID, project.ID)
-		if err != nil {
-			panic(err)
-		}
-
-		if userC == 0 {
-			w.WriteHeader(http.StatusForbidden)
+		if !isAdmin(project, user) {
+			util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgProjectAdminRequired, nil)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// isAdmin reports whether the user has administrator rights in the project
+func isAdmin(project db.Project, user *db.User) bool {
+	role, err := roles.get(user.ID, project.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	return role.Admin
+}
+
+// isValidVars reports whether vars is empty or a JSON object of ansible variables
+func isValidVars(vars *string) bool {
+	if vars == nil || len(*vars) == 0 {
+		return true
+	}
+
+	var js map[string]interface{}
+	return json.Unmarshal([]byte(*vars), &js) == nil
+}
+
+// hasReservedVar reports whether the JSON object vars defines the variable the metadata of tasks is passed in
+func hasReservedVar(vars *string) bool {
+	if vars == nil || len(*vars) == 0 {
+		return false
+	}
+
+	var js map[string]interface{}
+	if json.Unmarshal([]byte(*vars), &js) != nil {
+		return false
+	}
+
+	_, ok := js[db.TaskVarsName]
+	return ok
+}
+
+// isProjectResource reports whether id is empty or the id of a resource of the project which isn't removed,
+// table is one of the project resource tables
+func isProjectResource(table string, projectID int, id *int) bool {
+	if id == nil {
+		return true
+	}
+
+	count, err := db.Mysql.SelectInt("select count(1) from "+table+" where project_id=? and id=? and removed=0", projectID, *id)
+	if err != nil {
+		panic(err)
+	}
+
+	return count > 0
+}
+
 // UpdateProject saves updated project details to the database
 func UpdateProject(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 	var body struct {
-		Name      string `json:"name"`
-		Alert     bool   `json:"alert"`
-		AlertChat string `json:"alert_chat"`
+		Name      string  `json:"name"`
+		Alert     bool    `json:"alert"`
+		AlertChat string  `json:"alert_chat"`
+		Vars      *string `json:"vars"`
+
+		// keeps the current url when omitted, an empty string removes it
+		WebhookURL *string `json:"webhook_url"`
+		// keeps the current secret when omitted, an empty string removes it
+		WebhookSecret *string `json:"webhook_secret"`
+		// keeps the current headers when omitted, a null value keeps the value of a header
+		WebhookHeaders map[string]*string `json:"webhook_headers"`
+		// keeps the current known hosts when omitted, an empty string removes them
+		KnownHosts *string `json:"known_hosts"`
+
+		DefaultInventoryID   *int `json:"default_inventory_id"`
+		DefaultRepositoryID  *int `json:"default_repository_id"`
+		DefaultEnvironmentID *int `json:"default_environment_id"`
+		KeepTasks            *int `json:"keep_tasks"`
 	}
 
+	// omitted fields keep their values, null removes the optional ones
+	body.Name = project.Name
+	body.Alert = project.Alert
+	body.AlertChat = project.AlertChat
+	body.Vars = project.Vars
+	body.DefaultInventoryID = project.DefaultInventoryID
+	body.DefaultRepositoryID = project.DefaultRepositoryID
+	body.DefaultEnvironmentID = project.DefaultEnvironmentID
+	body.KeepTasks = project.KeepTasks
+
 	if err := util.Bind(w, r, &body); err != nil {
 		return
 	}
 
-	if _, err := db.Mysql.Exec("update project set name=?, alert=?, alert_chat=? where id=?", body.Name, body.Alert, body.AlertChat, project.ID); err != nil {
+	if !isValidVars(body.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgVarsNotObject, nil)
+		return
+	}
+
+	if hasReservedVar(body.Vars) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgReservedVar, nil, db.TaskVarsName)
+		return
+	}
+
+	webhookURL := project.WebhookURL
+	if body.WebhookURL != nil {
+		webhookURL = body.WebhookURL
+		if *webhookURL == "" {
+			webhookURL = nil
+		} else if u, err := url.Parse(*webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidWebhookURL, nil)
+			return
+		}
+	}
+
+	if err := db.ValidateKeepTasks(body.KeepTasks); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !isProjectResource("project__inventory", project.ID, body.DefaultInventoryID) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgDefaultInventoryNotFound, nil)
+		return
+	}
+
+	if !isProjectResource("project__repository", project.ID, body.DefaultRepositoryID) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgDefaultRepositoryNotFound, nil)
+		return
+	}
+
+	if !isProjectResource("project__environment", project.ID, body.DefaultEnvironmentID) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgDefaultEnvironmentNotFound, nil)
+		return
+	}
+
+	knownHosts := project.KnownHosts
+	if body.KnownHosts != nil {
+		knownHosts = body.KnownHosts
+		if strings.TrimSpace(*knownHosts) == "" {
+			knownHosts = nil
+		} else if err := db.ValidateKnownHosts(*knownHosts); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	webhookSecret := project.WebhookSecret
+	if body.WebhookSecret != nil {
+		webhookSecret = body.WebhookSecret
+		if *webhookSecret == "" {
+			webhookSecret = nil
+		}
+	}
+
+	webhookHeaders := project.EncryptedWebhookHeaders
+	if body.WebhookHeaders != nil {
+		var err error
+		if webhookHeaders, err = db.EncryptWebhookHeaders(body.WebhookHeaders, project.EncryptedWebhookHeaders); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	if _, err := db.Mysql.Exec("update project set name=?, alert=?, alert_chat=?, vars=?, webhook_url=?, webhook_secret=?, webhook_headers=?, default_inventory_id=?, default_repository_id=?, default_environment_id=?, keep_tasks=?, known_hosts=? where id=?",
+		body.Name, body.Alert, body.AlertChat, body.Vars, webhookURL, webhookSecret, webhookHeaders, body.DefaultInventoryID, body.DefaultRepositoryID, body.DefaultEnvironmentID, body.KeepTasks, knownHosts, project.ID); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ArchiveProject hides a project and stops it from running tasks without removing any data
+func ArchiveProject(w http.ResponseWriter, r *http.Request) {
+	setProjectArchived(w, r, true)
+}
+
+// UnarchiveProject restores an archived project
+func UnarchiveProject(w http.ResponseWriter, r *http.Request) {
+	setProjectArchived(w, r, false)
+}
+
+func setProjectArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	project := context.Get(r, "project").(db.Project)
+
+	if _, err := db.Mysql.Exec("update project set archived=? where id=?", archived, project.ID); err != nil {
+		panic(err)
+	}
+
+	desc := "Project unarchived"
+	if archived {
+		desc = "Project archived"
+	}
+	objType := "Project"
+	if err := (db.Event{
+		ProjectID:   &project.ID,
+		ObjectType:  &objType,
+		ObjectID:    &project.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
 		panic(err)
 	}
 
@@ -122,5 +314,7 @@ func DeleteProject(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
+	roles.invalidate(0, project.ID)
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -2,6 +2,7 @@ package projects
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -12,16 +13,24 @@ import (
 	"github.com/masterminds/squirrel"
 )
 
-// GetProjects returns all projects in this users context
+// GetProjects returns all projects in this users context.
+// Archived projects are only listed with include_archived=1 for their admins
 func GetProjects(w http.ResponseWriter, r *http.Request) {
 	user := context.Get(r, "user").(*db.User)
 
-	query, args, err := squirrel.Select("p.*").
+	q := squirrel.Select("p.*").
 		From("project as p").
 		Join("project__user as pu on pu.project_id=p.id").
 		Where("pu.user_id=?", user.ID).
-		OrderBy("p.name").
-		ToSql()
+		OrderBy("p.name")
+
+	if r.URL.Query().Get("include_archived") != "1" {
+		q = q.Where("p.archived=0")
+	} else if !user.Admin {
+		q = q.Where("(p.archived=0 or pu.admin=1)")
+	}
+
+	query, args, err := q.ToSql()
 
 	util.LogWarning(err)
 	var projects []db.Project
@@ -29,9 +38,63 @@ func GetProjects(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
+	for i := range projects {
+		if err := projects[i].RedactWebhookHeaders(); err != nil {
+			panic(err)
+		}
+	}
+
+	if r.URL.Query().Get("stats") == "1" {
+		stats := getProjectStats(user.ID)
+		for i, p := range projects {
+			projects[i].Stats = &db.ProjectStats{}
+			if s, ok := stats[p.ID]; ok {
+				projects[i].Stats = &s
+			}
+		}
+	}
+
 	util.WriteJSON(w, http.StatusOK, projects)
 }
 
+// projectStatsWindow is how far back finished tasks are counted in the project stats
+const projectStatsWindow = 24 * time.Hour
+
+// getProjectStats counts the tasks of all projects of the user in one query, by project id.
+// Projects without recent tasks are missing from the map
+func getProjectStats(userID int) map[int]db.ProjectStats {
+	since := time.Now().Add(-projectStatsWindow)
+
+	var rows []db.ProjectStats
+	if _, err := db.Mysql.Select(&rows, "select pt.project_id, "+
+		"sum(t.status=?) as waiting, "+
+		"sum(t.status=?) as running, "+
+		"sum(t.status=? and t.created > ?) as success, "+
+		"sum(t.status=? and t.created > ?) as failed, "+
+		"sum(t.status=? and t.created > ?) as stopped "+
+		"from task as t "+
+		"join project__template as pt on pt.id=t.template_id "+
+		"join project__user as pu on pu.project_id=pt.project_id and pu.user_id=? "+
+		"where t.status in (?, ?) or t.created > ? "+
+		"group by pt.project_id",
+		db.TaskWaitingStatus,
+		db.TaskRunningStatus,
+		db.TaskSuccessStatus, since,
+		db.TaskErrorStatus, since,
+		db.TaskStoppedStatus, since,
+		userID,
+		db.TaskWaitingStatus, db.TaskRunningStatus, since); err != nil {
+		panic(err)
+	}
+
+	stats := make(map[int]db.ProjectStats)
+	for _, row := range rows {
+		stats[row.ProjectID] = row
+	}
+
+	return stats
+}
+
 // AddProject adds a new project to the database
 func AddProject(w http.ResponseWriter, r *http.Request) {
 	var body db.Project
@@ -49,6 +112,7 @@ func AddProject(w http.ResponseWriter, r *http.Request) {
 	if _, err := db.Mysql.Exec("insert into project__user set project_id=?, user_id=?, `admin`=1", body.ID, user.ID); err != nil {
 		panic(err)
 	}
+	roles.invalidate(user.ID, body.ID)
 
 	desc := "Project Created"
 	oType := "Project"
@@ -62,5 +126,5 @@ func AddProject(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	util.WriteJSON(w, http.StatusCreated, body)
+	util.WriteCreated(w, "project/"+strconv.Itoa(body.ID)+"/", body)
 }
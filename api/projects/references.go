@@ -0,0 +1,55 @@
+package projects
+
+import (
+	"net/http"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// objectReference describes an object which depends on an object that is about to be removed
+type objectReference struct {
+	Type string `db:"type" json:"type"`
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
+func getReferences(query string, args ...interface{}) []objectReference {
+	var refs []objectReference
+	if _, err := db.Mysql.Select(&refs, query, args...); err != nil {
+		panic(err)
+	}
+
+	return refs
+}
+
+func getKeyReferences(key db.AccessKey) []objectReference {
+	return getReferences("select 'template' as type, id, alias as name from project__template where project_id=? and ssh_key_id=?"+
+		" union all select 'inventory' as type, id, name from project__inventory where project_id=? and (ssh_key_id=? or key_id=?)"+
+		" union all select 'repository' as type, id, name from project__repository where project_id=? and ssh_key_id=?",
+		*key.ProjectID, key.ID,
+		*key.ProjectID, key.ID, key.ID,
+		*key.ProjectID, key.ID)
+}
+
+func getInventoryReferences(inventory db.Inventory) []objectReference {
+	return getReferences("select 'template' as type, id, alias as name from project__template where project_id=? and inventory_id=?", inventory.ProjectID, inventory.ID)
+}
+
+func getRepositoryReferences(repository db.Repository) []objectReference {
+	return getReferences("select 'template' as type, id, alias as name from project__template where project_id=? and repository_id=?", repository.ProjectID, repository.ID)
+}
+
+// isForcedRemoval reports whether the request asks to remove an object even though it is in use.
+// setRemoved is the legacy name of the force parameter
+func isForcedRemoval(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "1" || len(r.URL.Query().Get("setRemoved")) > 0
+}
+
+// writeInUse responds with the message id of the catalog and the objects which prevent the removal
+func writeInUse(w http.ResponseWriter, r *http.Request, id string, refs []objectReference) {
+	util.WriteLocalizedError(w, r, http.StatusConflict, id, map[string]interface{}{
+		"inUse":      true,
+		"references": refs,
+	})
+}
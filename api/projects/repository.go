@@ -1,10 +1,15 @@
 package projects
 
 import (
+	stdcontext "context"
 	"database/sql"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -35,7 +40,7 @@ func RepositoryMiddleware(next http.Handler) http.Handler {
 		var repository db.Repository
 		if err := db.Mysql.SelectOne(&repository, "select * from project__repository where project_id=? and id=?", project.ID, repositoryID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgRepositoryNotFound, nil)
 				return
 			}
 
@@ -64,7 +69,12 @@ func GetRepositories(w http.ResponseWriter, r *http.Request) {
 		"pr.project_id",
 		"pr.git_url",
 		"pr.ssh_key_id",
-		"pr.removed").
+		"pr.removed",
+		"pr.http_proxy",
+		"pr.ssh_proxy_jump",
+		"pr.require_signature",
+		"pr.trusted_keys",
+		"pr.cached_clone").
 		From("project__repository pr")
 
 	switch sort {
@@ -90,20 +100,52 @@ func GetRepositories(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, repos)
 }
 
+// GetRepository returns a single repository of the project
+func GetRepository(w http.ResponseWriter, r *http.Request) {
+	util.WriteJSON(w, http.StatusOK, context.Get(r, "repository").(db.Repository))
+}
+
+// validateRepository clears empty proxy settings and trusted keys and writes a bad request when they are not valid
+func validateRepository(w http.ResponseWriter, repository *db.Repository) bool {
+	if repository.HTTPProxy != nil && *repository.HTTPProxy == "" {
+		repository.HTTPProxy = nil
+	}
+
+	if repository.SSHProxyJump != nil && *repository.SSHProxyJump == "" {
+		repository.SSHProxyJump = nil
+	}
+
+	if repository.TrustedKeys != nil && strings.TrimSpace(*repository.TrustedKeys) == "" {
+		repository.TrustedKeys = nil
+	}
+
+	if err := repository.ValidateProxy(); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+
+	if err := repository.ValidateSignature(); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+
+	return true
+}
+
 // AddRepository creates a new repository in the database
 func AddRepository(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 
-	var repository struct {
-		Name     string `json:"name" binding:"required"`
-		GitURL   string `json:"git_url" binding:"required"`
-		SSHKeyID int    `json:"ssh_key_id" binding:"required"`
-	}
+	var repository db.Repository
 	if err := util.Bind(w, r, &repository); err != nil {
 		return
 	}
 
-	res, err := db.Mysql.Exec("insert into project__repository set project_id=?, git_url=?, ssh_key_id=?, name=?", project.ID, repository.GitURL, repository.SSHKeyID, repository.Name)
+	if !validateRepository(w, &repository) {
+		return
+	}
+
+	res, err := db.Mysql.Exec("insert into project__repository set project_id=?, git_url=?, ssh_key_id=?, name=?, http_proxy=?, ssh_proxy_jump=?, require_signature=?, trusted_keys=?, cached_clone=?", project.ID, repository.GitURL, repository.SSHKeyID, repository.Name, repository.HTTPProxy, repository.SSHProxyJump, repository.RequireSignature, repository.TrustedKeys, repository.CachedClone)
 	if err != nil {
 		panic(err)
 	}
@@ -123,22 +165,34 @@ func AddRepository(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/repositories/"+strconv.Itoa(insertIDInt), db.Repository{
+		ID:           insertIDInt,
+		Name:         repository.Name,
+		ProjectID:    project.ID,
+		GitURL:       repository.GitURL,
+		SSHKeyID:     repository.SSHKeyID,
+		HTTPProxy:    repository.HTTPProxy,
+		SSHProxyJump: repository.SSHProxyJump,
+
+		RequireSignature: repository.RequireSignature,
+		TrustedKeys:      repository.TrustedKeys,
+		CachedClone:      repository.CachedClone,
+	})
 }
 
 // UpdateRepository updates the values of a repository in the database
 func UpdateRepository(w http.ResponseWriter, r *http.Request) {
 	oldRepo := context.Get(r, "repository").(db.Repository)
-	var repository struct {
-		Name     string `json:"name" binding:"required"`
-		GitURL   string `json:"git_url" binding:"required"`
-		SSHKeyID int    `json:"ssh_key_id" binding:"required"`
-	}
+	var repository db.Repository
 	if err := util.Bind(w, r, &repository); err != nil {
 		return
 	}
 
-	if _, err := db.Mysql.Exec("update project__repository set name=?, git_url=?, ssh_key_id=? where id=?", repository.Name, repository.GitURL, repository.SSHKeyID, oldRepo.ID); err != nil {
+	if !validateRepository(w, &repository) {
+		return
+	}
+
+	if _, err := db.Mysql.Exec("update project__repository set name=?, git_url=?, ssh_key_id=?, http_proxy=?, ssh_proxy_jump=?, require_signature=?, trusted_keys=?, cached_clone=? where id=?", repository.Name, repository.GitURL, repository.SSHKeyID, repository.HTTPProxy, repository.SSHProxyJump, repository.RequireSignature, repository.TrustedKeys, repository.CachedClone, oldRepo.ID); err != nil {
 		panic(err)
 	}
 
@@ -164,18 +218,14 @@ func UpdateRepository(w http.ResponseWriter, r *http.Request) {
 func RemoveRepository(w http.ResponseWriter, r *http.Request) {
 	repository := context.Get(r, "repository").(db.Repository)
 
-	templatesC, err := db.Mysql.SelectInt("select count(1) from project__template where project_id=? and repository_id=?", repository.ProjectID, repository.ID)
-	if err != nil {
-		panic(err)
-	}
-
-	if templatesC > 0 {
-		if len(r.URL.Query().Get("setRemoved")) == 0 {
-			util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"error":        "Repository is in use by one or more templates",
-				"templatesUse": true,
-			})
+	if refs := getRepositoryReferences(repository); len(refs) > 0 {
+		if !isForcedRemoval(r) {
+			writeInUse(w, r, util.MsgRepositoryInUse, refs)
+			return
+		}
 
+		if !isAdmin(context.Get(r, "project").(db.Project), context.Get(r, "user").(*db.User)) {
+			util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgAdminRemoveRepositoryInUse, nil)
 			return
 		}
 
@@ -203,3 +253,105 @@ func RemoveRepository(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// repositoryTestTimeout limits how long a repository access test may take
+const repositoryTestTimeout = 30 * time.Second
+
+// TestRepository checks that the repository can be reached with its access key by running git ls-remote
+func TestRepository(w http.ResponseWriter, r *http.Request) {
+	repository := context.Get(r, "repository").(db.Repository)
+
+	var key db.AccessKey
+	if err := db.Mysql.SelectOne(&key, "select * from access_key where id=?", repository.SSHKeyID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgRepositoryKeyNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	if (key.Type != "ssh" && key.Type != "login_password") || key.Secret == nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidRepositoryKeyType, nil, key.Type)
+		return
+	}
+
+	if err := os.MkdirAll(util.Config.TmpPath, 0700); err != nil {
+		panic(err)
+	}
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if key.Type == "ssh" {
+		keyFile, err := ioutil.TempFile(util.Config.TmpPath, "repository_test_key_")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(keyFile.Name()) //nolint: errcheck
+
+		_, err = keyFile.WriteString(*key.Secret)
+		util.LogWarning(keyFile.Close())
+		if err != nil {
+			panic(err)
+		}
+
+		// host keys are verified against the known hosts of the project when it has any
+		hostKeyOptions := "-o StrictHostKeyChecking=no"
+		if project := context.Get(r, "project").(db.Project); project.KnownHosts != nil {
+			knownHostsFile, err := ioutil.TempFile(util.Config.TmpPath, "repository_test_known_hosts_")
+			if err != nil {
+				panic(err)
+			}
+			defer os.Remove(knownHostsFile.Name()) //nolint: errcheck
+
+			_, err = knownHostsFile.WriteString(*project.KnownHosts)
+			util.LogWarning(knownHostsFile.Close())
+			if err != nil {
+				panic(err)
+			}
+
+			hostKeyOptions = "-o UserKnownHostsFile=" + knownHostsFile.Name() + " -o StrictHostKeyChecking=yes"
+		}
+
+		env = append(env, "GIT_SSH_COMMAND=ssh "+hostKeyOptions+" -o BatchMode=yes -i "+keyFile.Name()+repository.SSHProxyOptions())
+	} else {
+		credentialEnv, err := key.GitCredentialEnv()
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		env = append(env, credentialEnv...)
+	}
+
+	repoURL, repoTag := repository.GitURL, "master"
+	if split := strings.Split(repoURL, "#"); len(split) > 1 {
+		repoURL, repoTag = split[0], split[1]
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), repositoryTestTimeout)
+	defer cancel()
+
+	args := append(repository.GitProxyArgs(), key.GitCredentialArgs()...)
+	args = append(args, "ls-remote", repoURL, repoTag)
+	cmd := exec.CommandContext(ctx, "git", args...) //nolint: gas
+	cmd.Dir = util.Config.TmpPath
+	cmd.Env = env
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if ctx.Err() == stdcontext.DeadlineExceeded {
+			msg = util.Localize(util.RequestLanguage(r), util.MsgTimedOut, "git ls-remote")
+		} else if len(msg) == 0 {
+			msg = err.Error()
+		}
+
+		util.WriteError(w, http.StatusBadRequest, msg, map[string]interface{}{
+			"success": false,
+		})
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,126 @@
+package projects
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// roleCacheTTL is how long the membership of a user in a project is used without reading it again.
+// Changes made through the api invalidate it right away, it only bounds changes made to the database directly
+const roleCacheTTL = 30 * time.Second
+
+// roleCacheSweepSize is the number of cached roles above which expired ones are dropped
+const roleCacheSweepSize = 10000
+
+// projectRole is the membership of a user in a project
+type projectRole struct {
+	Member bool
+	Admin  bool
+}
+
+type roleKey struct {
+	userID    int
+	projectID int
+}
+
+type cachedRole struct {
+	role    projectRole
+	expires time.Time
+}
+
+// roleCache keeps the roles of users in projects for ttl, so the project middlewares don't
+// have to query the membership on every request. It is safe for concurrent use
+type roleCache struct {
+	lock  sync.RWMutex
+	ttl   time.Duration
+	roles map[roleKey]cachedRole
+	load  func(userID int, projectID int) (projectRole, error)
+	// generation is increased by every invalidate, a role loaded under an older generation
+	// may predate the change and is returned without being cached
+	generation uint64
+}
+
+func newRoleCache(ttl time.Duration, load func(userID int, projectID int) (projectRole, error)) *roleCache {
+	return &roleCache{
+		ttl:   ttl,
+		roles: make(map[roleKey]cachedRole),
+		load:  load,
+	}
+}
+
+// get returns the role of the user in the project, loading it when it isn't cached or has expired
+func (c *roleCache) get(userID int, projectID int) (projectRole, error) {
+	key := roleKey{userID: userID, projectID: projectID}
+	now := time.Now()
+
+	c.lock.RLock()
+	cached, ok := c.roles[key]
+	generation := c.generation
+	c.lock.RUnlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	role, err := c.load(userID, projectID)
+	if err != nil {
+		return role, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.generation != generation {
+		return role, nil
+	}
+
+	if len(c.roles) >= roleCacheSweepSize {
+		for k, r := range c.roles {
+			if !now.Before(r.expires) {
+				delete(c.roles, k)
+			}
+		}
+	}
+
+	c.roles[key] = cachedRole{role: role, expires: now.Add(c.ttl)}
+	return role, nil
+}
+
+// invalidate drops the cached roles matching the user and the project, 0 matches any
+func (c *roleCache) invalidate(userID int, projectID int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	for k := range c.roles {
+		if (userID == 0 || k.userID == userID) && (projectID == 0 || k.projectID == projectID) {
+			delete(c.roles, k)
+		}
+	}
+}
+
+// loadProjectRole reads the membership of a user in a project from the database
+func loadProjectRole(userID int, projectID int) (projectRole, error) {
+	var membership struct {
+		Admin bool `db:"admin"`
+	}
+
+	err := db.Mysql.SelectOne(&membership, "select `admin` from project__user where user_id=? and project_id=?", userID, projectID)
+	if err == sql.ErrNoRows {
+		return projectRole{}, nil
+	} else if err != nil {
+		return projectRole{}, err
+	}
+
+	return projectRole{Member: true, Admin: membership.Admin}, nil
+}
+
+var roles = newRoleCache(roleCacheTTL, loadProjectRole)
+
+// InvalidateUserRoles forgets the cached project roles of a user, for changes made outside of the project api
+func InvalidateUserRoles(userID int) {
+	roles.invalidate(userID, 0)
+}
@@ -0,0 +1,110 @@
+package projects
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoleCache(t *testing.T) {
+	loads := 0
+	cache := newRoleCache(time.Hour, func(userID int, projectID int) (projectRole, error) {
+		loads++
+		return projectRole{Member: true, Admin: userID == 1}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		role, err := cache.get(1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !role.Member || !role.Admin {
+			t.Fatal("expected user 1 to be an admin")
+		}
+	}
+
+	if loads != 1 {
+		t.Fatal("expected the role to be loaded once")
+	}
+
+	cache.get(2, 10) //nolint: errcheck
+	cache.get(1, 11) //nolint: errcheck
+	cache.invalidate(0, 10)
+
+	cache.get(1, 11) //nolint: errcheck
+	if loads != 3 {
+		t.Fatal("roles of other projects must stay cached")
+	}
+
+	cache.get(1, 10) //nolint: errcheck
+	cache.get(2, 10) //nolint: errcheck
+	if loads != 5 {
+		t.Fatal("roles of the invalidated project must be loaded again")
+	}
+}
+
+func TestRoleCacheInvalidatedDuringLoad(t *testing.T) {
+	var cache *roleCache
+	admin := true
+	cache = newRoleCache(time.Hour, func(userID int, projectID int) (projectRole, error) {
+		role := projectRole{Member: true, Admin: admin}
+		if admin {
+			// the user is demoted after the old role was read
+			admin = false
+			cache.invalidate(userID, projectID)
+		}
+		return role, nil
+	})
+
+	cache.get(1, 10) //nolint: errcheck
+
+	role, err := cache.get(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role.Admin {
+		t.Fatal("a role loaded before an invalidation must not be cached")
+	}
+}
+
+func TestRoleCacheTTL(t *testing.T) {
+	loads := 0
+	cache := newRoleCache(time.Millisecond, func(userID int, projectID int) (projectRole, error) {
+		loads++
+		return projectRole{Member: true}, nil
+	})
+
+	cache.get(1, 10) //nolint: errcheck
+	time.Sleep(5 * time.Millisecond)
+	cache.get(1, 10) //nolint: errcheck
+
+	if loads != 2 {
+		t.Fatal("expired roles must be loaded again")
+	}
+}
+
+func TestRoleCacheConcurrency(t *testing.T) {
+	var lock sync.Mutex
+	cache := newRoleCache(time.Hour, func(userID int, projectID int) (projectRole, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return projectRole{Member: true}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.get(i%3, j%5) //nolint: errcheck
+				if j%10 == 0 {
+					cache.invalidate(i%3, 0)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
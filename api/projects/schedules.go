@@ -0,0 +1,108 @@
+package projects
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// scheduleResponse is a schedule with its next run time in UTC
+type scheduleResponse struct {
+	db.Schedule
+	NextRun *time.Time `json:"next_run"`
+}
+
+// GetTemplateSchedule returns the schedule of a template
+func GetTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	var schedule db.Schedule
+	if err := db.Mysql.SelectOne(&schedule, "select * from project__template_schedule where template_id=?", template.ID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTemplateHasNoSchedule, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	res := scheduleResponse{Schedule: schedule}
+	if cron, err := util.ParseCron(schedule.CronFormat); err == nil {
+		if loc, err := util.ScheduleLocation(schedule.Timezone); err == nil {
+			if next, ok := cron.Next(time.Now().In(loc)); ok {
+				next = next.UTC()
+				res.NextRun = &next
+			}
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+// UpdateTemplateSchedule creates or replaces the schedule of a template
+func UpdateTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	var schedule db.Schedule
+	if err := util.Bind(w, r, &schedule); err != nil {
+		return
+	}
+
+	if schedule.Timezone != nil && *schedule.Timezone == "" {
+		schedule.Timezone = nil
+	}
+
+	if _, err := util.ParseCron(schedule.CronFormat); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if _, err := util.ScheduleLocation(schedule.Timezone); err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgUnknownTimezone, nil, *schedule.Timezone)
+		return
+	}
+
+	if _, err := db.Mysql.Exec("insert into project__template_schedule set template_id=?, cron_format=?, timezone=? on duplicate key update cron_format=values(cron_format), timezone=values(timezone)", template.ID, schedule.CronFormat, schedule.Timezone); err != nil {
+		panic(err)
+	}
+
+	objType := "template"
+	desc := "Template ID " + strconv.Itoa(template.ID) + " scheduled at " + schedule.CronFormat
+	if err := (db.Event{
+		ProjectID:   &template.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &template.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveTemplateSchedule stops the scheduled runs of a template
+func RemoveTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	if _, err := db.Mysql.Exec("delete from project__template_schedule where template_id=?", template.ID); err != nil {
+		panic(err)
+	}
+
+	objType := "template"
+	desc := "Template ID " + strconv.Itoa(template.ID) + " schedule removed"
+	if err := (db.Event{
+		ProjectID:   &template.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &template.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
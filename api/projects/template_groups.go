@@ -0,0 +1,93 @@
+package projects
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// maxGroupLength is the size of the group_name column
+const maxGroupLength = 255
+
+// normalizeGroup trims a template group name, blank names mean the template is not grouped
+func normalizeGroup(group *string) *string {
+	if group == nil {
+		return nil
+	}
+
+	name := strings.TrimSpace(*group)
+	if len(name) == 0 {
+		return nil
+	}
+
+	return &name
+}
+
+// GetTemplateGroups returns the names of the groups templates of the project are assigned to
+func GetTemplateGroups(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var rows []struct {
+		Name string `db:"group_name"`
+	}
+	if _, err := db.Mysql.Select(&rows, "select distinct group_name from project__template where project_id=? and group_name is not null order by group_name", project.ID); err != nil {
+		panic(err)
+	}
+
+	groups := make([]string, len(rows))
+	for i, row := range rows {
+		groups[i] = row.Name
+	}
+
+	util.WriteJSON(w, http.StatusOK, groups)
+}
+
+// RenameTemplateGroup moves all templates of a group to another group, an empty new name ungroups them
+func RenameTemplateGroup(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var body struct {
+		Name    string  `json:"name"`
+		NewName *string `json:"new_name"`
+	}
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	newName := normalizeGroup(body.NewName)
+	if newName != nil && len(*newName) > maxGroupLength {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgGroupTooLong, nil, maxGroupLength)
+		return
+	}
+
+	res, err := db.Mysql.Exec("update project__template set group_name=? where project_id=? and group_name=?", newName, project.ID, body.Name)
+	if err != nil {
+		panic(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+
+	if affected == 0 {
+		util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgGroupNotFound, nil)
+		return
+	}
+
+	desc := "Template group " + body.Name + " ungrouped"
+	if newName != nil {
+		desc = "Template group " + body.Name + " renamed to " + *newName
+	}
+	if err := (db.Event{
+		ProjectID:   &project.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,8 +2,10 @@ package projects
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/fiftin/semaphore/db"
 
@@ -12,6 +14,9 @@ import (
 	"github.com/masterminds/squirrel"
 )
 
+// maxResourceLength is the size of the resource column
+const maxResourceLength = 255
+
 // TemplatesMiddleware ensures a template exists and loads it to the context
 func TemplatesMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -24,7 +29,7 @@ func TemplatesMiddleware(next http.Handler) http.Handler {
 		var template db.Template
 		if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", project.ID, templateID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTemplateNotFound, nil)
 				return
 			}
 
@@ -55,15 +60,47 @@ func GetTemplates(w http.ResponseWriter, r *http.Request) {
 		"pt.repository_id",
 		"pt.environment_id",
 		"pt.alias",
+		"pt.group_name",
 		"pt.playbook",
 		"pt.arguments",
-		"pt.override_args").
+		"pt.override_args",
+		"pt.allowed_args",
+		"pt.env",
+		"pt.requirements_path",
+		"pt.requirements",
+		"pt.working_directory",
+		"pt.survey_vars",
+		"pt.artifacts",
+		"pt.notifications",
+		"pt.run_window",
+		"pt.forks",
+		"pt.failure_pattern",
+		"pt.success_exit_codes",
+		"pt.keep_tasks",
+		"pt.max_retries",
+		"pt.retry_delay",
+		"pt.required_template_id",
+		"pt.required_within",
+		"pt.production",
+		"pt.resource",
+		"pt.runner_tag").
 		From("project__template pt")
 
+	if group, ok := r.URL.Query()["group"]; ok {
+		if len(group[0]) == 0 {
+			q = q.Where("pt.group_name is null")
+		} else {
+			q = q.Where("pt.group_name=?", group[0])
+		}
+	}
+
 	switch sort {
 	case "alias", "playbook":
 		q = q.Where("pt.project_id=?", project.ID).
 			OrderBy("pt." + sort + " " + order)
+	case "group":
+		q = q.Where("pt.project_id=?", project.ID).
+			OrderBy("pt.group_name "+order, "pt.alias "+order)
 	case "ssh_key":
 		q = q.LeftJoin("access_key ak ON (pt.ssh_key_id = ak.id)").
 			Where("pt.project_id=?", project.ID).
@@ -95,6 +132,11 @@ func GetTemplates(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, templates)
 }
 
+// GetTemplate returns a single template of the project
+func GetTemplate(w http.ResponseWriter, r *http.Request) {
+	util.WriteJSON(w, http.StatusOK, context.Get(r, "template").(db.Template))
+}
+
 // AddTemplate adds a template to the database
 func AddTemplate(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
@@ -104,7 +146,22 @@ func AddTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := db.Mysql.Exec("insert into project__template set ssh_key_id=?, project_id=?, inventory_id=?, repository_id=?, environment_id=?, alias=?, playbook=?, arguments=?, override_args=?", template.SSHKeyID, project.ID, template.InventoryID, template.RepositoryID, template.EnvironmentID, template.Alias, template.Playbook, template.Arguments, template.OverrideArguments)
+	applyProjectDefaults(project, &template)
+
+	if !validateTemplate(w, r, &template) {
+		return
+	}
+
+	if !validateRequiredTemplate(w, r, project.ID, 0, &template) {
+		return
+	}
+
+	if nameTaken("project__template", "alias", false, project.ID, template.Alias, 0) {
+		writeNameTaken(w, r, "template", template.Alias)
+		return
+	}
+
+	res, err := db.Mysql.Exec("insert into project__template set ssh_key_id=?, project_id=?, inventory_id=?, repository_id=?, environment_id=?, alias=?, group_name=?, playbook=?, arguments=?, override_args=?, allowed_args=?, env=?, requirements_path=?, requirements=?, working_directory=?, survey_vars=?, artifacts=?, notifications=?, run_window=?, forks=?, failure_pattern=?, success_exit_codes=?, keep_tasks=?, max_retries=?, retry_delay=?, required_template_id=?, required_within=?, production=?, resource=?, runner_tag=?", template.SSHKeyID, project.ID, template.InventoryID, template.RepositoryID, template.EnvironmentID, template.Alias, template.Group, template.Playbook, template.Arguments, template.OverrideArguments, template.AllowedArgs, template.Env, template.RequirementsPath, template.Requirements, template.WorkingDirectory, template.SurveyVars, template.Artifacts, template.Notifications, template.RunWindow, template.Forks, template.FailurePattern, template.SuccessExitCodes, template.KeepTasks, template.MaxRetries, template.RetryDelay, template.RequiredTemplateID, template.RequiredWithin, template.Production, template.Resource, template.RunnerTag)
 	if err != nil {
 		panic(err)
 	}
@@ -127,7 +184,9 @@ func AddTemplate(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	util.WriteJSON(w, http.StatusCreated, template)
+	template.ProjectID = project.ID
+
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/templates/"+strconv.Itoa(template.ID), template)
 }
 
 // UpdateTemplate writes a template to an existing key in the database
@@ -143,7 +202,24 @@ func UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 		template.Arguments = nil
 	}
 
-	if _, err := db.Mysql.Exec("update project__template set ssh_key_id=?, inventory_id=?, repository_id=?, environment_id=?, alias=?, playbook=?, arguments=?, override_args=? where id=?", template.SSHKeyID, template.InventoryID, template.RepositoryID, template.EnvironmentID, template.Alias, template.Playbook, template.Arguments, template.OverrideArguments, oldTemplate.ID); err != nil {
+	if template.Env != nil && *template.Env == "" {
+		template.Env = nil
+	}
+
+	if !validateTemplate(w, r, &template) {
+		return
+	}
+
+	if !validateRequiredTemplate(w, r, oldTemplate.ProjectID, oldTemplate.ID, &template) {
+		return
+	}
+
+	if nameTaken("project__template", "alias", false, oldTemplate.ProjectID, template.Alias, oldTemplate.ID) {
+		writeNameTaken(w, r, "template", template.Alias)
+		return
+	}
+
+	if _, err := db.Mysql.Exec("update project__template set ssh_key_id=?, inventory_id=?, repository_id=?, environment_id=?, alias=?, group_name=?, playbook=?, arguments=?, override_args=?, allowed_args=?, env=?, requirements_path=?, requirements=?, working_directory=?, survey_vars=?, artifacts=?, notifications=?, run_window=?, forks=?, failure_pattern=?, success_exit_codes=?, keep_tasks=?, max_retries=?, retry_delay=?, required_template_id=?, required_within=?, production=?, resource=?, runner_tag=? where id=?", template.SSHKeyID, template.InventoryID, template.RepositoryID, template.EnvironmentID, template.Alias, template.Group, template.Playbook, template.Arguments, template.OverrideArguments, template.AllowedArgs, template.Env, template.RequirementsPath, template.Requirements, template.WorkingDirectory, template.SurveyVars, template.Artifacts, template.Notifications, template.RunWindow, template.Forks, template.FailurePattern, template.SuccessExitCodes, template.KeepTasks, template.MaxRetries, template.RetryDelay, template.RequiredTemplateID, template.RequiredWithin, template.Production, template.Resource, template.RunnerTag, oldTemplate.ID); err != nil {
 		panic(err)
 	}
 
@@ -161,6 +237,189 @@ func UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// applyProjectDefaults fills the inventory, repository and environment a new template omits with the defaults of the project
+func applyProjectDefaults(project db.Project, template *db.Template) {
+	if template.InventoryID == nil || *template.InventoryID == 0 {
+		template.InventoryID = project.DefaultInventoryID
+	}
+
+	if template.RepositoryID == 0 && project.DefaultRepositoryID != nil {
+		template.RepositoryID = *project.DefaultRepositoryID
+	}
+
+	if template.EnvironmentID == nil {
+		template.EnvironmentID = project.DefaultEnvironmentID
+	}
+}
+
+// validateTemplate normalizes the optional template fields and writes a bad request response if they are invalid
+func validateTemplate(w http.ResponseWriter, r *http.Request, template *db.Template) bool {
+	template.Group = normalizeGroup(template.Group)
+
+	if template.InventoryID != nil && *template.InventoryID == 0 {
+		template.InventoryID = nil
+	}
+
+	if template.RequirementsPath != nil && *template.RequirementsPath == "" {
+		template.RequirementsPath = nil
+	}
+
+	if template.WorkingDirectory != nil && *template.WorkingDirectory == "" {
+		template.WorkingDirectory = nil
+	}
+
+	if template.SurveyVars != nil && strings.TrimSpace(*template.SurveyVars) == "" {
+		template.SurveyVars = nil
+	}
+
+	if template.Requirements != nil && strings.TrimSpace(*template.Requirements) == "" {
+		template.Requirements = nil
+	}
+
+	if template.Artifacts != nil && strings.TrimSpace(*template.Artifacts) == "" {
+		template.Artifacts = nil
+	}
+
+	if template.Notifications != nil && strings.TrimSpace(*template.Notifications) == "" {
+		template.Notifications = nil
+	}
+
+	if template.RunWindow != nil && strings.TrimSpace(*template.RunWindow) == "" {
+		template.RunWindow = nil
+	}
+
+	if template.AllowedArgs != nil && strings.TrimSpace(*template.AllowedArgs) == "" {
+		template.AllowedArgs = nil
+	}
+
+	if template.FailurePattern != nil && len(*template.FailurePattern) == 0 {
+		template.FailurePattern = nil
+	}
+
+	if template.SuccessExitCodes != nil && strings.TrimSpace(*template.SuccessExitCodes) == "" {
+		template.SuccessExitCodes = nil
+	}
+
+	if template.Resource != nil {
+		if resource := strings.TrimSpace(*template.Resource); len(resource) > 0 {
+			template.Resource = &resource
+		} else {
+			template.Resource = nil
+		}
+	}
+
+	if template.RunnerTag != nil {
+		if tag := strings.TrimSpace(*template.RunnerTag); len(tag) > 0 {
+			template.RunnerTag = &tag
+		} else {
+			template.RunnerTag = nil
+		}
+	}
+
+	lang := util.RequestLanguage(r)
+
+	var msg string
+	if _, err := db.ParseEnv(template.Env); err != nil {
+		msg = util.Localize(lang, util.MsgEnvNotObject)
+	} else if template.RequirementsPath != nil && template.Requirements != nil {
+		msg = util.Localize(lang, util.MsgRequirementsAndPath)
+	} else if template.RequirementsPath != nil && !util.IsSubPath(*template.RequirementsPath) {
+		msg = util.Localize(lang, util.MsgRequirementsPathNotRelative)
+	} else if !util.IsSubPath(template.Playbook) {
+		msg = util.Localize(lang, util.MsgPlaybookNotRelative)
+	} else if template.WorkingDirectory != nil && !util.IsSubPath(*template.WorkingDirectory) {
+		msg = util.Localize(lang, util.MsgWorkingDirectoryNotRelative)
+	} else if err := validateSurveyVars(template.SurveyVars); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateArtifacts(template.Artifacts); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateAllowedArgs(template.AllowedArgs); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateNotifications(template.Notifications); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateRunWindow(template.RunWindow); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateForks(template.Forks); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateFailurePattern(template.FailurePattern); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateSuccessExitCodes(template.SuccessExitCodes); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateKeepTasks(template.KeepTasks); err != nil {
+		msg = err.Error()
+	} else if err := db.ValidateRetries(template.MaxRetries, template.RetryDelay); err != nil {
+		msg = err.Error()
+	} else if template.Group != nil && len(*template.Group) > maxGroupLength {
+		msg = util.Localize(lang, util.MsgGroupTooLong, maxGroupLength)
+	} else if template.Resource != nil && len(*template.Resource) > maxResourceLength {
+		msg = util.Localize(lang, util.MsgResourceTooLong, maxResourceLength)
+	} else if err := db.ValidateRunnerTag(template.RunnerTag); err != nil {
+		msg = err.Error()
+	}
+
+	if len(msg) > 0 {
+		util.WriteError(w, http.StatusBadRequest, msg, nil)
+		return false
+	}
+
+	return true
+}
+
+// validateRequiredTemplate checks that the template a template depends on is another template of the project
+func validateRequiredTemplate(w http.ResponseWriter, r *http.Request, projectID int, templateID int, template *db.Template) bool {
+	if template.RequiredTemplateID == nil {
+		template.RequiredWithin = nil
+		return true
+	}
+
+	lang := util.RequestLanguage(r)
+
+	var msg string
+	if *template.RequiredTemplateID == templateID {
+		msg = util.Localize(lang, util.MsgTemplateRequiresItself)
+	} else if template.RequiredWithin != nil && *template.RequiredWithin < 1 {
+		msg = util.Localize(lang, util.MsgInvalidRequiredWithin)
+	} else {
+		count, err := db.Mysql.SelectInt("select count(1) from project__template where project_id=? and id=?", projectID, *template.RequiredTemplateID)
+		if err != nil {
+			panic(err)
+		}
+
+		if count == 0 {
+			msg = util.Localize(lang, util.MsgRequiredTemplateNotFound)
+		}
+	}
+
+	if len(msg) > 0 {
+		util.WriteError(w, http.StatusBadRequest, msg, nil)
+		return false
+	}
+
+	return true
+}
+
+// validateSurveyVars checks the survey variable definitions of a template
+func validateSurveyVars(surveyVars *string) error {
+	survey, err := db.ParseSurveyVars(surveyVars)
+	if err != nil {
+		return errors.New("Survey vars must be a JSON array of variables")
+	}
+
+	names := make(map[string]bool)
+	for _, v := range survey {
+		if err := v.Validate(); err != nil {
+			return errors.New("Survey variable " + v.Name + ": " + err.Error())
+		}
+
+		if names[v.Name] {
+			return errors.New("Duplicate survey variable " + v.Name)
+		}
+		names[v.Name] = true
+	}
+
+	return nil
+}
+
 // RemoveTemplate deletes a template from the database
 func RemoveTemplate(w http.ResponseWriter, r *http.Request) {
 	tpl := context.Get(r, "template").(db.Template)
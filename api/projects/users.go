@@ -24,7 +24,7 @@ func UserMiddleware(next http.Handler) http.Handler {
 		var user db.User
 		if err := db.Mysql.SelectOne(&user, "select u.* from project__user as pu join user as u on pu.user_id=u.id where pu.user_id=? and pu.project_id=?", userID, project.ID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgNotProjectMember, nil)
 				return
 			}
 
@@ -71,6 +71,11 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, users)
 }
 
+// GetUser returns a single member of the project
+func GetUser(w http.ResponseWriter, r *http.Request) {
+	util.WriteJSON(w, http.StatusOK, context.Get(r, "projectUser").(db.User))
+}
+
 // AddUser adds a user to a projects team in the database
 func AddUser(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
@@ -87,6 +92,7 @@ func AddUser(w http.ResponseWriter, r *http.Request) {
 	if _, err := db.Mysql.Exec("insert into project__user set user_id=?, project_id=?, `admin`=?", user.UserID, project.ID, user.Admin); err != nil {
 		panic(err)
 	}
+	roles.invalidate(user.UserID, project.ID)
 
 	objType := "user"
 	desc := "User ID " + strconv.Itoa(user.UserID) + " added to team"
@@ -99,7 +105,7 @@ func AddUser(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/users/"+strconv.Itoa(user.UserID), user)
 }
 
 // RemoveUser removes a user from a project team
@@ -110,6 +116,7 @@ func RemoveUser(w http.ResponseWriter, r *http.Request) {
 	if _, err := db.Mysql.Exec("delete from project__user where user_id=? and project_id=?", user.ID, project.ID); err != nil {
 		panic(err)
 	}
+	roles.invalidate(user.ID, project.ID)
 
 	objType := "user"
 	desc := "User ID " + strconv.Itoa(user.ID) + " removed from team"
@@ -139,6 +146,7 @@ func MakeUserAdmin(w http.ResponseWriter, r *http.Request) {
 	if _, err := db.Mysql.Exec("update project__user set `admin`=? where user_id=? and project_id=?", admin, user.ID, project.ID); err != nil {
 		panic(err)
 	}
+	roles.invalidate(user.ID, project.ID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -5,13 +5,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/fiftin/semaphore/api/projects"
 	"github.com/fiftin/semaphore/api/sockets"
 	"github.com/fiftin/semaphore/api/tasks"
 
+	"github.com/fiftin/semaphore/db"
 	"github.com/fiftin/semaphore/util"
 	"github.com/gobuffalo/packr"
+	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/russross/blackfriday"
 )
@@ -42,21 +46,37 @@ func pongHandler(w http.ResponseWriter, r *http.Request) {
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.WriteHeader(http.StatusNotFound)
-	//nolint: errcheck
-	w.Write([]byte("404 not found"))
+	util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgNotFound, nil)
 	fmt.Println(r.Method, ":", r.URL.String(), "--> 404 Not Found")
 }
 
+// publicAPIPaths are the api paths which don't need authentication, relative to the web path
+var publicAPIPaths = []string{"api/ping", "api/ws", "api/auth/", "api/hooks/", "api/setup"}
+
+// apiNotFound answers api requests no route matched with json instead of the frontend. Requests
+// without a valid session or api token get 401 like the routes which exist do, except on public paths
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	for _, path := range publicAPIPaths {
+		if strings.HasPrefix(r.URL.Path, util.WebPath()+path) {
+			notFoundHandler(w, r)
+			return
+		}
+	}
+
+	authentication(http.HandlerFunc(notFoundHandler)).ServeHTTP(w, r)
+}
+
 // Route declares all routes
 func Route() *mux.Router {
 	r := mux.NewRouter().StrictSlash(true)
 	r.NotFoundHandler = http.HandlerFunc(servePublic)
 
-	webPath := "/"
+	// replays of task output include the lines which are still being stored
+	sockets.UnstoredOutput = tasks.UnstoredOutput
+
+	webPath := util.WebPath()
 	if util.WebHostURL != nil {
 		r.Host(util.WebHostURL.Hostname())
-		webPath = util.WebHostURL.Path
 	}
 
 	r.Use(mux.CORSMethodMiddleware(r))
@@ -65,17 +85,27 @@ func Route() *mux.Router {
 	pingRouter.Use(plainTextMiddleware)
 	pingRouter.Methods("GET", "HEAD").HandlerFunc(pongHandler)
 
+	wsRouter := r.Path(webPath + "api/ws").Subrouter()
+	wsRouter.Use(JSONMiddleware, wsAuthentication)
+	wsRouter.Methods("GET", "HEAD").HandlerFunc(sockets.Handler)
+
 	publicAPIRouter := r.PathPrefix(webPath + "api").Subrouter()
 	publicAPIRouter.Use(JSONMiddleware)
 
 	publicAPIRouter.HandleFunc("/auth/login", login).Methods("POST")
 	publicAPIRouter.HandleFunc("/auth/logout", logout).Methods("POST")
+	publicAPIRouter.HandleFunc("/hooks/{token}", tasks.RunHook).Methods("POST")
+	publicAPIRouter.HandleFunc("/setup", getSetup).Methods("GET", "HEAD")
+	publicAPIRouter.HandleFunc("/setup", setup).Methods("POST")
 
 	authenticatedAPI := r.PathPrefix(webPath + "api").Subrouter()
 	authenticatedAPI.Use(JSONMiddleware, authentication)
 
-	authenticatedAPI.Path("/ws").HandlerFunc(sockets.Handler).Methods("GET", "HEAD")
 	authenticatedAPI.Path("/info").HandlerFunc(getSystemInfo).Methods("GET", "HEAD")
+	authenticatedAPI.Path("/info/maintenance").Handler(mustBeAdmin(http.HandlerFunc(setMaintenance))).Methods("POST")
+	authenticatedAPI.Path("/info/queue").Handler(mustBeAdmin(http.HandlerFunc(tasks.GetQueueStats))).Methods("GET", "HEAD")
+	authenticatedAPI.Path("/info/scheduler").Handler(mustBeAdmin(http.HandlerFunc(tasks.GetSchedulerState))).Methods("GET", "HEAD")
+	authenticatedAPI.Path("/info/scheduler").Handler(mustBeAdmin(http.HandlerFunc(tasks.SetSchedulerPaused))).Methods("POST")
 	authenticatedAPI.Path("/upgrade").HandlerFunc(checkUpgrade).Methods("GET", "HEAD")
 	authenticatedAPI.Path("/upgrade").HandlerFunc(doUpgrade).Methods("POST")
 
@@ -87,6 +117,12 @@ func Route() *mux.Router {
 	authenticatedAPI.Path("/users").HandlerFunc(getUsers).Methods("GET", "HEAD")
 	authenticatedAPI.Path("/users").HandlerFunc(addUser).Methods("POST")
 
+	sessionAPI := authenticatedAPI.PathPrefix("/sessions").Subrouter()
+	sessionAPI.Use(mustBeAdmin)
+
+	sessionAPI.Path("/").HandlerFunc(getSessions).Methods("GET", "HEAD")
+	sessionAPI.Path("/{session_id}").HandlerFunc(revokeSession).Methods("DELETE")
+
 	tokenAPI := authenticatedAPI.PathPrefix("/user").Subrouter()
 
 	tokenAPI.Path("/").HandlerFunc(getUser).Methods("GET", "HEAD")
@@ -101,6 +137,7 @@ func Route() *mux.Router {
 	userAPI.Path("/").HandlerFunc(updateUser).Methods("PUT")
 	userAPI.Path("/").HandlerFunc(deleteUser).Methods("DELETE")
 	userAPI.Path("/password").HandlerFunc(updateUserPassword).Methods("POST")
+	userAPI.Path("/sessions").Handler(mustBeAdmin(http.HandlerFunc(revokeUserSessions))).Methods("DELETE")
 
 	projectUserAPI := authenticatedAPI.PathPrefix("/project/{project_id}").Subrouter()
 	projectUserAPI.Use(projects.ProjectMiddleware)
@@ -126,24 +163,39 @@ func Route() *mux.Router {
 	projectUserAPI.Path("/tasks").HandlerFunc(tasks.GetAllTasks).Methods("GET", "HEAD")
 	projectUserAPI.HandleFunc("/tasks/last", tasks.GetLastTasks).Methods("GET", "HEAD")
 	projectUserAPI.Path("/tasks").HandlerFunc(tasks.AddTask).Methods("POST")
+	projectUserAPI.Path("/tasks/delete").HandlerFunc(tasks.RemoveTasks).Methods("POST")
+	projectUserAPI.Path("/tasks/schema").HandlerFunc(tasks.GetTaskSchema).Methods("GET", "HEAD")
+	projectUserAPI.Path("/tasks/preview").HandlerFunc(tasks.PreviewTask).Methods("POST")
 
 	projectUserAPI.Path("/templates").HandlerFunc(projects.GetTemplates).Methods("GET", "HEAD")
 	projectUserAPI.Path("/templates").HandlerFunc(projects.AddTemplate).Methods("POST")
+	projectUserAPI.Path("/templates/groups").HandlerFunc(projects.GetTemplateGroups).Methods("GET", "HEAD")
+	projectUserAPI.Path("/templates/groups/rename").HandlerFunc(projects.RenameTemplateGroup).Methods("POST")
 
 	projectAdminAPI := authenticatedAPI.PathPrefix("/project/{project_id}").Subrouter()
 	projectAdminAPI.Use(projects.ProjectMiddleware, projects.MustBeAdmin)
 
 	projectAdminAPI.Path("/").HandlerFunc(projects.UpdateProject).Methods("PUT")
 	projectAdminAPI.Path("/").HandlerFunc(projects.DeleteProject).Methods("DELETE")
+	projectAdminAPI.Path("/archive").HandlerFunc(projects.ArchiveProject).Methods("POST")
+	projectAdminAPI.Path("/unarchive").HandlerFunc(projects.UnarchiveProject).Methods("POST")
 	projectAdminAPI.Path("/users").HandlerFunc(projects.AddUser).Methods("POST")
+	projectAdminAPI.Path("/notifications/test").HandlerFunc(tasks.TestNotifications).Methods("POST")
+	projectAdminAPI.Path("/known_hosts").HandlerFunc(projects.AddKnownHost).Methods("POST")
 
 	projectUserManagement := projectAdminAPI.PathPrefix("/users").Subrouter()
 	projectUserManagement.Use(projects.UserMiddleware)
 
+	projectUserManagement.HandleFunc("/{user_id}", projects.GetUser).Methods("GET", "HEAD")
 	projectUserManagement.HandleFunc("/{user_id}/admin", projects.MakeUserAdmin).Methods("POST")
 	projectUserManagement.HandleFunc("/{user_id}/admin", projects.MakeUserAdmin).Methods("DELETE")
 	projectUserManagement.HandleFunc("/{user_id}", projects.RemoveUser).Methods("DELETE")
 
+	projectKeys := projectUserAPI.PathPrefix("/keys").Subrouter()
+	projectKeys.Use(projects.KeyMiddleware)
+
+	projectKeys.HandleFunc("/{key_id}", projects.GetKey).Methods("GET", "HEAD")
+
 	projectKeyManagement := projectAdminAPI.PathPrefix("/keys").Subrouter()
 	projectKeyManagement.Use(projects.KeyMiddleware)
 
@@ -153,26 +205,43 @@ func Route() *mux.Router {
 	projectRepoManagement := projectUserAPI.PathPrefix("/repositories").Subrouter()
 	projectRepoManagement.Use(projects.RepositoryMiddleware)
 
+	projectRepoManagement.HandleFunc("/{repository_id}", projects.GetRepository).Methods("GET", "HEAD")
 	projectRepoManagement.HandleFunc("/{repository_id}", projects.UpdateRepository).Methods("PUT")
 	projectRepoManagement.HandleFunc("/{repository_id}", projects.RemoveRepository).Methods("DELETE")
+	projectRepoManagement.HandleFunc("/{repository_id}/test", projects.TestRepository).Methods("POST")
 
 	projectInventoryManagement := projectUserAPI.PathPrefix("/inventory").Subrouter()
 	projectInventoryManagement.Use(projects.InventoryMiddleware)
 
+	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.GetInventoryItem).Methods("GET", "HEAD")
 	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.UpdateInventory).Methods("PUT")
 	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.RemoveInventory).Methods("DELETE")
 
 	projectEnvManagement := projectUserAPI.PathPrefix("/environment").Subrouter()
 	projectEnvManagement.Use(projects.EnvironmentMiddleware)
 
+	projectEnvManagement.HandleFunc("/{environment_id}", projects.GetEnvironmentItem).Methods("GET", "HEAD")
 	projectEnvManagement.HandleFunc("/{environment_id}", projects.UpdateEnvironment).Methods("PUT")
 	projectEnvManagement.HandleFunc("/{environment_id}", projects.RemoveEnvironment).Methods("DELETE")
 
 	projectTmplManagement := projectUserAPI.PathPrefix("/templates").Subrouter()
 	projectTmplManagement.Use(projects.TemplatesMiddleware)
 
+	projectTmplManagement.HandleFunc("/{template_id}", projects.GetTemplate).Methods("GET", "HEAD")
 	projectTmplManagement.HandleFunc("/{template_id}", projects.UpdateTemplate).Methods("PUT")
 	projectTmplManagement.HandleFunc("/{template_id}", projects.RemoveTemplate).Methods("DELETE")
+	projectTmplManagement.HandleFunc("/{template_id}/schedule", projects.GetTemplateSchedule).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/schedule", projects.UpdateTemplateSchedule).Methods("PUT")
+	projectTmplManagement.HandleFunc("/{template_id}/schedule", projects.RemoveTemplateSchedule).Methods("DELETE")
+	projectTmplManagement.HandleFunc("/{template_id}/tasks/last", tasks.GetTemplateLastTask).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/hook", projects.GetTemplateHook).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/hook", projects.UpdateTemplateHook).Methods("PUT")
+	projectTmplManagement.HandleFunc("/{template_id}/hook", projects.RemoveTemplateHook).Methods("DELETE")
+
+	projectTmplAdmin := projectAdminAPI.PathPrefix("/templates").Subrouter()
+	projectTmplAdmin.Use(projects.TemplatesMiddleware)
+
+	projectTmplAdmin.HandleFunc("/{template_id}/tasks", tasks.RemoveTemplateTasks).Methods("DELETE")
 
 	projectTaskManagement := projectUserAPI.PathPrefix("/tasks").Subrouter()
 	projectTaskManagement.Use(tasks.GetTaskMiddleware)
@@ -180,6 +249,18 @@ func Route() *mux.Router {
 	projectTaskManagement.HandleFunc("/{task_id}/output", tasks.GetTaskOutput).Methods("GET", "HEAD")
 	projectTaskManagement.HandleFunc("/{task_id}", tasks.GetTask).Methods("GET", "HEAD")
 	projectTaskManagement.HandleFunc("/{task_id}", tasks.RemoveTask).Methods("DELETE")
+	projectTaskManagement.HandleFunc("/{task_id}/stop", tasks.StopTask).Methods("POST")
+	projectTaskManagement.HandleFunc("/{task_id}/retry-failed", tasks.RetryFailedTask).Methods("POST")
+	projectTaskManagement.HandleFunc("/{task_id}/comments", tasks.GetTaskComments).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/hosts", tasks.GetTaskHosts).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/artifacts", tasks.GetTaskArtifacts).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/artifacts/{artifact_id}", tasks.DownloadTaskArtifact).Methods("GET", "HEAD")
+
+	projectTaskAdmin := projectAdminAPI.PathPrefix("/tasks").Subrouter()
+	projectTaskAdmin.Use(tasks.GetTaskMiddleware)
+
+	projectTaskAdmin.HandleFunc("/{task_id}", tasks.UpdateTask).Methods("PUT")
+	projectTaskAdmin.HandleFunc("/{task_id}/comments", tasks.AddTaskComment).Methods("POST")
 
 	if os.Getenv("DEBUG") == "1" {
 		defer debugPrintRoutes(r)
@@ -222,15 +303,16 @@ func debugPrintRoutes(r *mux.Router) {
 //nolint: gocyclo
 func servePublic(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
+	webPath := util.WebPath()
 
-	webPath := "/"
-	if util.WebHostURL != nil {
-		webPath = util.WebHostURL.RequestURI()
+	if path == webPath+"api" || strings.HasPrefix(path, webPath+"api/") {
+		apiNotFound(w, r)
+		return
 	}
 
 	if !strings.HasPrefix(path, webPath+"public") {
 		if len(strings.Split(path, ".")) > 1 {
-			w.WriteHeader(http.StatusNotFound)
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgNotFound, nil)
 			return
 		}
 
@@ -247,11 +329,14 @@ func servePublic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// replace base path
+	// replace base path, the frontend derives api and websocket urls from it
 	if util.WebHostURL != nil && path == "/html/index.html" {
+		baseURL := *util.WebHostURL
+		baseURL.Path = webPath
+
 		res = []byte(strings.Replace(string(res),
 			"<base href=\"/\">",
-			"<base href=\""+util.WebHostURL.String()+"\">",
+			"<base href=\""+baseURL.String()+"\">",
 			1))
 	}
 
@@ -284,8 +369,10 @@ func servePublic(w http.ResponseWriter, r *http.Request) {
 
 func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 	body := map[string]interface{}{
-		"version": util.Version,
-		"update":  util.UpdateAvailable,
+		"version":   util.Version,
+		"commit":    util.Commit,
+		"buildDate": util.BuildDate,
+		"update":    util.UpdateAvailable,
 		"config": map[string]string{
 			"dbHost":  util.Config.MySQL.Hostname,
 			"dbName":  util.Config.MySQL.DbName,
@@ -295,6 +382,19 @@ func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	disk, err := tmpDiskUsage()
+	if err != nil {
+		util.WriteError(w, http.StatusInternalServerError, "Can't read the disk usage of "+util.Config.TmpPath+": "+err.Error(), nil)
+		return
+	}
+
+	body["disk"] = disk
+	body["maintenance"] = tasks.GetMaintenance()
+
+	if !util.UpdateChecked.IsZero() {
+		body["updateChecked"] = util.UpdateChecked
+	}
+
 	if util.UpdateAvailable != nil {
 		body["updateBody"] = string(blackfriday.MarkdownCommon([]byte(*util.UpdateAvailable.Body)))
 	}
@@ -302,10 +402,30 @@ func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, http.StatusOK, body)
 }
 
+// tmpDiskUsage reports the space left on the filesystem of the tmp path, which repositories are cloned to
+func tmpDiskUsage() (map[string]interface{}, error) {
+	free, used, err := util.DiskUsage(util.Config.TmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"free":      free,
+		"used":      used,
+		"threshold": uint64(util.Config.TmpFreeWarning) << 20,
+		"low":       free < uint64(util.Config.TmpFreeWarning)<<20,
+	}, nil
+}
+
+// updateCheckMaxAge is how long checkUpgrade reuses the last result of the update check, unless force=1 is passed
+const updateCheckMaxAge = time.Hour
+
 func checkUpgrade(w http.ResponseWriter, r *http.Request) {
-	if err := util.CheckUpdate(util.Version); err != nil {
-		util.WriteJSON(w, 500, err)
-		return
+	if r.URL.Query().Get("force") == "1" || time.Since(util.UpdateChecked) > updateCheckMaxAge {
+		if err := util.CheckUpdate(util.Version); err != nil {
+			util.WriteError(w, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
 	}
 
 	if util.UpdateAvailable != nil {
@@ -319,3 +439,25 @@ func checkUpgrade(w http.ResponseWriter, r *http.Request) {
 func doUpgrade(w http.ResponseWriter, r *http.Request) {
 	util.LogError(util.DoUpgrade(util.Version))
 }
+
+// setMaintenance enables or disables maintenance mode, in which no task is started. Admins only
+func setMaintenance(w http.ResponseWriter, r *http.Request) {
+	user := context.Get(r, "user").(*db.User)
+
+	var body struct {
+		Enabled bool   `json:"enabled"`
+		Message string `json:"message"`
+	}
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	m := tasks.SetMaintenance(body.Enabled, strings.TrimSpace(body.Message))
+	if m.Enabled {
+		log.Warn(user.Username + " enabled maintenance mode: " + m.Message)
+	} else {
+		log.Info(user.Username + " disabled maintenance mode")
+	}
+
+	util.WriteJSON(w, http.StatusOK, m)
+}
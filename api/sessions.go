@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+	"github.com/masterminds/squirrel"
+)
+
+// sessionLifetime is how long an unused session stays valid
+const sessionLifetime = 7 * 24 * time.Hour
+
+// getSessions returns the active sessions of all users, or of one user with ?user_id=
+func getSessions(w http.ResponseWriter, r *http.Request) {
+	q := squirrel.Select("s.*, u.username, u.name").
+		From("session as s").
+		Join("user as u on u.id=s.user_id").
+		Where("s.expired=0").
+		Where("s.last_active > ?", time.Now().UTC().Add(-sessionLifetime)).
+		OrderBy("s.last_active desc")
+
+	if userID := r.URL.Query().Get("user_id"); len(userID) > 0 {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidParam, nil, "user_id")
+			return
+		}
+		q = q.Where("s.user_id=?", id)
+	}
+
+	query, args, err := q.ToSql()
+	util.LogWarning(err)
+
+	sessions := []struct {
+		db.Session
+		Username string `db:"username" json:"username"`
+		Name     string `db:"name" json:"name"`
+	}{}
+	if _, err := db.Mysql.Select(&sessions, query, args...); err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, sessions)
+}
+
+// revokeSession expires a session, the authentication middleware rejects it from the next request on
+func revokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := util.GetIntParam("session_id", w, r)
+	if err != nil {
+		return
+	}
+
+	res, err := db.Mysql.Exec("update session set expired=1 where id=? and expired=0", sessionID)
+	if err != nil {
+		panic(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+
+	if affected == 0 {
+		util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgSessionNotFound, nil)
+		return
+	}
+
+	logSessionsRevoked(r, "Session "+strconv.Itoa(sessionID)+" revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeUserSessions expires all sessions of a user
+func revokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	user := context.Get(r, "_user").(db.User)
+
+	if _, err := db.Mysql.Exec("update session set expired=1 where user_id=? and expired=0", user.ID); err != nil {
+		panic(err)
+	}
+
+	logSessionsRevoked(r, "Sessions of user "+user.Username+" revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func logSessionsRevoked(r *http.Request, desc string) {
+	editor := context.Get(r, "user").(*db.User)
+	log.Info(desc + " by " + editor.Username)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minSetupPasswordLength is the shortest password the first admin can have
+const minSetupPasswordLength = 8
+
+// setupLock serializes the setup requests of this instance. The admin is only inserted while the user
+// table is empty, so instances sharing the database can't both create one either
+var setupLock sync.Mutex
+
+// isSetupRequired reports whether no user exists yet
+func isSetupRequired() (bool, error) {
+	count, err := db.Mysql.SelectInt("select count(1) from user")
+	return count == 0, err
+}
+
+// getSetup tells whether the first admin of the install still has to be created
+func getSetup(w http.ResponseWriter, r *http.Request) {
+	required, err := isSetupRequired()
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"required": required,
+	})
+}
+
+// setup creates the first admin of a fresh install, it is disabled once any user exists
+func setup(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name     string `json:"name"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	if required, err := isSetupRequired(); err != nil {
+		panic(err)
+	} else if !required {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgAlreadySetUp, nil)
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	body.Username = strings.TrimSpace(body.Username)
+	body.Email = strings.TrimSpace(body.Email)
+	if len(body.Name) == 0 || len(body.Username) == 0 || len(body.Email) == 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgSetupFieldsRequired, nil)
+		return
+	}
+
+	if len(body.Password) < minSetupPasswordLength {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgPasswordTooShort, nil, minSetupPasswordLength)
+		return
+	}
+
+	password, err := bcrypt.GenerateFromPassword([]byte(body.Password), 11)
+	if err != nil {
+		panic(err)
+	}
+
+	setupLock.Lock()
+	defer setupLock.Unlock()
+
+	user := db.User{
+		Created:  db.GetParsedTime(time.Now()),
+		Name:     body.Name,
+		Username: body.Username,
+		Email:    body.Email,
+		Admin:    true,
+	}
+
+	res, err := db.Mysql.Exec("insert into user (name, username, email, password, admin, created) "+
+		"select ?, ?, ?, ?, 1, ? from dual where not exists (select 1 from user)",
+		user.Name, user.Username, user.Email, string(password), user.Created)
+	if err != nil {
+		// 1213 is a deadlock, the concurrent setup of another instance won
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1213 {
+			util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgAlreadySetUp, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	if inserted, err := res.RowsAffected(); err != nil {
+		panic(err)
+	} else if inserted == 0 {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgAlreadySetUp, nil)
+		return
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		panic(err)
+	}
+	user.ID = int(id)
+
+	log.Info(user.Username + " was created as the first admin")
+	util.WriteCreated(w, "users/"+strconv.Itoa(user.ID)+"/", user)
+}
@@ -3,6 +3,8 @@ package sockets
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/fiftin/semaphore/db"
@@ -15,9 +17,38 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin accepts the websocket upgrade from the origin of web_host, or of the request host when it isn't set,
+// and from the configured websocket_origins. Requests without an origin don't come from a browser
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if util.WebHostURL != nil {
+		if strings.EqualFold(originURL.Scheme, util.WebHostURL.Scheme) && strings.EqualFold(originURL.Host, util.WebHostURL.Host) {
+			return true
+		}
+	} else if strings.EqualFold(originURL.Host, r.Host) {
 		return true
-	},
+	}
+
+	for _, allowed := range util.Config.WebsocketOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), originURL.Scheme+"://"+originURL.Host) {
+			return true
+		}
+	}
+
+	log.Warn("Rejected websocket connection from origin " + origin)
+	return false
 }
 
 const (
@@ -38,6 +69,8 @@ type connection struct {
 	ws     *websocket.Conn
 	send   chan []byte
 	userID int
+	// output missed by a reconnecting client, written before the messages of the hub
+	replay []byte
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -82,6 +115,13 @@ func (c *connection) writePump() {
 		util.LogError(c.ws.Close())
 	}()
 
+	if c.replay != nil {
+		if err := c.write(websocket.TextMessage, c.replay); err != nil {
+			util.LogError(err)
+			return
+		}
+	}
+
 	for {
 		select {
 		case message, ok := <-c.send:
@@ -116,8 +156,16 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		userID: user.ID,
 	}
 
+	// registered before the replay is loaded, so no line falls between the two. Lines
+	// may arrive both ways then, clients drop the ones with a seq they have seen
 	h.register <- c
 
+	if replay, err := getReplay(r, user.ID); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot replay task output"})
+	} else {
+		c.replay = replay
+	}
+
 	go c.writePump()
 	c.readPump()
 }
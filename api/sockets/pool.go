@@ -1,5 +1,7 @@
 package sockets
 
+import "time"
+
 // hub maintains the set of active connections and broadcasts messages to the
 // connections.
 type hub struct {
@@ -34,12 +36,15 @@ func (h *hub) run() {
 		select {
 		case c := <-h.register:
 			h.connections[c] = true
+			connected(c.userID)
 		case c := <-h.unregister:
 			if _, ok := h.connections[c]; ok {
 				delete(h.connections, c)
 				close(c.send)
+				disconnected(c.userID, false)
 			}
 		case m := <-h.broadcast:
+			delivered := 0
 			for c := range h.connections {
 				if m.userID > 0 && m.userID != c.userID {
 					continue
@@ -47,11 +52,14 @@ func (h *hub) run() {
 
 				select {
 				case c.send <- m.msg:
+					delivered++
 				default:
 					close(c.send)
 					delete(h.connections, c)
+					disconnected(c.userID, true)
 				}
 			}
+			broadcasted(time.Now(), delivered)
 		}
 	}
 }
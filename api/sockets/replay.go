@@ -0,0 +1,95 @@
+package sockets
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// UnstoredOutput returns the output lines of a task after a sequence number which are still being inserted,
+// the tasks package sets it. Replays include them, since a line broadcast before a client reconnected may not be stored yet
+var UnstoredOutput = func(taskID int, seq int64) []db.TaskOutput {
+	return nil
+}
+
+// maxReplayLines limits the output replayed to a reconnecting client, clients which missed
+// more are told to reload the output of the task
+const maxReplayLines = 5000
+
+// getReplay returns the frame of task output stored after the last_seq query parameter for the task_id
+// query parameter, nil when the client didn't ask for a replay or can't see the task
+func getReplay(r *http.Request, userID int) ([]byte, error) {
+	taskID, err := strconv.Atoi(r.URL.Query().Get("task_id"))
+	if err != nil {
+		return nil, nil
+	}
+
+	lastSeq, err := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	projectID, err := db.Mysql.SelectInt("select pt.project_id from task t "+
+		"join project__template pt on pt.id=t.template_id "+
+		"join project__user pu on pu.project_id=pt.project_id "+
+		"where t.id=? and pu.user_id=?", taskID, userID)
+	if err == sql.ErrNoRows || projectID == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// read before the stored lines, a line whose insert finishes in between is found by the query
+	unstored := UnstoredOutput(taskID, lastSeq)
+
+	var lines []db.TaskOutput
+	if _, err := db.Mysql.Select(&lines, "select task_id, task, time, output, diff, stream, seq from task__output "+
+		"where task_id=? and seq>? order by seq asc limit ?", taskID, lastSeq, maxReplayLines+1); err != nil {
+		return nil, err
+	}
+
+	lines = mergeOutput(lines, unstored)
+
+	truncated := len(lines) > maxReplayLines
+	if truncated {
+		lines = lines[:maxReplayLines]
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"type":       "log",
+		"replay":     true,
+		"truncated":  truncated,
+		"lines":      lines,
+		"task_id":    taskID,
+		"project_id": projectID,
+	})
+}
+
+// mergeOutput adds the unstored lines to the stored ones, the lines are ordered by seq and appear once
+func mergeOutput(stored []db.TaskOutput, unstored []db.TaskOutput) []db.TaskOutput {
+	if len(unstored) == 0 {
+		return stored
+	}
+
+	seen := make(map[int64]bool)
+	for _, line := range stored {
+		seen[line.Seq] = true
+	}
+
+	for _, line := range unstored {
+		if !seen[line.Seq] {
+			seen[line.Seq] = true
+			stored = append(stored, line)
+		}
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].Seq < stored[j].Seq
+	})
+
+	return stored
+}
@@ -0,0 +1,96 @@
+package sockets
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is the number of seconds the broadcast rate is averaged over
+const rateWindow = 60
+
+// Stats describes the websocket connections and the messages broadcast to them
+type Stats struct {
+	Connections int `json:"connections"`
+	// distinct users with at least one connection
+	Users int `json:"users"`
+	// messages broadcast since the start and copies of them sent to connections,
+	// a message of a task goes to every connection of the users of its project
+	Broadcasts uint64 `json:"broadcasts"`
+	Delivered  uint64 `json:"delivered"`
+	// connections closed because their send buffer was full, the client was too slow to keep up
+	Dropped uint64 `json:"dropped"`
+	// messages broadcast per second over the last minute
+	BroadcastRate float64 `json:"broadcast_rate"`
+}
+
+// activity counts connections and messages, it is updated by the hub and read by the api
+var activity = struct {
+	lock  sync.Mutex
+	stats Stats
+	users map[int]int
+	// broadcasts per second of the last rateWindow seconds, indexed by the unix time modulo rateWindow
+	seconds [rateWindow]int
+	stamps  [rateWindow]int64
+}{
+	users: make(map[int]int),
+}
+
+// connected counts a connection of the user
+func connected(userID int) {
+	activity.lock.Lock()
+	defer activity.lock.Unlock()
+
+	activity.stats.Connections++
+	activity.users[userID]++
+}
+
+// disconnected counts a connection of the user going away, dropped when the hub closed it because it was too slow
+func disconnected(userID int, dropped bool) {
+	activity.lock.Lock()
+	defer activity.lock.Unlock()
+
+	activity.stats.Connections--
+	if activity.users[userID]--; activity.users[userID] <= 0 {
+		delete(activity.users, userID)
+	}
+
+	if dropped {
+		activity.stats.Dropped++
+	}
+}
+
+// broadcasted counts a message sent to the given number of connections
+func broadcasted(now time.Time, delivered int) {
+	activity.lock.Lock()
+	defer activity.lock.Unlock()
+
+	activity.stats.Broadcasts++
+	activity.stats.Delivered += uint64(delivered)
+
+	second := now.Unix()
+	i := second % rateWindow
+	if activity.stamps[i] != second {
+		activity.stamps[i] = second
+		activity.seconds[i] = 0
+	}
+	activity.seconds[i]++
+}
+
+// GetStats returns the websocket Stats at now
+func GetStats(now time.Time) Stats {
+	activity.lock.Lock()
+	defer activity.lock.Unlock()
+
+	stats := activity.stats
+	stats.Users = len(activity.users)
+
+	count := 0
+	for i, stamp := range activity.stamps {
+		if now.Unix()-stamp < rateWindow {
+			count += activity.seconds[i]
+		}
+	}
+	stats.BroadcastRate = float64(count) / rateWindow
+
+	return stats
+}
@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"bytes"
+	"errors"
 	"html/template"
 	"net/http"
 	"strconv"
@@ -10,12 +11,10 @@ import (
 	"github.com/fiftin/semaphore/util"
 )
 
-const emailTemplate = `Subject: Task '{{ .Alias }}' failed
-
-Task {{ .TaskID }} with template '{{ .Alias }}' has failed!
-Task log: <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`
-
-const telegramTemplate = `{"chat_id": "{{ .ChatID }}","text":"<b>Task {{ .TaskID }} with template '{{ .Alias }}' has failed!</b>\nTask log: <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>","parse_mode":"HTML"}`
+// telegramTemplate wraps the localized alert text, which is a template itself, in the request body
+func telegramTemplate() string {
+	return `{"chat_id": "{{ .ChatID }}","text":"` + util.Localize(util.ConfigLanguage(), util.MsgAlertTelegram) + `","parse_mode":"HTML"}`
+}
 
 // Alert represents an alert that will be templated and sent to the appropriate service
 type Alert struct {
@@ -23,6 +22,7 @@ type Alert struct {
 	Alias   string
 	TaskURL string
 	ChatID  string
+	Status  string
 }
 
 func (t *task) sendMailAlert() {
@@ -39,7 +39,7 @@ func (t *task) sendMailAlert() {
 		TaskURL: util.Config.WebHost + "/project/" + strconv.Itoa(t.template.ProjectID),
 	}
 	tpl := template.New("mail body template")
-	tpl, err := tpl.Parse(emailTemplate)
+	tpl, err := tpl.Parse(util.Localize(util.ConfigLanguage(), util.MsgAlertEmail))
 	util.LogError(err)
 
 	t.panicOnError(tpl.Execute(&mailBuffer, alert), "Can't generate alert template!")
@@ -68,23 +68,38 @@ func (t *task) sendTelegramAlert() {
 		chatID = t.alertChat
 	}
 
-	var telegramBuffer bytes.Buffer
 	alert := Alert{
 		TaskID:  strconv.Itoa(t.task.ID),
 		Alias:   t.template.Alias,
 		TaskURL: util.Config.WebHost + "/project/" + strconv.Itoa(t.template.ProjectID),
 		ChatID:  chatID,
 	}
+
+	if err := postTelegramAlert(alert); err != nil {
+		t.log("Can't send telegram alert! " + err.Error())
+	}
+}
+
+// postTelegramAlert sends the alert to its telegram chat with the bot of the config
+func postTelegramAlert(alert Alert) error {
+	var telegramBuffer bytes.Buffer
 	tpl := template.New("telegram body template")
-	tpl, err := tpl.Parse(telegramTemplate)
+	tpl, err := tpl.Parse(telegramTemplate())
 	util.LogError(err)
 
-	t.panicOnError(tpl.Execute(&telegramBuffer, alert),"Can't generate alert template!")
+	if err := tpl.Execute(&telegramBuffer, alert); err != nil {
+		return err
+	}
 
 	resp, err := http.Post("https://api.telegram.org/bot"+util.Config.TelegramToken+"/sendMessage", "application/json", &telegramBuffer)
-	t.panicOnError(err, "Can't send telegram alert!")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
 
 	if resp.StatusCode != 200 {
-		t.log("Can't send telegram alert! Response code not 200!")
+		return errors.New("Response code " + strconv.Itoa(resp.StatusCode) + " not 200!")
 	}
+
+	return nil
 }
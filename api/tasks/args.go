@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// checkTaskArguments checks the extra cli arguments of a task against the flags allowed by its template.
+// A flag allowed with a trailing = takes a value, given as --flag=value or as the next argument
+func checkTaskArguments(allowed []string, args []string) error {
+	takesValue := make(map[string]bool)
+	for _, flag := range allowed {
+		takesValue[strings.TrimSuffix(flag, "=")] = strings.HasSuffix(flag, "=")
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return errors.New("Argument " + arg + " is not a flag allowed by the template")
+		}
+
+		split := strings.SplitN(arg, "=", 2)
+		value, ok := takesValue[split[0]]
+		switch {
+		case !ok:
+			return errors.New("Flag " + split[0] + " is not allowed by the template")
+		case len(split) == 2 && !value:
+			return errors.New("Flag " + split[0] + " doesn't take a value")
+		case len(split) == 1 && value:
+			if i+1 == len(args) {
+				return errors.New("Flag " + split[0] + " needs a value")
+			}
+			i++
+		}
+	}
+
+	return nil
+}
+
+// applyArguments stores the args array of the task in its arguments and checks them against the flags
+// allowed by the template. It writes a bad request response if they are invalid
+func applyArguments(w http.ResponseWriter, r *http.Request, template db.Template, taskObj *db.Task) bool {
+	if taskObj.Arguments != nil && strings.TrimSpace(*taskObj.Arguments) == "" {
+		taskObj.Arguments = nil
+	}
+
+	if len(taskObj.Args) > 0 {
+		if taskObj.Arguments != nil {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgArgsAndArguments, nil)
+			return false
+		}
+
+		js, err := json.Marshal(taskObj.Args)
+		util.LogPanic(err)
+		arguments := string(js)
+		taskObj.Arguments = &arguments
+	}
+
+	allowed, err := db.ParseAllowedArgs(template.AllowedArgs)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := checkAllowedArguments(allowed, taskObj.Arguments); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), map[string]interface{}{
+			"allowed_args": allowed,
+		})
+		return false
+	}
+
+	return true
+}
+
+// checkAllowedArguments checks the arguments of a task, a JSON array of strings, against the flags allowed
+// by its template. Tasks which copy the arguments of another one check them again, the allowed flags may have changed
+func checkAllowedArguments(allowed []string, arguments *string) error {
+	if allowed == nil || arguments == nil {
+		return nil
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(*arguments), &args); err != nil {
+		return errors.New("Arguments must be a JSON array of strings")
+	}
+
+	return checkTaskArguments(allowed, args)
+}
@@ -0,0 +1,48 @@
+package tasks
+
+import "testing"
+
+func TestCheckTaskArguments(t *testing.T) {
+	allowed := []string{"--check", "--diff", "--tags=", "-e="}
+
+	for _, args := range [][]string{
+		{},
+		{"--check", "--diff"},
+		{"--tags=web,db"},
+		{"--tags", "web", "--check"},
+		{"-e", "version=1.2"},
+	} {
+		if err := checkTaskArguments(allowed, args); err != nil {
+			t.Errorf("%v must be allowed: %v", args, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--become"},
+		{"--check", "other.yml"},
+		{"--check=yes"},
+		{"--tags"},
+		{"-i", "hosts"},
+		{"--check-mode"},
+	} {
+		if err := checkTaskArguments(allowed, args); err == nil {
+			t.Errorf("%v must be rejected", args)
+		}
+	}
+}
+
+func TestCheckAllowedArguments(t *testing.T) {
+	arguments := `["--check", "--tags", "web"]`
+	if err := checkAllowedArguments(nil, &arguments); err != nil {
+		t.Errorf("templates without allowed_args accept any arguments, got %v", err)
+	}
+
+	if err := checkAllowedArguments([]string{"--check"}, &arguments); err == nil {
+		t.Error("arguments of a retried task must be checked against the current allowed_args")
+	}
+
+	invalid := `--check`
+	if err := checkAllowedArguments([]string{"--check"}, &invalid); err == nil {
+		t.Error("arguments which aren't a JSON array must be rejected")
+	}
+}
@@ -0,0 +1,153 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// collectArtifacts stores the files matching the template artifact paths and removes them from the
+// working directory afterwards, so they don't show up in the next run. Files which would exceed
+// max_artifacts_size are skipped
+func (t *task) collectArtifacts() {
+	paths, err := db.ParseArtifacts(t.template.Artifacts)
+	if err != nil || len(paths) == 0 {
+		return
+	}
+
+	dir, err := t.getPlaybookDir()
+	if err != nil {
+		return
+	}
+
+	// the working directory may be a symlink, artifacts are compared with its real path
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.log("Can't collect artifacts: " + err.Error())
+		return
+	}
+
+	remaining := util.Config.MaxArtifactsSize
+	collected := make(map[string]bool)
+
+	for _, pattern := range paths {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+
+		for _, match := range matches {
+			name, err := filepath.Rel(dir, match)
+			if err != nil || collected[name] {
+				continue
+			}
+			collected[name] = true
+
+			size, err := t.collectArtifact(realDir, match, name, remaining)
+			if err != nil {
+				t.log("Artifact " + name + " not collected: " + err.Error())
+				continue
+			}
+
+			remaining -= size
+			t.log("Artifact " + name + " collected (" + strconv.Itoa(size) + " bytes)")
+			util.LogWarning(os.Remove(match))
+		}
+	}
+}
+
+func (t *task) collectArtifact(realDir string, path string, name string, maxSize int) (int, error) {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, err
+	}
+
+	// a symlink in the repository must not expose files outside of it
+	if !strings.HasPrefix(realPath, realDir+string(filepath.Separator)) {
+		return 0, errors.New("it is outside of the working directory")
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return 0, errors.New("it is not a file")
+	}
+
+	if info.Size() > int64(maxSize) {
+		return 0, errors.New("the artifacts of the task would exceed " + strconv.Itoa(util.Config.MaxArtifactsSize) + " bytes")
+	}
+
+	content, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(content) > maxSize {
+		return 0, errors.New("the artifacts of the task would exceed " + strconv.Itoa(util.Config.MaxArtifactsSize) + " bytes")
+	}
+
+	artifact := db.TaskArtifact{
+		TaskID:  t.task.ID,
+		Name:    filepath.ToSlash(name),
+		Size:    len(content),
+		Content: content,
+		Created: db.GetParsedTime(time.Now()),
+	}
+
+	if err := db.Mysql.Insert(&artifact); err != nil {
+		return 0, err
+	}
+
+	return artifact.Size, nil
+}
+
+// GetTaskArtifacts returns the artifacts collected from a task without their content
+func GetTaskArtifacts(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	artifacts := []db.TaskArtifact{}
+	if _, err := db.Mysql.Select(&artifacts, "select id, task_id, name, size, created from task__artifact where task_id=? order by name", task.ID); err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, artifacts)
+}
+
+// DownloadTaskArtifact writes the content of an artifact of a task
+func DownloadTaskArtifact(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	artifactID, err := util.GetIntParam("artifact_id", w, r)
+	if err != nil {
+		return
+	}
+
+	var artifact db.TaskArtifact
+	if err := db.Mysql.SelectOne(&artifact, "select * from task__artifact where task_id=? and id=?", task.ID, artifactID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgArtifactNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	w.Header().Set("content-type", "application/octet-stream")
+	w.Header().Set("content-disposition", "attachment; filename=\""+strings.Replace(filepath.Base(artifact.Name), "\"", "", -1)+"\"")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(artifact.Content)
+	util.LogWarning(err)
+}
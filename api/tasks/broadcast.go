@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/fiftin/semaphore/api/sockets"
+	"github.com/fiftin/semaphore/util"
+)
+
+// outputLine is a line of task output in a batched websocket frame
+type outputLine struct {
+	Output string    `json:"output"`
+	Diff   bool      `json:"diff"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+	// position of the line in the output of the task, reconnecting clients pass the last one they saw
+	Seq int64 `json:"seq"`
+}
+
+// outputBuffer collects the output lines of a task which are broadcast together
+type outputBuffer struct {
+	lock  sync.Mutex
+	lines []outputLine
+	timer *time.Timer
+}
+
+// broadcastOutput sends a line of output to the project users. With output_flush_interval set,
+// lines are buffered and sent in a single frame when the interval has passed
+func (t *task) broadcastOutput(line outputLine) {
+	if util.Config.OutputFlushInterval <= 0 {
+		t.sendToUsers(map[string]interface{}{
+			"type":       "log",
+			"output":     line.Output,
+			"diff":       line.Diff,
+			"stream":     line.Stream,
+			"time":       line.Time,
+			"seq":        line.Seq,
+			"task_id":    t.task.ID,
+			"project_id": t.projectID,
+		})
+		return
+	}
+
+	t.output.lock.Lock()
+	defer t.output.lock.Unlock()
+
+	t.output.lines = append(t.output.lines, line)
+	if t.output.timer == nil {
+		interval := time.Duration(util.Config.OutputFlushInterval) * time.Millisecond
+		t.output.timer = time.AfterFunc(interval, t.flushOutput)
+	}
+}
+
+// flushOutput sends the buffered output lines right away, it is called before status updates
+// so that clients receive all output of a task before it finishes
+func (t *task) flushOutput() {
+	t.output.lock.Lock()
+	defer t.output.lock.Unlock()
+
+	if t.output.timer != nil {
+		t.output.timer.Stop()
+		t.output.timer = nil
+	}
+
+	if len(t.output.lines) == 0 {
+		return
+	}
+
+	t.sendToUsers(map[string]interface{}{
+		"type":       "log",
+		"lines":      t.output.lines,
+		"task_id":    t.task.ID,
+		"project_id": t.projectID,
+	})
+	t.output.lines = nil
+}
+
+func (t *task) sendToUsers(msg map[string]interface{}) {
+	b, err := json.Marshal(msg)
+	util.LogPanic(err)
+
+	for _, user := range t.users {
+		sockets.Message(user, b)
+	}
+}
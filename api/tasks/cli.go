@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// RunTask queues a task of the template the way the api and the scheduler do, writes its output to out
+// and waits for it to finish, stopping it when interrupt fires. It returns the final status of the task.
+// The runner must have been started, it only limits the tasks of this process
+func RunTask(projectID int, templateID int, out io.Writer, interrupt <-chan os.Signal) (string, error) {
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", projectID, templateID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("template not found")
+		}
+
+		return "", err
+	}
+
+	archived, err := db.Mysql.SelectInt("select archived from project where id=?", projectID)
+	if err != nil {
+		return "", err
+	}
+
+	if archived != 0 {
+		return "", errors.New("project is archived")
+	}
+
+	if _, err := checkRequiredTemplate(template); err != nil {
+		return "", err
+	}
+
+	if window, err := checkRunWindow(template, time.Now()); err != nil {
+		return "", err
+	} else if window != nil {
+		return "", errors.New("template can only be run within its run window")
+	}
+
+	taskObj := db.Task{
+		TemplateID: template.ID,
+		Status:     taskWaitingStatus,
+		Initiator:  db.TaskCLIInitiator,
+		Created:    time.Now(),
+		Forks:      effectiveForks(template, nil),
+	}
+
+	if taskObj.Survey, err = surveyDefaults(template); err != nil {
+		return "", err
+	}
+
+	if err := db.Mysql.Insert(&taskObj); err != nil {
+		return "", err
+	}
+
+	taskObj.Labels = []string{}
+	t := &task{
+		task:      taskObj,
+		projectID: projectID,
+		stdout:    out,
+		finished:  make(chan struct{}),
+	}
+	enqueue(t)
+
+	for {
+		select {
+		case <-interrupt:
+			t.stop()
+		case <-t.finished:
+			return db.Mysql.SelectStr("select status from task where id=?", taskObj.ID)
+		}
+	}
+}
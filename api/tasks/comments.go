@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// maxTaskCommentLength is the longest comment which can be added to a task
+const maxTaskCommentLength = 10000
+
+// getTaskComments returns the comments of a task, oldest first
+func getTaskComments(taskID int) ([]db.TaskComment, error) {
+	comments := []db.TaskComment{}
+	_, err := db.Mysql.Select(&comments, "select c.*, u.name as user_name from task__comment as c left join user as u on u.id=c.user_id where c.task_id=? order by c.created, c.id", taskID)
+	return comments, err
+}
+
+// insertTaskComment adds a comment of the user to a task
+func insertTaskComment(taskID int, user *db.User, text string) (db.TaskComment, error) {
+	comment := db.TaskComment{
+		TaskID:   taskID,
+		UserID:   &user.ID,
+		Comment:  text,
+		Created:  db.GetParsedTime(time.Now()),
+		UserName: &user.Name,
+	}
+
+	res, err := db.Mysql.Exec("insert into task__comment set task_id=?, user_id=?, comment=?, created=?", taskID, user.ID, text, comment.Created)
+	if err != nil {
+		return comment, err
+	}
+
+	insertID, err := res.LastInsertId()
+	util.LogWarning(err)
+	comment.ID = int(insertID)
+
+	return comment, nil
+}
+
+// GetTaskComments returns the comments added to a task
+func GetTaskComments(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	comments, err := getTaskComments(task.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, comments)
+}
+
+// AddTaskComment adds a comment to a finished task, to explain afterwards what the run was about
+func AddTaskComment(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	var comment struct {
+		Comment string `json:"comment" binding:"required"`
+	}
+	if err := util.Bind(w, r, &comment); err != nil {
+		return
+	}
+
+	text := strings.TrimSpace(comment.Comment)
+	if len(text) == 0 || len(text) > maxTaskCommentLength {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCommentLength, nil, maxTaskCommentLength)
+		return
+	}
+
+	if task.Status == taskWaitingStatus || task.Status == taskRunningStatus {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgCommentUnfinishedTask, nil)
+		return
+	}
+
+	inserted, err := insertTaskComment(task.ID, user, text)
+	if err != nil {
+		panic(err)
+	}
+
+	objType := taskTypeID
+	desc := "Task ID " + strconv.Itoa(task.ID) + " commented by " + user.Username
+	if err := (db.Event{
+		ProjectID:   &project.ID,
+		ObjectType:  &objType,
+		ObjectID:    &task.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/tasks/"+strconv.Itoa(task.ID)+"/comments", inserted)
+}
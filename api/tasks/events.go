@@ -0,0 +1,445 @@
+package tasks
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// eventsCallbackName is the name of the ansible callback plugin which writes the events of the run
+const eventsCallbackName = "semaphore_events"
+
+// eventsCallbackPlugin writes a json object per line to the file in SEMAPHORE_EVENTS_FILE
+// for the start of plays and tasks, the result of a task on a host and the recap of the run
+const eventsCallbackPlugin = `from __future__ import (absolute_import, division, print_function)
+__metaclass__ = type
+
+import json
+import os
+
+from ansible.playbook.block import Block
+from ansible.plugins.callback import CallbackBase
+
+
+class CallbackModule(CallbackBase):
+    CALLBACK_VERSION = 2.0
+    CALLBACK_TYPE = 'aggregate'
+    CALLBACK_NAME = 'semaphore_events'
+    CALLBACK_NEEDS_WHITELIST = True
+    CALLBACK_NEEDS_ENABLED = True
+
+    def __init__(self):
+        super(CallbackModule, self).__init__()
+        self._path = os.environ.get('SEMAPHORE_EVENTS_FILE')
+
+    def _emit(self, event, **fields):
+        if not self._path:
+            return
+        fields['event'] = event
+        with open(self._path, 'a') as f:
+            f.write(json.dumps(fields) + '\n')
+
+    def _count_tasks(self, blocks):
+        count = 0
+        for block in blocks:
+            for task in block.block + block.always:
+                if isinstance(task, Block):
+                    count += self._count_tasks([task])
+                elif task.action != 'meta':
+                    count += 1
+        return count
+
+    def v2_playbook_on_play_start(self, play):
+        try:
+            tasks = self._count_tasks(play.compile())
+        except Exception:
+            tasks = 0
+        self._emit('play_start', name=play.get_name(), tasks=tasks)
+
+    def v2_playbook_on_task_start(self, task, is_conditional):
+        self._emit('task_start', name=task.get_name())
+
+    def _runner(self, result, status):
+        self._emit('runner', host=result._host.get_name(), status=status)
+
+    def v2_runner_on_ok(self, result):
+        self._runner(result, 'changed' if result._result.get('changed') else 'ok')
+
+    def v2_runner_on_failed(self, result, ignore_errors=False):
+        self._runner(result, 'ignored' if ignore_errors else 'failed')
+
+    def v2_runner_on_skipped(self, result):
+        self._runner(result, 'skipped')
+
+    def v2_runner_on_unreachable(self, result):
+        self._runner(result, 'unreachable')
+
+    def v2_playbook_on_stats(self, stats):
+        hosts = {}
+        for host in stats.processed.keys():
+            hosts[host] = stats.summarize(host)
+        self._emit('stats', hosts=hosts)
+`
+
+// eventsPollInterval is how often the events file is read for new events while the playbook runs
+const eventsPollInterval = time.Second
+
+// playbookEvent is a line of the events file
+type playbookEvent struct {
+	Event string `json:"event"`
+	// number of tasks of the started play
+	Tasks int `json:"tasks"`
+	// host and result of a task on it
+	Host   string `json:"host"`
+	Status string `json:"status"`
+	// recap of the run by host
+	Hosts map[string]struct {
+		OK          int `json:"ok"`
+		Changed     int `json:"changed"`
+		Failures    int `json:"failures"`
+		Unreachable int `json:"unreachable"`
+		Skipped     int `json:"skipped"`
+		Rescued     int `json:"rescued"`
+		Ignored     int `json:"ignored"`
+	} `json:"hosts"`
+}
+
+// taskProgress follows the tasks completed and the results by host of a run. It is fed by the events of
+// the callback plugin, and by the output of the playbook as long as the plugin didn't report any event
+type taskProgress struct {
+	lock sync.Mutex
+	// whether the callback plugin reported events, the output isn't parsed anymore then
+	structured bool
+	tasksDone  int
+	// tasks of the started plays, 0 when unknown
+	tasksTotal int
+	// whether a task was started and isn't completed yet
+	taskRunning bool
+	// whether the output is in the play recap
+	inRecap bool
+	hosts   map[string]*db.TaskHost
+}
+
+func (p *taskProgress) host(name string) *db.TaskHost {
+	if p.hosts == nil {
+		p.hosts = make(map[string]*db.TaskHost)
+	}
+
+	host, ok := p.hosts[name]
+	if !ok {
+		host = &db.TaskHost{Host: name}
+		p.hosts[name] = host
+	}
+
+	return host
+}
+
+// completeTask counts the running task as completed
+func (p *taskProgress) completeTask() {
+	if p.taskRunning {
+		p.tasksDone++
+		p.taskRunning = false
+	}
+}
+
+func (p *taskProgress) startTask() {
+	p.completeTask()
+	p.taskRunning = true
+}
+
+// applyEvent updates the progress with a line of the events file, invalid lines are ignored
+func (p *taskProgress) applyEvent(line string) {
+	var event playbookEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.structured {
+		// the counts read from the output so far are replaced by the ones of the plugin
+		p.structured = true
+		p.tasksDone = 0
+		p.tasksTotal = 0
+		p.taskRunning = false
+		p.hosts = nil
+	}
+
+	switch event.Event {
+	case "play_start":
+		p.completeTask()
+		p.tasksTotal += event.Tasks
+	case "task_start":
+		p.startTask()
+	case "runner":
+		host := p.host(event.Host)
+		switch event.Status {
+		case "ok":
+			host.OK++
+		case "changed":
+			host.OK++
+			host.Changed++
+		case "failed":
+			host.Failed++
+		case "ignored":
+			host.Ignored++
+		case "skipped":
+			host.Skipped++
+		case "unreachable":
+			host.Unreachable++
+		}
+	case "stats":
+		p.completeTask()
+		// the recap is authoritative, results of loops and handlers aren't all reported as runner events
+		p.hosts = nil
+		for name, stats := range event.Hosts {
+			host := p.host(name)
+			host.OK = stats.OK
+			host.Changed = stats.Changed
+			host.Failed = stats.Failures
+			host.Unreachable = stats.Unreachable
+			host.Skipped = stats.Skipped
+			host.Rescued = stats.Rescued
+			host.Ignored = stats.Ignored
+		}
+	}
+}
+
+// recapLineRegex matches the line of a host in the play recap of the output
+var recapLineRegex = regexp.MustCompile(`^(\S+)\s+:\s+ok=(\d+)\s+changed=(\d+)\s+unreachable=(\d+)\s+failed=(\d+)(?:\s+skipped=(\d+))?(?:\s+rescued=(\d+))?(?:\s+ignored=(\d+))?`)
+
+// parseRecapLine reads the counters of a host from a line of the play recap
+func parseRecapLine(line string) (db.TaskHost, bool) {
+	match := recapLineRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return db.TaskHost{}, false
+	}
+
+	count := func(i int) int {
+		n, _ := strconv.Atoi(match[i])
+		return n
+	}
+
+	return db.TaskHost{
+		Host:        match[1],
+		OK:          count(2),
+		Changed:     count(3),
+		Unreachable: count(4),
+		Failed:      count(5),
+		Skipped:     count(6),
+		Rescued:     count(7),
+		Ignored:     count(8),
+	}, true
+}
+
+// applyOutput updates the progress with a line of the playbook output, unless the plugin reports events
+func (p *taskProgress) applyOutput(line string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.structured {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(line, "PLAY RECAP"):
+		p.completeTask()
+		p.inRecap = true
+	case strings.HasPrefix(line, "TASK ["):
+		p.inRecap = false
+		p.startTask()
+	case strings.HasPrefix(line, "PLAY ["):
+		p.inRecap = false
+		p.completeTask()
+	case p.inRecap:
+		if recap, ok := parseRecapLine(line); ok {
+			*p.host(recap.Host) = recap
+		}
+	}
+}
+
+// snapshot returns the tasks completed, the total if known and the results by host sorted by name
+func (p *taskProgress) snapshot() (int, *int, []db.TaskHost) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var total *int
+	if p.tasksTotal > 0 {
+		t := p.tasksTotal
+		total = &t
+	}
+
+	hosts := make([]db.TaskHost, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		h := *host
+		h.SetStatus()
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	return p.tasksDone, total, hosts
+}
+
+// getEventsDir returns the directory of the callback plugin and the events file of the task
+func (t *task) getEventsDir() string {
+	return util.Config.TmpPath + "/events_" + strconv.Itoa(t.task.ID)
+}
+
+func (t *task) getEventsPath() string {
+	return t.getEventsDir() + "/events.jsonl"
+}
+
+// installEventsCallback writes the callback plugin and an empty events file to the events dir of the task
+func (t *task) installEventsCallback() error {
+	dir := t.getEventsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(dir+"/"+eventsCallbackName+".py", []byte(eventsCallbackPlugin), 0644); err != nil {
+		return err
+	}
+
+	// ansible may run as another user, which appends to the file
+	if err := ioutil.WriteFile(t.getEventsPath(), nil, 0666); err != nil {
+		return err
+	}
+
+	return os.Chmod(t.getEventsPath(), 0666)
+}
+
+// appendEnvList adds an item to a list in the environment of the task or of semaphore, the later
+// value of a variable wins so the list set by the template environment isn't lost
+func (t *task) appendEnvList(key string, item string, separator string) string {
+	value, ok := t.env[key]
+	if !ok {
+		value = os.Getenv(key)
+	}
+
+	if len(value) == 0 {
+		return key + "=" + item
+	}
+
+	return key + "=" + value + separator + item
+}
+
+// eventsEnvVars enables the callback plugin of the task. Both names of the setting are set,
+// ansible before 2.11 only knows the whitelist
+func (t *task) eventsEnvVars() []string {
+	return []string{
+		t.appendEnvList("ANSIBLE_CALLBACK_PLUGINS", t.getEventsDir(), ":"),
+		t.appendEnvList("ANSIBLE_CALLBACKS_ENABLED", eventsCallbackName, ","),
+		t.appendEnvList("ANSIBLE_CALLBACK_WHITELIST", eventsCallbackName, ","),
+		"SEMAPHORE_EVENTS_FILE=" + t.getEventsPath(),
+	}
+}
+
+// followEvents reads the events file while the playbook runs. The returned function reads the
+// rest of the file once the playbook exited and removes the events dir
+func (t *task) followEvents() func() {
+	dir := t.getEventsDir()
+
+	file, err := os.Open(t.getEventsPath())
+	if err != nil {
+		util.LogWarning(os.RemoveAll(dir))
+		return func() {}
+	}
+
+	exited := make(chan struct{})
+	read := make(chan struct{})
+
+	go func() {
+		defer close(read)
+
+		reader := bufio.NewReader(file)
+		partial := ""
+		draining := false
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err == nil {
+				t.progress.applyEvent(partial + line)
+				partial = ""
+				continue
+			}
+
+			// a line the plugin didn't finish writing yet
+			partial += line
+
+			if draining {
+				if len(partial) > 0 {
+					t.progress.applyEvent(partial)
+				}
+				return
+			}
+
+			select {
+			case <-exited:
+				draining = true
+			case <-time.After(eventsPollInterval):
+			}
+		}
+	}()
+
+	return func() {
+		close(exited)
+		<-read
+		util.LogWarning(file.Close())
+		util.LogWarning(os.RemoveAll(dir))
+	}
+}
+
+// storeProgress stores the tasks completed and the results by host of the run
+func (t *task) storeProgress() {
+	done, total, hosts := t.progress.snapshot()
+
+	if _, err := db.Mysql.Exec("update task set tasks_done=?, tasks_total=? where id=?", done, total, t.task.ID); err != nil {
+		t.panicOnError(err, "Failed to update task progress")
+	}
+
+	for _, host := range hosts {
+		host.TaskID = t.task.ID
+		if err := db.Mysql.Insert(&host); err != nil {
+			t.panicOnError(err, "Failed to store task host")
+		}
+	}
+}
+
+// getTaskHosts returns the results by host of a task, read from the runner while the task runs
+func getTaskHosts(task db.Task) ([]db.TaskHost, error) {
+	if t := pool.find(task.ID); t != nil && task.Status == taskRunningStatus {
+		_, _, hosts := t.progress.snapshot()
+		return hosts, nil
+	}
+
+	hosts := []db.TaskHost{}
+	_, err := db.Mysql.Select(&hosts, "select * from task__host where task_id=? order by host", task.ID)
+	return hosts, err
+}
+
+// GetTaskHosts returns the results of a task by host
+func GetTaskHosts(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	hosts, err := getTaskHosts(task)
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, hosts)
+}
@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+func TestParseRecapLine(t *testing.T) {
+	host, ok := parseRecapLine("web1                       : ok=5    changed=2    unreachable=0    failed=1    skipped=3    rescued=0    ignored=1   ")
+	if !ok {
+		t.Fatal("the recap line must be parsed")
+	}
+
+	if host.Host != "web1" || host.OK != 5 || host.Changed != 2 || host.Failed != 1 || host.Skipped != 3 || host.Ignored != 1 {
+		t.Fatalf("unexpected counters %+v", host)
+	}
+
+	// older ansible versions don't print skipped, rescued and ignored
+	if host, ok = parseRecapLine("db1 : ok=1 changed=0 unreachable=1 failed=0"); !ok || host.Unreachable != 1 {
+		t.Fatalf("unexpected counters %+v", host)
+	}
+
+	if _, ok = parseRecapLine("TASK [Gathering Facts] ****"); ok {
+		t.Fatal("a line which isn't a recap line must not be parsed")
+	}
+}
+
+func TestProgressOutput(t *testing.T) {
+	var p taskProgress
+	for _, line := range []string{
+		"PLAY [all] ****",
+		"TASK [Gathering Facts] ****",
+		"ok: [web1]",
+		"TASK [install] ****",
+		"changed: [web1]",
+		"PLAY RECAP ****",
+		"web1 : ok=2 changed=1 unreachable=0 failed=0",
+	} {
+		p.applyOutput(line)
+	}
+
+	done, total, hosts := p.snapshot()
+	if done != 2 || total != nil {
+		t.Fatalf("expected 2 tasks done of an unknown total, got %d %v", done, total)
+	}
+
+	if len(hosts) != 1 || hosts[0].Status != db.TaskHostChanged {
+		t.Fatalf("unexpected hosts %+v", hosts)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	var p taskProgress
+	p.applyOutput("TASK [Gathering Facts] ****")
+
+	for _, line := range []string{
+		`{"event": "play_start", "name": "all", "tasks": 3}`,
+		`{"event": "task_start", "name": "Gathering Facts"}`,
+		`{"event": "runner", "host": "web1", "status": "ok"}`,
+		`{"event": "runner", "host": "web2", "status": "unreachable"}`,
+		`{"event": "task_start", "name": "install"}`,
+		`not json`,
+	} {
+		p.applyEvent(line)
+	}
+
+	// output isn't parsed anymore once the plugin reported events
+	p.applyOutput("TASK [ignored] ****")
+
+	done, total, hosts := p.snapshot()
+	if done != 1 || total == nil || *total != 3 {
+		t.Fatalf("expected 1 of 3 tasks done, got %d %v", done, total)
+	}
+
+	if len(hosts) != 2 || hosts[0].Status != db.TaskHostOK || hosts[1].Status != db.TaskHostUnreachable {
+		t.Fatalf("unexpected hosts %+v", hosts)
+	}
+
+	p.applyEvent(`{"event": "stats", "hosts": {"web1": {"ok": 2, "changed": 0, "unreachable": 0, "failures": 1, "skipped": 0}}}`)
+
+	done, _, hosts = p.snapshot()
+	if done != 2 {
+		t.Fatalf("expected 2 tasks done, got %d", done)
+	}
+
+	if len(hosts) != 1 || hosts[0].Failed != 1 || hosts[0].Status != db.TaskHostFailed {
+		t.Fatalf("the recap must replace the hosts, got %+v", hosts)
+	}
+}
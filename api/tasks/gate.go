@@ -0,0 +1,62 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// requiredTemplateRun is the last finished task of the template another template requires
+type requiredTemplateRun struct {
+	ID     int        `db:"id" json:"id"`
+	Status string     `db:"status" json:"status"`
+	End    *time.Time `db:"end" json:"end"`
+}
+
+// checkRequiredTemplate returns an error when the template requires another template
+// whose last finished run didn't succeed, or succeeded longer ago than allowed.
+// The run, if any, is returned so the caller can explain the gate
+func checkRequiredTemplate(template db.Template) (*requiredTemplateRun, error) {
+	if template.RequiredTemplateID == nil {
+		return nil, nil
+	}
+
+	var run requiredTemplateRun
+	err := db.Mysql.SelectOne(&run, "select id, status, end from task where template_id=? and status not in (?, ?) order by created desc, id desc limit 1",
+		*template.RequiredTemplateID, taskWaitingStatus, taskRunningStatus)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("Required template " + strconv.Itoa(*template.RequiredTemplateID) + " has never run")
+	} else if err != nil {
+		panic(err)
+	}
+
+	if run.Status != taskSuccessStatus {
+		return &run, errors.New("Last run of required template " + strconv.Itoa(*template.RequiredTemplateID) + " did not succeed")
+	}
+
+	if template.RequiredWithin != nil && run.End != nil &&
+		time.Since(*run.End) > time.Duration(*template.RequiredWithin)*time.Minute {
+		return &run, errors.New("Last successful run of required template " + strconv.Itoa(*template.RequiredTemplateID) +
+			" is older than " + strconv.Itoa(*template.RequiredWithin) + " minutes")
+	}
+
+	return &run, nil
+}
+
+// checkRunWindow returns the run window of the template if the time is outside of it, nil if the task can start
+func checkRunWindow(template db.Template, t time.Time) (*db.RunWindow, error) {
+	window, err := db.ParseRunWindow(template.RunWindow)
+	if err != nil || window == nil {
+		return nil, err
+	}
+
+	inside, err := window.Contains(t)
+	if err != nil || inside {
+		return nil, err
+	}
+
+	return window, nil
+}
@@ -0,0 +1,164 @@
+package tasks
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gas
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/mux"
+)
+
+// maxHookPayloadSize limits the body of a hook request, push payloads of large pushes are a few hundred kilobytes
+const maxHookPayloadSize = 5 << 20
+
+// hookPush is the part of the GitHub and GitLab push payloads a hook needs
+type hookPush struct {
+	Ref   string `json:"ref"`
+	After string `json:"after"`
+}
+
+// RunHook queues a task of the template a hook belongs to when a GitHub or GitLab push event
+// is posted to it. The payload must be signed with, or carry, the secret of the hook, and pushes
+// to branches the hook isn't restricted to are acknowledged without running anything
+func RunHook(w http.ResponseWriter, r *http.Request) {
+	var hook db.Hook
+	err := db.Mysql.SelectOne(&hook, "select h.* from project__template_hook as h join project__template as pt on pt.id=h.template_id join project as p on p.id=pt.project_id where h.token=? and p.archived=0", mux.Vars(r)["token"])
+	if err == sql.ErrNoRows {
+		util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgHookNotFound, nil)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxHookPayloadSize+1))
+	if err != nil || len(body) > maxHookPayloadSize {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidPayload, nil)
+		return
+	}
+
+	var source, event string
+	switch {
+	case len(r.Header.Get("X-GitHub-Event")) > 0:
+		source, event = "github", r.Header.Get("X-GitHub-Event")
+		if !verifyGitHubSignature(r, body, hook.Secret) {
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidSignature, nil)
+			return
+		}
+	case len(r.Header.Get("X-Gitlab-Event")) > 0:
+		source, event = "gitlab", r.Header.Get("X-Gitlab-Event")
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(hook.Secret)) != 1 {
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgInvalidHookToken, nil)
+			return
+		}
+	default:
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgUnsupportedHook, nil)
+		return
+	}
+
+	// github sends a ping when the webhook is created
+	if event != "push" && event != "Push Hook" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var push hookPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidPayload, nil)
+		return
+	}
+
+	// tag pushes, and pushes deleting a branch, don't run anything
+	if !strings.HasPrefix(push.Ref, "refs/heads/") || strings.Trim(push.After, "0") == "" ||
+		!hook.Runs(strings.TrimPrefix(push.Ref, "refs/heads/")) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if m := GetMaintenance(); m.Enabled {
+		util.WriteError(w, http.StatusServiceUnavailable, m.Message, nil)
+		return
+	}
+
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where id=?", hook.TemplateID); err != nil {
+		panic(err)
+	}
+
+	if _, err := checkRequiredTemplate(template); err != nil {
+		util.WriteError(w, http.StatusConflict, err.Error(), nil)
+		return
+	}
+
+	if window, err := checkRunWindow(template, time.Now()); err != nil {
+		panic(err)
+	} else if window != nil {
+		util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgOutsideRunWindow, nil)
+		return
+	}
+
+	taskObj := db.Task{
+		TemplateID: template.ID,
+		Status:     taskWaitingStatus,
+		Initiator:  db.TaskHookInitiator,
+		Source:     &source,
+		ExternalID: &push.After,
+		Created:    time.Now(),
+		Forks:      effectiveForks(template, nil),
+	}
+
+	if missing := preflight(template, taskObj); len(missing) > 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgMissingResources, map[string]interface{}{
+			"missing": missing,
+		})
+		return
+	}
+
+	if taskObj.Survey, err = surveyDefaults(template); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if err := db.Mysql.Insert(&taskObj); err != nil {
+		panic(err)
+	}
+
+	taskObj.Labels = []string{}
+	queueTask(taskObj, template.ProjectID)
+
+	util.WriteJSON(w, http.StatusCreated, taskObj)
+}
+
+// verifyGitHubSignature checks the HMAC signature of a GitHub payload, preferring the sha256 one
+func verifyGitHubSignature(r *http.Request, body []byte, secret string) bool {
+	signature := r.Header.Get("X-Hub-Signature-256")
+	prefix, newHash := "sha256=", sha256.New
+	if len(signature) == 0 {
+		signature = r.Header.Get("X-Hub-Signature")
+		prefix, newHash = "sha1=", func() hash.Hash { return sha1.New() } //nolint: gas
+	}
+
+	if !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body) //nolint: errcheck
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,37 @@
+package tasks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/main"}`)
+
+	mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+	mac.Write(body) //nolint: errcheck
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	r, _ := http.NewRequest("POST", "/api/hooks/token", nil)
+	r.Header.Set("X-Hub-Signature-256", signature)
+
+	if !verifyGitHubSignature(r, body, "0123456789abcdef") {
+		t.Fatal("a payload signed with the secret must be accepted")
+	}
+
+	if verifyGitHubSignature(r, body, "another secret!!") {
+		t.Fatal("a payload signed with another secret must be rejected")
+	}
+
+	if verifyGitHubSignature(r, []byte(`{"ref": "refs/heads/other"}`), "0123456789abcdef") {
+		t.Fatal("a modified payload must be rejected")
+	}
+
+	r.Header.Del("X-Hub-Signature-256")
+	if verifyGitHubSignature(r, body, "0123456789abcdef") {
+		t.Fatal("an unsigned payload must be rejected")
+	}
+}
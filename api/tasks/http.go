@@ -1,8 +1,12 @@
 package tasks
 
 import (
+	"database/sql"
+	"encoding/json"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -13,43 +17,301 @@ import (
 	"github.com/masterminds/squirrel"
 )
 
-// AddTask inserts a task into the database and returns a header or returns error
-func AddTask(w http.ResponseWriter, r *http.Request) {
-	project := context.Get(r, "project").(db.Project)
+// maxExternalIDLength is the size of the external_id and source columns
+const maxExternalIDLength = 255
+
+// maxTaskMessageLength is the longest message a task can be started with
+const maxTaskMessageLength = 1000
+
+// requestedTask returns a task with only the options a client chooses when it starts a task.
+// Everything else, like the status, the run results and the task a retry retries, is owned by the server
+func requestedTask(body db.Task) db.Task {
+	return db.Task{
+		TemplateID:        body.TemplateID,
+		Debug:             body.Debug,
+		DryRun:            body.DryRun,
+		Diff:              body.Diff,
+		Message:           body.Message,
+		Playbook:          body.Playbook,
+		Environment:       body.Environment,
+		Arguments:         body.Arguments,
+		Env:               body.Env,
+		Survey:            body.Survey,
+		Limit:             body.Limit,
+		Inventory:         body.Inventory,
+		Forks:             body.Forks,
+		ExternalID:        body.ExternalID,
+		Source:            body.Source,
+		Labels:            body.Labels,
+		InventoryIDs:      body.InventoryIDs,
+		Args:              body.Args,
+		OverrideRunWindow: body.OverrideRunWindow,
+		Confirm:           body.Confirm,
+		ConfirmProject:    body.ConfirmProject,
+	}
+}
+
+// checkTask validates the options of a task started in the project and normalizes empty ones,
+// it writes the error response when they are invalid
+func checkTask(w http.ResponseWriter, r *http.Request, projectID int, taskObj *db.Task) bool {
+	if _, err := db.ParseEnv(taskObj.Env); err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgEnvNotObject, nil)
+		return false
+	}
+
+	if err := validateLabels(taskObj.Labels); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+
+	if err := validateInventories(projectID, taskObj.InventoryIDs); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+
+	if taskObj.Inventory != nil && len(*taskObj.Inventory) == 0 {
+		taskObj.Inventory = nil
+	}
+
+	if taskObj.Inventory != nil {
+		if len(taskObj.InventoryIDs) > 0 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInventoryAndInventoryIDs, nil)
+			return false
+		}
+
+		if err := db.ValidateInlineInventory(*taskObj.Inventory); err != nil {
+			util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+			return false
+		}
+	}
+
+	if taskObj.Limit != nil && len(*taskObj.Limit) == 0 {
+		taskObj.Limit = nil
+	}
+
+	if taskObj.Limit != nil {
+		if err := db.ValidateLimit(*taskObj.Limit); err != nil {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidLimit, nil, err.Error())
+			return false
+		}
+	}
+
+	if err := db.ValidateForks(taskObj.Forks); err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+
+	if taskObj.Message != nil {
+		if message := strings.TrimSpace(*taskObj.Message); len(message) == 0 {
+			taskObj.Message = nil
+		} else if len(message) > maxTaskMessageLength {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgTaskMessageTooLong, nil, maxTaskMessageLength)
+			return false
+		} else {
+			taskObj.Message = &message
+		}
+	}
+
+	if (taskObj.ExternalID != nil && len(*taskObj.ExternalID) > maxExternalIDLength) ||
+		(taskObj.Source != nil && len(*taskObj.Source) > maxExternalIDLength) {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgExternalIDTooLong, nil, maxExternalIDLength)
+		return false
+	}
+
+	return true
+}
+
+// insertTask inserts a task with its labels and inventories in one transaction,
+// so a waiting task is never left without them
+func insertTask(taskObj *db.Task) error {
+	tx, err := db.Mysql.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Insert(taskObj); err != nil {
+		util.LogWarning(tx.Rollback())
+		return err
+	}
+
+	if err := insertLabels(tx, taskObj.ID, taskObj.Labels); err != nil {
+		util.LogWarning(tx.Rollback())
+		return err
+	}
+
+	if err := insertInventories(tx, taskObj.ID, taskObj.InventoryIDs); err != nil {
+		util.LogWarning(tx.Rollback())
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// startTask checks that the task of the template can run now, inserts it and queues it. It writes the created
+// task or the error, starting a task and retrying the failed hosts of one both go through it
+func startTask(w http.ResponseWriter, r *http.Request, project db.Project, template db.Template, taskObj db.Task) {
 	user := context.Get(r, "user").(*db.User)
 
-	var taskObj db.Task
-	if err := util.Bind(w, r, &taskObj); err != nil {
+	if project.Archived {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgProjectArchived, nil)
+		return
+	}
+
+	if m := GetMaintenance(); m.Enabled {
+		util.WriteError(w, http.StatusServiceUnavailable, m.Message, nil)
+		return
+	}
+
+	if missing := preflight(template, taskObj); len(missing) > 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgMissingResources, map[string]interface{}{
+			"missing": missing,
+		})
+		return
+	}
+
+	production, err := isProductionRun(template, taskObj)
+	if err != nil {
+		panic(err)
+	}
+
+	if production && !productionRunConfirmed(project, taskObj) {
+		util.WriteLocalizedError(w, r, http.StatusPreconditionFailed, util.MsgProductionNotConfirmed, map[string]interface{}{
+			"production": true,
+		})
+		return
+	}
+
+	if run, err := checkRequiredTemplate(template); err != nil {
+		util.WriteError(w, http.StatusConflict, err.Error(), map[string]interface{}{
+			"required_template_id": *template.RequiredTemplateID,
+			"last_run":             run,
+		})
+		return
+	}
+
+	window, err := checkRunWindow(template, time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	if window != nil && !(taskObj.OverrideRunWindow && user.Admin) {
+		util.WriteLocalizedError(w, r, http.StatusForbidden, util.MsgOutsideRunWindow, map[string]interface{}{
+			"run_window": window,
+		})
+		return
+	}
+
+	if !applyArguments(w, r, template, &taskObj) {
+		return
+	}
+
+	if !applySurvey(w, r, template, &taskObj) {
 		return
 	}
 
 	taskObj.Created = time.Now()
-	taskObj.Status = "waiting"
+	taskObj.Status = taskWaitingStatus
+	taskObj.Forks = effectiveForks(template, taskObj.Forks)
 	taskObj.UserID = &user.ID
+	taskObj.Initiator = db.TaskUserInitiator
+	if tokenID, ok := context.GetOk(r, "api_token_id"); ok {
+		taskObj.Initiator = db.TaskAPITokenInitiator
+		taskObj.SetAPIToken(tokenID.(string))
+	}
 
-	if err := db.Mysql.Insert(&taskObj); err != nil {
+	if err := insertTask(&taskObj); err != nil {
 		util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot create new task"})
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCannotCreateTask, nil)
 		return
 	}
 
-	pool.register <- &task{
+	if taskObj.Labels == nil {
+		taskObj.Labels = []string{}
+	}
+
+	if window != nil {
+		objType := taskTypeID
+		desc := "Task ID " + strconv.Itoa(taskObj.ID) + " (" + template.Alias + ") started outside its run window by " + user.Username
+		if err := (db.Event{
+			ProjectID:   &project.ID,
+			ObjectType:  &objType,
+			ObjectID:    &taskObj.ID,
+			Description: &desc,
+		}.Insert()); err != nil {
+			panic(err)
+		}
+	}
+
+	queueTask(taskObj, project.ID)
+
+	util.WriteCreated(w, "project/"+strconv.Itoa(project.ID)+"/tasks/"+strconv.Itoa(taskObj.ID), taskObj)
+}
+
+// AddTask inserts a task into the database and returns a header or returns error
+func AddTask(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var body db.Task
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+	taskObj := requestedTask(body)
+
+	if !checkTask(w, r, project.ID, &taskObj) {
+		return
+	}
+
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", project.ID, taskObj.TemplateID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgTemplateNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	startTask(w, r, project, template, taskObj)
+}
+
+// queueTask adds a task which was inserted into the database to the runner queue
+func queueTask(taskObj db.Task, projectID int) {
+	enqueue(&task{
 		task:      taskObj,
-		projectID: project.ID,
+		projectID: projectID,
+	})
+}
+
+func enqueue(t *task) {
+	var template struct {
+		Resource  sql.NullString `db:"resource"`
+		RunnerTag *string        `db:"runner_tag"`
+	}
+	if err := db.Mysql.SelectOne(&template, "select resource, runner_tag from project__template where id=?", t.task.TemplateID); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot read the resource and runner tag of template " + strconv.Itoa(t.task.TemplateID)})
+	}
+	t.resource = template.Resource.String
+
+	t.task.RunnerTag = template.RunnerTag
+	if _, err := db.Mysql.Exec("update task set runner_tag=? where id=?", t.task.RunnerTag, t.task.ID); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot set the runner tag of task " + strconv.Itoa(t.task.ID)})
+	}
+
+	pool.register <- t
+	if !acceptsRunnerTag(t.task.RunnerTag) {
+		t.log("Task waits for a runner advertising the runner tag " + *t.task.RunnerTag)
 	}
 
 	objType := taskTypeID
-	desc := "Task ID " + strconv.Itoa(taskObj.ID) + " queued for running"
+	desc := "Task ID " + strconv.Itoa(t.task.ID) + " queued for running"
 	if err := (db.Event{
-		ProjectID:   &project.ID,
+		ProjectID:   &t.projectID,
 		ObjectType:  &objType,
-		ObjectID:    &taskObj.ID,
+		ObjectID:    &t.task.ID,
 		Description: &desc,
 	}.Insert()); err != nil {
 		util.LogErrorWithFields(err, log.Fields{"error": "Cannot write new event to database"})
 	}
-
-	util.WriteJSON(w, http.StatusCreated, taskObj)
 }
 
 // GetTasksList returns a list of tasks for the current project in desc order to limit or error
@@ -63,6 +325,19 @@ func GetTasksList(w http.ResponseWriter, r *http.Request, limit uint64) {
 		Where("tpl.project_id=?", project.ID).
 		OrderBy("task.created desc")
 
+	if label := r.URL.Query().Get("label"); len(label) > 0 {
+		q = q.Join("task__label as tl on tl.task_id=task.id").
+			Where("tl.label=?", label)
+	}
+
+	if externalID := r.URL.Query().Get("external_id"); len(externalID) > 0 {
+		q = q.Where("task.external_id=?", externalID)
+	}
+
+	if source := r.URL.Query().Get("source"); len(source) > 0 {
+		q = q.Where("task.source=?", source)
+	}
+
 	if limit > 0 {
 		q = q.Limit(limit)
 	}
@@ -78,10 +353,24 @@ func GetTasksList(w http.ResponseWriter, r *http.Request, limit uint64) {
 	}
 	if _, err := db.Mysql.Select(&tasks, query, args...); err != nil {
 		util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot get tasks list from database"})
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCannotGetTasks, nil)
 		return
 	}
 
+	taskIDs := make([]int, len(tasks))
+	for i, t := range tasks {
+		taskIDs[i] = t.ID
+	}
+
+	labels, err := getTaskLabels(taskIDs)
+	if err != nil {
+		panic(err)
+	}
+
+	for i, t := range tasks {
+		tasks[i].Labels = labels[t.ID]
+	}
+
 	util.WriteJSON(w, http.StatusOK, tasks)
 }
 
@@ -95,9 +384,74 @@ func GetLastTasks(w http.ResponseWriter, r *http.Request) {
 	GetTasksList(w, r, 200)
 }
 
+// GetTemplateLastTask returns the most recent task of the template, optionally the most recent one with
+// the status given by the status parameter, e.g. the last successful run to roll back to
+func GetTemplateLastTask(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	q := squirrel.Select("*").
+		From(taskTypeID).
+		Where("template_id=?", template.ID).
+		OrderBy("created desc", "id desc").
+		Limit(1)
+
+	if status := r.URL.Query().Get("status"); len(status) > 0 {
+		if !db.IsTaskStatus(status) {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidTaskStatus, nil, strings.Join(db.TaskStatuses, ", "))
+			return
+		}
+
+		q = q.Where("status=?", status)
+	}
+
+	query, args, err := q.ToSql()
+	util.LogWarning(err)
+
+	var task db.Task
+	if err := db.Mysql.SelectOne(&task, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTaskNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	labels, err := getTaskLabels([]int{task.ID})
+	if err != nil {
+		panic(err)
+	}
+
+	task.Labels = labels[task.ID]
+
+	util.WriteJSON(w, http.StatusOK, task)
+}
+
 // GetTask returns a task based on its id
 func GetTask(w http.ResponseWriter, r *http.Request) {
 	task := context.Get(r, taskTypeID).(db.Task)
+
+	if task.Status == taskWaitingStatus {
+		task.QueuePosition = pool.queuePosition(task.ID)
+		task.BlockedOn = pool.blockedOn(task.ID)
+	}
+
+	if t := pool.find(task.ID); t != nil && task.Status == taskRunningStatus {
+		task.TasksDone, task.TasksTotal, _ = t.progress.snapshot()
+	}
+
+	hosts, err := getTaskHosts(task)
+	if err != nil {
+		panic(err)
+	}
+	task.Hosts = hosts
+
+	comments, err := getTaskComments(task.ID)
+	if err != nil {
+		panic(err)
+	}
+	task.Comments = comments
+
 	util.WriteJSON(w, http.StatusOK, task)
 }
 
@@ -109,8 +463,27 @@ func GetTaskMiddleware(next http.Handler) http.Handler {
 			panic(err)
 		}
 
+		project := context.Get(r, "project").(db.Project)
+
+		// tasks of other projects are not found
 		var task db.Task
-		if err := db.Mysql.SelectOne(&task, "select * from task where id=?", taskID); err != nil {
+		if err := db.Mysql.SelectOne(&task, "select task.* from task join project__template as pt on pt.id=task.template_id "+
+			"where task.id=? and pt.project_id=?", taskID, project.ID); err != nil {
+			if err == sql.ErrNoRows {
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTaskNotFound, nil)
+				return
+			}
+
+			panic(err)
+		}
+
+		labels, err := getTaskLabels([]int{task.ID})
+		if err != nil {
+			panic(err)
+		}
+		task.Labels = labels[task.ID]
+
+		if task.InventoryIDs, err = getTaskInventoryIDs(task.ID); err != nil {
 			panic(err)
 		}
 
@@ -123,16 +496,210 @@ func GetTaskMiddleware(next http.Handler) http.Handler {
 func GetTaskOutput(w http.ResponseWriter, r *http.Request) {
 	task := context.Get(r, taskTypeID).(db.Task)
 
+	q := squirrel.Select("task_id, task, time, output, diff, stream, seq").
+		From("task__output").
+		Where("task_id=?", task.ID)
+
+	match, contextLines, ok := parseOutputGrep(w, r)
+	if !ok {
+		return
+	}
+
+	// from and to return the records of a range of sequence numbers, e.g. the lines around a linked line
+	from, to, ok := parseOutputRange(w, r)
+	if !ok {
+		return
+	}
+	if from > 0 {
+		q = q.Where("seq>=?", from)
+	}
+	if to > 0 {
+		q = q.Where("seq<=?", to)
+	}
+
+	// tail=N returns only the last N records, still in chronological order. With grep the last N matching records
+	tail := 0
+	if t := r.URL.Query().Get("tail"); len(t) > 0 {
+		var err error
+		if tail, err = strconv.Atoi(t); err != nil || tail < 1 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNotPositive, nil, "tail")
+			return
+		}
+	}
+
+	if tail > 0 && match == nil {
+		q = q.OrderBy("time desc", "seq desc").Limit(uint64(tail))
+	} else {
+		q = q.OrderBy("time asc", "seq asc")
+	}
+
+	query, args, _ := q.ToSql()
+
 	var output []db.TaskOutput
-	if _, err := db.Mysql.Select(&output, "select task_id, task, time, output from task__output where task_id=? order by time asc", task.ID); err != nil {
+	if _, err := db.Mysql.Select(&output, query, args...); err != nil {
 		util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot get task output from database"})
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCannotGetTaskOutput, nil)
+		return
+	}
+
+	if match != nil {
+		output = grepOutput(output, match, contextLines)
+		if tail > 0 && len(output) > tail {
+			output = output[len(output)-tail:]
+		}
+	} else if tail > 0 {
+		for i, j := 0, len(output)-1; i < j; i, j = i+1, j-1 {
+			output[i], output[j] = output[j], output[i]
+		}
+	}
+
+	if wantsNDJSON(r) {
+		writeOutputNDJSON(w, output)
 		return
 	}
 
 	util.WriteJSON(w, http.StatusOK, output)
 }
 
+// ndjsonContentType is the media type of newline delimited json, one json object per line
+const ndjsonContentType = "application/x-ndjson"
+
+// outputRecord is an output record in the newline delimited json export of the output
+type outputRecord struct {
+	TaskID    int       `json:"task_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	Text      string    `json:"text"`
+	Sequence  int64     `json:"sequence"`
+	Diff      bool      `json:"diff,omitempty"`
+}
+
+// wantsNDJSON tells if the client asked for the output as newline delimited json, with format=ndjson or the Accept header
+func wantsNDJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// writeOutputNDJSON writes an output record per line, flushing as it goes so large outputs are streamed
+func writeOutputNDJSON(w http.ResponseWriter, output []db.TaskOutput) {
+	w.Header().Set("content-type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for i, line := range output {
+		if err := encoder.Encode(outputRecord{
+			TaskID:    line.TaskID,
+			Timestamp: line.Time,
+			Source:    line.Stream,
+			Text:      line.Output,
+			Sequence:  line.Seq,
+			Diff:      line.Diff,
+		}); err != nil {
+			// the client went away
+			return
+		}
+
+		if flusher != nil && i%1000 == 999 {
+			flusher.Flush()
+		}
+	}
+}
+
+// maxOutputContext is the most lines of context grep returns around a match
+const maxOutputContext = 50
+
+// parseOutputGrep reads the grep, regex and context parameters of the output endpoint, match is nil without grep.
+// It writes a bad request response if they are invalid
+func parseOutputGrep(w http.ResponseWriter, r *http.Request) (match func(string) bool, contextLines int, ok bool) {
+	query := r.URL.Query()
+
+	pattern := query.Get("grep")
+	if len(pattern) == 0 {
+		return nil, 0, true
+	}
+
+	if c := query.Get("context"); len(c) > 0 {
+		var err error
+		if contextLines, err = strconv.Atoi(c); err != nil || contextLines < 0 || contextLines > maxOutputContext {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgOutputContextRange, nil, maxOutputContext)
+			return nil, 0, false
+		}
+	}
+
+	if query.Get("regex") != "1" {
+		return func(line string) bool {
+			return strings.Contains(line, pattern)
+		}, contextLines, true
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidRegex, nil, err.Error())
+		return nil, 0, false
+	}
+
+	return re.MatchString, contextLines, true
+}
+
+// parseOutputRange reads the from and to sequence numbers of the output endpoint, 0 when they are not given.
+// It writes a bad request response if they are invalid
+func parseOutputRange(w http.ResponseWriter, r *http.Request) (from int64, to int64, ok bool) {
+	query := r.URL.Query()
+
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{{"from", &from}, {"to", &to}} {
+		val := query.Get(param.name)
+		if len(val) == 0 {
+			continue
+		}
+
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || n < 1 {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNotPositive, nil, param.name)
+			return 0, 0, false
+		}
+		*param.value = n
+	}
+
+	if from > 0 && to > 0 && to < from {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgToBeforeFrom, nil)
+		return 0, 0, false
+	}
+
+	return from, to, true
+}
+
+// grepOutput returns the output records matching, with contextLines records before and after each match
+func grepOutput(output []db.TaskOutput, match func(string) bool, contextLines int) []db.TaskOutput {
+	filtered := make([]db.TaskOutput, 0)
+
+	// index of the first record which isn't in filtered yet
+	next := 0
+	for i, line := range output {
+		if !match(line.Output) {
+			continue
+		}
+
+		from := i - contextLines
+		if from < next {
+			from = next
+		}
+
+		to := i + contextLines + 1
+		if to > len(output) {
+			to = len(output)
+		}
+
+		filtered = append(filtered, output[from:to]...)
+		next = to
+	}
+
+	return filtered
+}
+
 // RemoveTask removes a task from the database
 func RemoveTask(w http.ResponseWriter, r *http.Request) {
 	task := context.Get(r, taskTypeID).(db.Task)
@@ -140,7 +707,7 @@ func RemoveTask(w http.ResponseWriter, r *http.Request) {
 
 	if !editor.Admin {
 		log.Warn(editor.Username + " is not permitted to delete task logs")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgOnlyAdminsDeleteTasks, nil)
 		return
 	}
 
@@ -153,10 +720,193 @@ func RemoveTask(w http.ResponseWriter, r *http.Request) {
 		_, err := db.Mysql.Exec(statement, task.ID)
 		if err != nil {
 			util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot delete task from database"})
-			w.WriteHeader(http.StatusBadRequest)
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCannotDeleteTask, nil)
 			return
 		}
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// deleteTasks removes tasks with their output in one transaction, labels and artifacts are removed by the database
+func deleteTasks(taskIDs []int) error {
+	tx, err := db.Mysql.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range []squirrel.DeleteBuilder{
+		squirrel.Delete("task__output").Where(squirrel.Eq{"task_id": taskIDs}),
+		squirrel.Delete("task").Where(squirrel.Eq{"id": taskIDs}),
+	} {
+		query, args, err := statement.ToSql()
+		util.LogWarning(err)
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			util.LogWarning(tx.Rollback())
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// maxRemoveTasks limits how many tasks RemoveTasks deletes per request
+const maxRemoveTasks = 1000
+
+// removeTaskResult is the outcome of the deletion of one task by RemoveTasks
+type removeTaskResult struct {
+	ID      int    `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RemoveTasks deletes the tasks of the project with the ids given as a JSON array. Waiting and running
+// tasks, and ids of other projects, are skipped with a reason instead of failing the request
+func RemoveTasks(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	editor := context.Get(r, "user").(*db.User)
+
+	if !editor.Admin {
+		log.Warn(editor.Username + " is not permitted to delete task logs")
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgOnlyAdminsDeleteTasks, nil)
+		return
+	}
+
+	var taskIDs []int
+	if err := util.Bind(w, r, &taskIDs); err != nil {
+		return
+	}
+
+	if len(taskIDs) == 0 || len(taskIDs) > maxRemoveTasks {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgRemoveTasksCount, nil, maxRemoveTasks)
+		return
+	}
+
+	query, args, err := squirrel.Select("t.id, t.status").
+		From("task as t").
+		Join("project__template as pt on pt.id=t.template_id").
+		Where("pt.project_id=?", project.ID).
+		Where(squirrel.Eq{"t.id": taskIDs}).
+		ToSql()
+	util.LogWarning(err)
+
+	var found []struct {
+		ID     int    `db:"id"`
+		Status string `db:"status"`
+	}
+	if _, err := db.Mysql.Select(&found, query, args...); err != nil {
+		panic(err)
+	}
+
+	statuses := make(map[int]string)
+	for _, t := range found {
+		statuses[t.ID] = t.Status
+	}
+
+	results := []removeTaskResult{}
+	var deletable []int
+	seen := make(map[int]bool)
+	for _, id := range taskIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		status, ok := statuses[id]
+		switch {
+		case !ok:
+			results = append(results, removeTaskResult{ID: id, Reason: "Task not found"})
+		case status == taskWaitingStatus || status == taskRunningStatus:
+			results = append(results, removeTaskResult{ID: id, Reason: "Task is " + status})
+		default:
+			results = append(results, removeTaskResult{ID: id, Deleted: true})
+			deletable = append(deletable, id)
+		}
+	}
+
+	if len(deletable) > 0 {
+		if err := deleteTasks(deletable); err != nil {
+			util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot delete tasks from database"})
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgCannotDeleteTasks, nil)
+			return
+		}
+
+		desc := strconv.Itoa(len(deletable)) + " tasks deleted by " + editor.Username
+		if err := (db.Event{
+			ProjectID:   &project.ID,
+			Description: &desc,
+		}.Insert()); err != nil {
+			panic(err)
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, results)
+}
+
+// removeTasksBatchSize is the number of tasks deleted per statement by RemoveTemplateTasks
+const removeTasksBatchSize = 100
+
+// RemoveTemplateTasks deletes all tasks of a template with their output. It refuses to remove
+// the history while a task of the template is waiting or running, unless force=1 is passed
+func RemoveTemplateTasks(w http.ResponseWriter, r *http.Request) {
+	template := context.Get(r, "template").(db.Template)
+
+	var activeIDs []int
+	if _, err := db.Mysql.Select(&activeIDs, "select id from task where template_id=? and status in (?, ?)", template.ID, taskWaitingStatus, taskRunningStatus); err != nil {
+		panic(err)
+	}
+
+	if len(activeIDs) > 0 && r.URL.Query().Get("force") != "1" {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgTemplateHasActiveTasks, nil)
+		return
+	}
+
+	// force stops the tasks the runner still has, their rows are only deleted once they stopped.
+	// Active tasks the runner doesn't know anymore, e.g. after a restart, are deleted right away
+	stopping := 0
+	for _, id := range activeIDs {
+		if t := pool.find(id); t != nil {
+			t.stop()
+			stopping++
+		}
+	}
+
+	if stopping > 0 {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgTasksBeingStopped, nil, stopping)
+		return
+	}
+
+	deleted := 0
+	for {
+		var taskIDs []int
+		if _, err := db.Mysql.Select(&taskIDs, "select id from task where template_id=? limit ?", template.ID, removeTasksBatchSize); err != nil {
+			panic(err)
+		}
+
+		if len(taskIDs) == 0 {
+			break
+		}
+
+		if err := deleteTasks(taskIDs); err != nil {
+			panic(err)
+		}
+
+		deleted += len(taskIDs)
+	}
+
+	objType := "template"
+	desc := "Template ID " + strconv.Itoa(template.ID) + " history deleted (" + strconv.Itoa(deleted) + " tasks)"
+	if err := (db.Event{
+		ProjectID:   &template.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &template.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]int{
+		"deleted": deleted,
+	})
+}
@@ -1,32 +1,260 @@
 package tasks
 
 import (
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fiftin/semaphore/db"
 	"github.com/fiftin/semaphore/util"
+	"github.com/masterminds/squirrel"
+	"gopkg.in/gorp.v1"
 )
 
-func (t *task) installInventory() error {
-	if t.inventory.SSHKeyID != nil {
-		// write inventory key
-		err := t.installKey(t.inventory.SSHKey)
-		if err != nil {
+// maxTaskInventories limits how many inventories a task can merge
+const maxTaskInventories = 10
+
+// urlInventoryTimeout bounds the time fetching a url inventory may take
+const urlInventoryTimeout = 30 * time.Second
+
+// maxURLInventorySize is the size url inventories are refused above
+const maxURLInventorySize = 10 << 20
+
+// validateInventories checks that the inventories a task merges exist in the project. Ansible takes a
+// single private key, so inventories with a host access key must all use the same one
+func validateInventories(projectID int, inventoryIDs []int) error {
+	if len(inventoryIDs) == 0 {
+		return nil
+	}
+
+	if len(inventoryIDs) > maxTaskInventories {
+		return errors.New("a task can have at most 10 inventories")
+	}
+
+	seen := make(map[int]bool)
+	for _, id := range inventoryIDs {
+		if seen[id] {
+			return errors.New("duplicate inventory " + strconv.Itoa(id))
+		}
+		seen[id] = true
+	}
+
+	query, args, err := squirrel.Select("*").
+		From("project__inventory").
+		Where(squirrel.Eq{"id": inventoryIDs}).
+		Where("project_id=? and removed=0", projectID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var inventories []db.Inventory
+	if _, err := db.Mysql.Select(&inventories, query, args...); err != nil {
+		return err
+	}
+
+	if len(inventories) != len(inventoryIDs) {
+		return errors.New("inventory not found")
+	}
+
+	var sshKeyID *int
+	for _, inventory := range inventories {
+		if inventory.SSHKeyID == nil {
+			continue
+		}
+
+		if sshKeyID != nil && *sshKeyID != *inventory.SSHKeyID {
+			return errors.New("inventories with different ssh keys can't be combined")
+		}
+		sshKeyID = inventory.SSHKeyID
+	}
+
+	return nil
+}
+
+// insertInventories writes the inventories of a task to the database in their merge order
+func insertInventories(exec gorp.SqlExecutor, taskID int, inventoryIDs []int) error {
+	for i, id := range inventoryIDs {
+		if _, err := exec.Exec("insert into task__inventory set task_id=?, inventory_id=?, position=?", taskID, id, i); err != nil {
 			return err
 		}
 	}
 
-	switch t.inventory.Type {
-	case "static":
-		return t.installStaticInventory()
+	return nil
+}
+
+// getTaskInventoryIDs returns the inventories of a task in their merge order
+func getTaskInventoryIDs(taskID int) ([]int, error) {
+	var rows []struct {
+		InventoryID int `db:"inventory_id"`
+	}
+	if _, err := db.Mysql.Select(&rows, "select inventory_id from task__inventory where task_id=? order by position", taskID); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		ids[i] = row.InventoryID
+	}
+
+	return ids, nil
+}
+
+// localInventoryArgs run the playbook on localhost only, for tasks without an inventory
+var localInventoryArgs = []string{"-i", "localhost,", "--connection", "local"}
+
+// inventoryArgs returns the arguments passing the inventories of the task to ansible-playbook
+func (t *task) inventoryArgs() []string {
+	if len(t.inventories) == 0 {
+		return append([]string{}, localInventoryArgs...)
+	}
+
+	var args []string
+	for i := range t.inventories {
+		args = append(args, "-i", t.getInventoryPath(i))
+	}
+
+	return args
+}
+
+func (t *task) installInventory() error {
+	if len(t.inventories) == 0 {
+		t.log("No inventory, running on localhost")
+		return nil
+	}
+
+	for i, inventory := range t.inventories {
+		if inventory.SSHKeyID != nil {
+			// write inventory key
+			err := t.installKey(inventory.SSHKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch inventory.Type {
+		case "file":
+			if !util.IsSubPath(inventory.Inventory) {
+				return errors.New("inventory file " + inventory.Inventory + " is outside of the repository")
+			}
+		case "static":
+			if err := t.installStaticInventory(i); err != nil {
+				return err
+			}
+		case "url":
+			if err := t.installURLInventory(i); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func (t *task) installStaticInventory() error {
-	t.log("installing static inventory")
+// getInventoryPath returns the path ansible reads the i-th inventory of the task from.
+// File inventories are relative to the repository, not to the working directory of the template
+func (t *task) getInventoryPath(i int) string {
+	inventory := t.inventories[i]
+	if inventory.Type == "file" {
+		return filepath.Join(t.getRepositoryPath(), inventory.Inventory)
+	}
+
+	path := util.Config.TmpPath + "/inventory_" + strconv.Itoa(t.task.ID)
+	if i > 0 {
+		path += "_" + strconv.Itoa(i)
+	}
+
+	return path
+}
+
+func (t *task) installStaticInventory(i int) error {
+	t.log("installing static inventory " + t.inventories[i].Name)
 
 	// create inventory file
-	return ioutil.WriteFile(util.Config.TmpPath+"/inventory_"+strconv.Itoa(t.task.ID), []byte(t.inventory.Inventory), 0664)
+	path := t.getInventoryPath(i)
+	if err := ioutil.WriteFile(path, []byte(t.inventories[i].Inventory), 0664); err != nil {
+		return err
+	}
+
+	return chownRunAs(path)
+}
+
+// installURLInventory fetches a url inventory and writes it to the inventory file of the task.
+// The file is removed first, so a failed fetch never leaves the content of an earlier run behind
+func (t *task) installURLInventory(i int) error {
+	inventory := t.inventories[i]
+	t.log("fetching inventory " + inventory.Name)
+
+	path := t.getInventoryPath(i)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if inventory.KeyID != nil {
+		util.LogWarning(inventory.Key.MarkUsed())
+	}
+
+	content, err := fetchInventory(inventory)
+	if err != nil {
+		return errors.New("fetching inventory " + inventory.Name + " failed: " + err.Error())
+	}
+
+	if err := ioutil.WriteFile(path, content, 0664); err != nil {
+		return err
+	}
+
+	return chownRunAs(path)
+}
+
+// fetchInventory gets the content of a url inventory. A login_password key is sent as basic auth,
+// or as a bearer token when its login is "bearer"
+func fetchInventory(inventory db.Inventory) ([]byte, error) {
+	req, err := http.NewRequest("GET", inventory.Inventory, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if inventory.KeyID != nil {
+		login, password, err := inventory.Key.LoginPassword()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.EqualFold(login, "bearer") {
+			req.Header.Set("Authorization", "Bearer "+password)
+		} else {
+			req.SetBasicAuth(login, password)
+		}
+	}
+
+	client := http.Client{Timeout: urlInventoryTimeout}
+	resp, err := client.Do(req)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return nil, errors.New("no response within " + urlInventoryTimeout.String())
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("the url responded with HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxURLInventorySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > maxURLInventorySize {
+		return nil, errors.New("the inventory is larger than " + strconv.Itoa(maxURLInventorySize) + " bytes")
+	}
+
+	return content, nil
 }
@@ -0,0 +1,55 @@
+package tasks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+func TestFetchInventory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hosts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("[web]\nweb1\n")) //nolint: errcheck
+	}))
+	defer server.Close()
+
+	content, err := fetchInventory(db.Inventory{Name: "cloud", Type: "url", Inventory: server.URL + "/hosts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "[web]\nweb1\n" {
+		t.Fatalf("unexpected inventory %q", content)
+	}
+
+	if _, err := fetchInventory(db.Inventory{Name: "cloud", Type: "url", Inventory: server.URL + "/missing"}); err == nil {
+		t.Fatal("a response other than 200 must fail")
+	}
+}
+
+func TestInventoryArgs(t *testing.T) {
+	config := util.Config
+	defer func() { util.Config = config }()
+	util.Config = util.NewConfig()
+
+	var local task
+	if args := local.inventoryArgs(); len(args) != 4 || args[1] != "localhost," || args[3] != "local" {
+		t.Fatalf("a task without inventory must run on localhost, got %v", args)
+	}
+
+	dir := "playbooks"
+	file := task{
+		inventories: []db.Inventory{{Type: "file", Inventory: "hosts.ini"}},
+		template:    db.Template{WorkingDirectory: &dir},
+	}
+	if args := file.inventoryArgs(); len(args) != 2 || args[1] != file.getRepositoryPath()+"/hosts.ini" {
+		t.Fatalf("file inventories must be read from the repository, got %v", args)
+	}
+}
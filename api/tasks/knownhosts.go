@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// getKnownHostsPath returns the path of the known_hosts file the playbook of the task verifies host keys against
+func (t *task) getKnownHostsPath() string {
+	return util.Config.TmpPath + "/known_hosts_" + strconv.Itoa(t.task.ID)
+}
+
+// installKnownHosts writes the known_hosts of the project before the repository is updated,
+// git, ansible-galaxy and the playbook verify host keys against it until the run finishes
+func (t *task) installKnownHosts() error {
+	if len(t.knownHosts) == 0 {
+		return nil
+	}
+
+	path := t.getKnownHostsPath()
+	if err := ioutil.WriteFile(path, []byte(t.knownHosts), 0600); err != nil {
+		return err
+	}
+
+	t.log("Host keys are verified against the known hosts of the project")
+	return chownRunAs(path)
+}
+
+// removeKnownHosts removes the known_hosts file of the task once it finished
+func (t *task) removeKnownHosts() {
+	if len(t.knownHosts) == 0 {
+		return
+	}
+
+	if err := os.Remove(t.getKnownHostsPath()); err != nil && !os.IsNotExist(err) {
+		util.LogWarning(err)
+	}
+}
+
+// sshHostKeyOptions returns the host key options of the ssh commands git runs. Without known hosts
+// of the project host keys aren't checked, as before known hosts could be set
+func (t *task) sshHostKeyOptions() string {
+	if len(t.knownHosts) == 0 {
+		return "-o StrictHostKeyChecking=no"
+	}
+
+	return "-o UserKnownHostsFile=" + t.getKnownHostsPath() + " -o StrictHostKeyChecking=yes"
+}
+
+// knownHostsEnvVars makes ssh connections of ansible fail unless the host key is in the known_hosts of the
+// project. Common ssh args of the template env are kept, inventory vars still override them
+func (t *task) knownHostsEnvVars() []string {
+	return []string{
+		"ANSIBLE_HOST_KEY_CHECKING=True",
+		t.appendEnvList("ANSIBLE_SSH_COMMON_ARGS", "-o UserKnownHostsFile="+t.getKnownHostsPath()+" -o StrictHostKeyChecking=yes", " "),
+	}
+}
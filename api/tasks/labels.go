@@ -0,0 +1,112 @@
+package tasks
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/masterminds/squirrel"
+	"gopkg.in/gorp.v1"
+)
+
+const (
+	maxTaskLabels      = 10
+	maxTaskLabelLength = 32
+)
+
+var labelRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateLabels ensures task labels are a small set of short strings
+func validateLabels(labels []string) error {
+	if len(labels) > maxTaskLabels {
+		return errors.New("a task can have at most " + strconv.Itoa(maxTaskLabels) + " labels")
+	}
+
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > maxTaskLabelLength {
+			return errors.New("labels must be between 1 and " + strconv.Itoa(maxTaskLabelLength) + " characters long")
+		}
+
+		if !labelRegexp.MatchString(label) {
+			return errors.New("labels may only contain letters, digits, dots, dashes and underscores")
+		}
+
+		if seen[label] {
+			return errors.New("duplicate label " + label)
+		}
+		seen[label] = true
+	}
+
+	return nil
+}
+
+// insertLabels writes the labels of a task to the database
+func insertLabels(exec gorp.SqlExecutor, taskID int, labels []string) error {
+	for _, label := range labels {
+		if _, err := exec.Exec("insert into task__label set task_id=?, label=?", taskID, label); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceLabels replaces the labels of a task in one transaction
+func replaceLabels(taskID int, labels []string) error {
+	tx, err := db.Mysql.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("delete from task__label where task_id=?", taskID); err != nil {
+		util.LogWarning(tx.Rollback())
+		return err
+	}
+
+	for _, label := range labels {
+		if _, err := tx.Exec("insert into task__label set task_id=?, label=?", taskID, label); err != nil {
+			util.LogWarning(tx.Rollback())
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getTaskLabels returns the labels of the given tasks keyed by task id
+func getTaskLabels(taskIDs []int) (map[int][]string, error) {
+	labels := make(map[int][]string)
+	for _, id := range taskIDs {
+		labels[id] = []string{}
+	}
+
+	if len(taskIDs) == 0 {
+		return labels, nil
+	}
+
+	query, args, err := squirrel.Select("task_id", "label").
+		From("task__label").
+		Where(squirrel.Eq{"task_id": taskIDs}).
+		OrderBy("label").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		TaskID int    `db:"task_id"`
+		Label  string `db:"label"`
+	}
+	if _, err := db.Mysql.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		labels[row.TaskID] = append(labels[row.TaskID], row.Label)
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,21 @@
+package tasks
+
+import "testing"
+
+func TestValidateLabels(t *testing.T) {
+	if err := validateLabels([]string{"release-2.3", "rollback"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if validateLabels([]string{"with space"}) == nil {
+		t.Fatal("labels with spaces should be invalid")
+	}
+
+	if validateLabels([]string{"dup", "dup"}) == nil {
+		t.Fatal("duplicate labels should be invalid")
+	}
+
+	if validateLabels(make([]string, maxTaskLabels+1)) == nil {
+		t.Fatal("too many labels should be invalid")
+	}
+}
@@ -3,7 +3,11 @@ package tasks
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fiftin/semaphore/api/sockets"
@@ -12,30 +16,220 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
+// secretMask replaces secret values in the task output
+const secretMask = "**********"
+
+// minSecretLength is the length below which values are too ambiguous to be masked
+const minSecretLength = 4
+
+// addSecret registers a value which must never appear in the task output
+func (t *task) addSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	t.secrets = append(t.secrets, secret)
+}
+
+// maskSecrets replaces all registered secret values in msg
+func (t *task) maskSecrets(msg string) string {
+	for _, secret := range t.secrets {
+		msg = strings.Replace(msg, secret, secretMask, -1)
+	}
+
+	return msg
+}
+
+// shellQuote quotes an argument so the logged command can be pasted into a shell
+func shellQuote(arg string) string {
+	if len(arg) > 0 && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=:@,+%") == "" {
+		return arg
+	}
+
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// streams output lines are tagged with
+const (
+	outputStdout = "stdout"
+	outputStderr = "stderr"
+)
+
 func (t *task) log(msg string) {
-	now := time.Now()
+	t.logOutput(msg, false, outputStdout)
+}
 
-	for _, user := range t.users {
-		b, err := json.Marshal(&map[string]interface{}{
-			"type":       "log",
-			"output":     msg,
-			"time":       now,
-			"task_id":    t.task.ID,
-			"project_id": t.projectID,
-		})
+// logOutput stores and broadcasts a line of output, diff tells if it belongs to a --diff block
+// and stream which output of the process it was read from
+func (t *task) logOutput(msg string, diff bool, stream string) {
+	if t.preview {
+		t.previewLog = append(t.previewLog, t.maskSecrets(msg))
+		return
+	}
 
-		util.LogPanic(err)
+	line := outputLine{
+		Output: t.maskSecrets(msg),
+		Diff:   diff,
+		Stream: stream,
+		Time:   time.Now(),
+	}
 
-		sockets.Message(user, b)
+	// both pipes are logged concurrently, the lines are numbered, stored and broadcast in one
+	// go so clients receive them in order and a replay finds every line broadcast before it
+	t.logLock.Lock()
+	t.outputSeq++
+	line.Seq = t.outputSeq
+
+	if t.reserveOutput(line) {
+		t.storeOutput(line)
 	}
 
+	t.broadcastOutput(line)
+
+	if t.stdout != nil {
+		fmt.Fprintln(t.stdout, line.Output) //nolint: errcheck
+	}
+	t.logLock.Unlock()
+
+	sendToLogSink(logSinkEntry{
+		TaskID:    t.task.ID,
+		ProjectID: t.projectID,
+		Time:      line.Time,
+		Output:    line.Output,
+		Stream:    stream,
+	})
+}
+
+// outputTruncatedMarker is the last line stored of an output which exceeded max_output_size
+const outputTruncatedMarker = "[output truncated]"
+
+// reserveOutput counts the line against max_output_size and reports whether it may be stored.
+// The first line which doesn't fit is replaced by the truncation marker and the task is flagged
+func (t *task) reserveOutput(line outputLine) bool {
+	if util.Config.MaxOutputSize == 0 {
+		return true
+	}
+
+	t.outputLock.Lock()
+	defer t.outputLock.Unlock()
+
+	if t.task.OutputTruncated {
+		return false
+	}
+
+	if t.outputSize+len(line.Output) <= util.Config.MaxOutputSize {
+		t.outputSize += len(line.Output)
+		return true
+	}
+
+	t.task.OutputTruncated = true
+	// the marker takes the place of the line, so replayed output ends with it too
+	t.storeOutput(outputLine{Output: outputTruncatedMarker, Stream: outputStdout, Time: time.Now(), Seq: line.Seq})
+
+	go func() {
+		_, err := db.Mysql.Exec("update task set output_truncated=1 where id=?", t.task.ID)
+		util.LogErrorWithFields(err, log.Fields{"error": "Failed to flag truncated task output"})
+	}()
+
+	return false
+}
+
+// unstoredOutput keeps the output lines whose insert hasn't finished yet by task id,
+// replays read them together with the stored lines
+var unstoredOutput = struct {
+	lock  sync.Mutex
+	lines map[int][]outputLine
+}{
+	lines: make(map[int][]outputLine),
+}
+
+// storeOutput inserts a line of output in the background, until the insert is done the line is in unstoredOutput
+func (t *task) storeOutput(line outputLine) {
+	taskID := t.task.ID
+
+	unstoredOutput.lock.Lock()
+	unstoredOutput.lines[taskID] = append(unstoredOutput.lines[taskID], line)
+	unstoredOutput.lock.Unlock()
+
 	go func() {
-		_, err := db.Mysql.Exec("insert into task__output (task_id, task, output, time) VALUES (?, '', ?, ?)", t.task.ID, msg, now)
+		_, err := db.Mysql.Exec("insert into task__output (task_id, task, output, diff, stream, time, seq) VALUES (?, '', ?, ?, ?, ?, ?)", taskID, line.Output, line.Diff, line.Stream, line.Time, line.Seq)
+
+		unstoredOutput.lock.Lock()
+		lines := unstoredOutput.lines[taskID]
+		for i := range lines {
+			if lines[i].Seq == line.Seq {
+				lines = append(lines[:i], lines[i+1:]...)
+				break
+			}
+		}
+		if len(lines) == 0 {
+			delete(unstoredOutput.lines, taskID)
+		} else {
+			unstoredOutput.lines[taskID] = lines
+		}
+		unstoredOutput.lock.Unlock()
+
 		util.LogPanicWithFields(err, log.Fields{"error": "Failed to insert task output"})
 	}()
 }
 
+// UnstoredOutput returns the output lines of the task after seq which are still being inserted
+func UnstoredOutput(taskID int, seq int64) []db.TaskOutput {
+	unstoredOutput.lock.Lock()
+	defer unstoredOutput.lock.Unlock()
+
+	var lines []db.TaskOutput
+	for _, line := range unstoredOutput.lines[taskID] {
+		if line.Seq > seq {
+			lines = append(lines, db.TaskOutput{
+				TaskID: taskID,
+				Time:   line.Time,
+				Output: line.Output,
+				Diff:   line.Diff,
+				Stream: line.Stream,
+				Seq:    line.Seq,
+			})
+		}
+	}
+
+	return lines
+}
+
+// setStatus moves the task to status and writes it. Transitions db.ValidTaskTransition doesn't allow
+// are refused, so the status a task has stays a canonical one
+func (t *task) setStatus(status string) {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+
+	if !db.ValidTaskTransition(t.task.Status, status) {
+		log.Error("Task " + strconv.Itoa(t.task.ID) + " can't go from " + t.task.Status + " to " + status)
+		return
+	}
+
+	t.task.Status = status
+	t.writeStatus()
+}
+
+// status returns the status of the task, it is safe to call while the runner sets it
+func (t *task) status() string {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+
+	return t.task.Status
+}
+
+// updateStatus writes the status of the task again, with its start and end times
 func (t *task) updateStatus() {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+
+	t.writeStatus()
+}
+
+// writeStatus sends the status of the task to its users and stores it, the caller holds statusLock
+func (t *task) writeStatus() {
+	t.flushOutput()
+
 	for _, user := range t.users {
 		b, err := json.Marshal(&map[string]interface{}{
 			"type":       "update",
@@ -70,11 +264,59 @@ func Readln(r *bufio.Reader) (string, error) {
 	return string(ln), err
 }
 
-func (t *task) logPipe(reader *bufio.Reader) {
+// diffTracker recognizes the blocks of ansible-playbook --diff output in the lines of a pipe
+type diffTracker struct {
+	inDiff bool
+}
+
+// diffEndPrefixes start the lines ansible prints after a diff block
+var diffEndPrefixes = []string{"TASK [", "PLAY ", "RUNNING HANDLER [", "changed:", "ok:", "skipping:", "fatal:", "failed:"}
+
+// isDiff reports whether the line is part of a diff block
+func (d *diffTracker) isDiff(line string) bool {
+	if strings.HasPrefix(line, "--- before") {
+		d.inDiff = true
+		return true
+	}
+
+	if !d.inDiff {
+		return false
+	}
+
+	if len(strings.TrimSpace(line)) == 0 {
+		d.inDiff = false
+		return false
+	}
+
+	for _, prefix := range diffEndPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			d.inDiff = false
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchFailure records when a line of the playbook output matches the failure pattern of the template
+func (t *task) matchFailure(line string) {
+	if t.failurePattern == nil || !t.failurePattern.MatchString(line) {
+		return
+	}
+
+	t.outputLock.Lock()
+	t.failureMatched = true
+	t.outputLock.Unlock()
+}
+
+func (t *task) logPipe(reader *bufio.Reader, stream string) {
+	var diff diffTracker
 
 	line, err := Readln(reader)
 	for err == nil {
-		t.log(line)
+		t.matchFailure(line)
+		t.progress.applyOutput(line)
+		t.logOutput(line, diff.isDiff(line), stream)
 		line, err = Readln(reader)
 	}
 
@@ -89,8 +331,8 @@ func (t *task) logCmd(cmd *exec.Cmd) {
 	stderr, _ := cmd.StderrPipe()
 	stdout, _ := cmd.StdoutPipe()
 
-	go t.logPipe(bufio.NewReader(stderr))
-	go t.logPipe(bufio.NewReader(stdout))
+	go t.logPipe(bufio.NewReader(stderr), outputStderr)
+	go t.logPipe(bufio.NewReader(stdout), outputStdout)
 }
 
 func (t *task) panicOnError(err error, msg string) {
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/util"
+)
+
+const (
+	// logSinkBufferSize is the number of entries kept while the sink is busy, newer entries are dropped
+	logSinkBufferSize = 10000
+	// logSinkBatchSize is the maximum number of entries posted at once to the http sink
+	logSinkBatchSize = 100
+	// logSinkFlushInterval is the longest an entry waits before it is shipped
+	logSinkFlushInterval = time.Second
+	logSinkTimeout       = 10 * time.Second
+)
+
+// logSinkEntry is a line of task output shipped to the external log sink
+type logSinkEntry struct {
+	TaskID    int       `json:"task_id"`
+	ProjectID int       `json:"project_id"`
+	Time      time.Time `json:"time"`
+	Output    string    `json:"output"`
+	Stream    string    `json:"stream"`
+}
+
+// logSinkWriter ships entries to the external log sink
+type logSinkWriter interface {
+	write(entries []logSinkEntry) error
+}
+
+// logSink is nil when no sink is configured
+var logSink chan logSinkEntry
+
+// sendToLogSink queues a line of task output for the external log sink without blocking the task
+func sendToLogSink(entry logSinkEntry) {
+	if logSink == nil {
+		return
+	}
+
+	select {
+	case logSink <- entry:
+	default:
+		log.Warn("Log sink buffer is full, dropping output of task " + strconv.Itoa(entry.TaskID))
+	}
+}
+
+// startLogSink starts shipping task output to the configured sink
+func startLogSink() {
+	if len(util.Config.LogSink) == 0 {
+		return
+	}
+
+	writer, err := newLogSinkWriter(util.Config.LogSink, util.Config.LogSinkURL)
+	if err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Log sink is disabled"})
+		return
+	}
+
+	logSink = make(chan logSinkEntry, logSinkBufferSize)
+	go runLogSink(logSink, writer)
+}
+
+func newLogSinkWriter(sink string, sinkURL string) (logSinkWriter, error) {
+	switch sink {
+	case "http":
+		if len(sinkURL) == 0 {
+			return nil, errors.New("log_sink_url is required for the http log sink")
+		}
+
+		return httpLogSink{url: sinkURL, client: &http.Client{Timeout: logSinkTimeout}}, nil
+	case "syslog":
+		var network, addr string
+		if len(sinkURL) > 0 {
+			u, err := url.Parse(sinkURL)
+			if err != nil {
+				return nil, err
+			}
+			network, addr = u.Scheme, u.Host
+		}
+
+		return newSyslogLogSink(network, addr)
+	default:
+		return nil, errors.New("unknown log sink " + sink + ", expected http or syslog")
+	}
+}
+
+// runLogSink ships queued entries in batches. Failures are logged and the batch is dropped,
+// so a broken sink never holds up tasks
+func runLogSink(entries <-chan logSinkEntry, writer logSinkWriter) {
+	ticker := time.NewTicker(logSinkFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]logSinkEntry, 0, logSinkBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := writer.write(batch); err != nil {
+			util.LogWarningWithFields(err, log.Fields{"error": "Failed to ship task output to the log sink"})
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-entries:
+			batch = append(batch, entry)
+			if len(batch) >= logSinkBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// httpLogSink posts batches of entries as a json array
+type httpLogSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpLogSink) write(entries []logSinkEntry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("log sink responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return nil
+}
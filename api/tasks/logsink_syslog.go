@@ -0,0 +1,37 @@
+// +build !windows,!plan9
+
+package tasks
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// syslogLogSink writes every entry as a json syslog message
+type syslogLogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogLogSink(network string, addr string) (logSinkWriter, error) {
+	writer, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, "semaphore")
+	if err != nil {
+		return nil, err
+	}
+
+	return syslogLogSink{writer: writer}, nil
+}
+
+func (s syslogLogSink) write(entries []logSinkEntry) error {
+	for _, entry := range entries {
+		msg, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := s.writer.Info(string(msg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
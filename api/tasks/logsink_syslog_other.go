@@ -0,0 +1,9 @@
+// +build windows plan9
+
+package tasks
+
+import "errors"
+
+func newSyslogLogSink(network string, addr string) (logSinkWriter, error) {
+	return nil, errors.New("the syslog log sink is not supported on this platform")
+}
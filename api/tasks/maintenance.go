@@ -0,0 +1,55 @@
+package tasks
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaintenanceMessage is returned to tasks started in maintenance mode when no message was given
+const defaultMaintenanceMessage = "Semaphore is in maintenance, tasks can't be started"
+
+// Maintenance is the maintenance mode of the runner. While it is enabled no task is started:
+// the api refuses new tasks, schedules and hooks don't fire and queued tasks wait. Running tasks finish normally
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// maintenance is kept in memory only, a restart leaves maintenance mode
+var maintenance struct {
+	lock  sync.RWMutex
+	state Maintenance
+}
+
+// SetMaintenance enables or disables maintenance mode, message explains users why tasks are refused
+func SetMaintenance(enabled bool, message string) Maintenance {
+	maintenance.lock.Lock()
+	defer maintenance.lock.Unlock()
+
+	if !enabled {
+		maintenance.state = Maintenance{}
+		return maintenance.state
+	}
+
+	if len(message) == 0 {
+		message = defaultMaintenanceMessage
+	}
+
+	since := maintenance.state.Since
+	if since == nil {
+		now := time.Now()
+		since = &now
+	}
+
+	maintenance.state = Maintenance{Enabled: true, Message: message, Since: since}
+	return maintenance.state
+}
+
+// GetMaintenance returns the current maintenance mode
+func GetMaintenance() Maintenance {
+	maintenance.lock.RLock()
+	defer maintenance.lock.RUnlock()
+
+	return maintenance.state
+}
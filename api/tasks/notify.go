@@ -0,0 +1,156 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// sendTemplateNotifications notifies the targets of the template which are interested in the final status of the task
+func (t *task) sendTemplateNotifications() {
+	targets, err := db.ParseNotifications(t.template.Notifications)
+	if err != nil {
+		t.log("Can't parse template notifications: " + err.Error())
+		return
+	}
+
+	for _, target := range targets {
+		if !target.Wants(t.task.Status) {
+			continue
+		}
+
+		if len(target.Webhook) > 0 {
+			t.postWebhook(target.Webhook, nil)
+		}
+
+		if len(target.Email) > 0 {
+			t.sendNotificationEmail(target.Email)
+		}
+	}
+}
+
+func (t *task) sendNotificationEmail(email string) {
+	if !util.Config.EmailAlert {
+		t.log("Can't send notification to " + email + ", email alerts are disabled")
+		return
+	}
+
+	alert := Alert{
+		TaskID:  strconv.Itoa(t.task.ID),
+		Alias:   t.template.Alias,
+		TaskURL: util.Config.WebHost + "/project/" + strconv.Itoa(t.template.ProjectID),
+		Status:  t.task.Status,
+	}
+
+	t.log("Sending notification to " + email + " from " + util.Config.EmailSender)
+	if err := mailNotification(email, alert); err != nil {
+		t.log("Can't send notification to " + email + ": " + err.Error())
+	}
+}
+
+// mailNotification sends the localized notification email of the alert
+func mailNotification(email string, alert Alert) error {
+	tpl, err := template.New("notification body template").Parse(util.Localize(util.ConfigLanguage(), util.MsgNotificationEmail))
+	util.LogError(err)
+
+	var mailBuffer bytes.Buffer
+	if err := tpl.Execute(&mailBuffer, alert); err != nil {
+		return err
+	}
+
+	return util.SendMail(util.Config.EmailHost+":"+util.Config.EmailPort, util.Config.EmailSender, email, mailBuffer)
+}
+
+// NotificationTestResult is the outcome of sending a sample notification through a channel of the project
+type NotificationTestResult struct {
+	Channel string `json:"channel"`
+	Target  string `json:"target"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// testNotifications sends a sample notification through the channels of the project which are
+// configured, the email goes to the user testing them
+func testNotifications(project db.Project, user *db.User) []NotificationTestResult {
+	results := []NotificationTestResult{}
+	addResult := func(channel string, target string, err error) {
+		result := NotificationTestResult{Channel: channel, Target: target, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	alert := Alert{
+		TaskID:  "0",
+		Alias:   "Test notification",
+		TaskURL: util.Config.WebHost + "/project/" + strconv.Itoa(project.ID),
+		Status:  "test",
+	}
+
+	if util.Config.EmailAlert {
+		if len(user.Email) == 0 {
+			addResult("email", "", errors.New("you have no email address"))
+		} else {
+			addResult("email", user.Email, mailNotification(user.Email, alert))
+		}
+	}
+
+	if util.Config.TelegramAlert && project.Alert {
+		alert.ChatID = util.Config.TelegramChat
+		if project.AlertChat != "" {
+			alert.ChatID = project.AlertChat
+		}
+		addResult("telegram", alert.ChatID, postTelegramAlert(alert))
+	}
+
+	if project.WebhookURL != nil && len(*project.WebhookURL) > 0 {
+		headers, err := project.DecryptWebhookHeaders()
+		if err == nil {
+			secret := ""
+			if project.WebhookSecret != nil {
+				secret = *project.WebhookSecret
+			}
+
+			err = deliverWebhook(*project.WebhookURL, headers, secret, webhookPayload{
+				Event:     "test",
+				Timestamp: time.Now().Unix(),
+				ProjectID: project.ID,
+				TaskURL:   alert.TaskURL,
+			})
+		}
+		addResult("webhook", *project.WebhookURL, err)
+	}
+
+	return results
+}
+
+// TestNotifications sends a sample notification through the configured channels of the project
+// and returns whether each delivery succeeded
+func TestNotifications(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+
+	results := testNotifications(project, user)
+	if len(results) == 0 {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNoNotificationChannels, nil)
+		return
+	}
+
+	success := true
+	for _, result := range results {
+		success = success && result.Success
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": success,
+		"results": results,
+	})
+}
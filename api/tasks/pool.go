@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"strconv"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -9,19 +10,26 @@ import (
 )
 
 type taskPool struct {
-	queue       []*task
-	register    chan *task
-	activeProj  map[int]*task
-	activeNodes map[string]*task
-	running     int
+	// queueLock guards queue and runningTasks, which are read outside of the pool goroutine
+	queueLock    sync.RWMutex
+	queue        []*task
+	runningTasks map[int]*task
+	register     chan *task
+	activeProj   map[int]*task
+	activeNodes  map[string]*task
+	// tasks holding the resource of their template, which is shared across projects
+	activeResources map[string]*task
+	running         int
 }
 
 var pool = taskPool{
-	queue:       make([]*task, 0),
-	register:    make(chan *task),
-	activeProj:  make(map[int]*task),
-	activeNodes: make(map[string]*task),
-	running:     0,
+	queue:           make([]*task, 0),
+	runningTasks:    make(map[int]*task),
+	register:        make(chan *task),
+	activeProj:      make(map[int]*task),
+	activeNodes:     make(map[string]*task),
+	activeResources: make(map[string]*task),
+	running:         0,
 }
 
 type resourceLock struct {
@@ -56,6 +64,10 @@ func (p *taskPool) run() {
 					p.activeNodes[node] = t
 				}
 
+				if len(t.resource) > 0 {
+					p.activeResources[t.resource] = t
+				}
+
 				p.running++
 				continue
 			}
@@ -68,6 +80,10 @@ func (p *taskPool) run() {
 				delete(p.activeNodes, node)
 			}
 
+			if len(t.resource) > 0 && p.activeResources[t.resource] == t {
+				delete(p.activeResources, t.resource)
+			}
+
 			p.running--
 		}
 	}(resourceLocker)
@@ -75,43 +91,181 @@ func (p *taskPool) run() {
 	for {
 		select {
 		case task := <-p.register:
+			p.queueLock.Lock()
 			p.queue = append(p.queue, task)
+			p.queueLock.Unlock()
 			log.Debug(task)
 			msg := "Task " + strconv.Itoa(task.task.ID) + " added to queue"
 			task.log(msg)
 			log.Info(msg)
 		case <-ticker.C:
-			if len(p.queue) == 0 {
+			p.removeStopped()
+
+			// in maintenance mode queued tasks wait, running ones finish
+			if len(p.queue) == 0 || GetMaintenance().Enabled {
 				continue
 			}
 
 			//get task from top of queue
 			t := p.queue[0]
-			if t.task.Status == taskFailStatus {
+			if t.status() == taskFailStatus {
 				//delete failed task from queue
-				p.queue = p.queue[1:]
+				p.dequeue()
 				log.Info("Task " + strconv.Itoa(t.task.ID) + " removed from queue")
 				continue
 			}
-			if p.blocks(t) {
-				//move blocked task to end of queue
+			if !acceptsRunnerTag(t.task.RunnerTag) {
+				//leave tasks for another runner in the queue
+				p.queueLock.Lock()
+				p.queue = append(p.queue[1:], t)
+				p.queueLock.Unlock()
+				continue
+			}
+			if p.blocks(t) || time.Now().Before(t.notBefore) {
+				//move blocked or delayed task to end of queue
+				p.queueLock.Lock()
+				t.blockedOn = p.blockingResource(t)
 				p.queue = append(p.queue[1:], t)
+				p.queueLock.Unlock()
 				continue
 			}
+			p.queueLock.Lock()
+			t.blockedOn = ""
+			p.queueLock.Unlock()
 			log.Info("Set resourse locker with task " + strconv.Itoa(t.task.ID))
 			resourceLocker <- &resourceLock{lock: true, holder: t}
 			if !t.prepared {
 				go t.prepareRun()
 				continue
 			}
+			p.queueLock.Lock()
+			p.runningTasks[t.task.ID] = t
+			p.queueLock.Unlock()
 			go t.run()
-			p.queue = p.queue[1:]
+			p.dequeue()
 			log.Info("Task " + strconv.Itoa(t.task.ID) + " removed from queue")
 		}
 	}
 }
 
+// dequeue removes the task from the top of the queue
+func (p *taskPool) dequeue() {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	p.queue = p.queue[1:]
+}
+
+// removeStopped drops the tasks which were stopped while waiting, so they don't take a slot.
+// A stopped task which is still preparing releases its resource lock when prepareRun returns
+func (p *taskPool) removeStopped() {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	queue := p.queue[:0]
+	for _, t := range p.queue {
+		if t.isStopped() {
+			log.Info("Stopped task " + strconv.Itoa(t.task.ID) + " removed from queue")
+			t.done()
+			continue
+		}
+		queue = append(queue, t)
+	}
+	p.queue = queue
+}
+
+// finished forgets a task once it has run
+func (p *taskPool) finished(t *task) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	delete(p.runningTasks, t.task.ID)
+}
+
+// find returns the queued or running task with the id, or nil if the runner doesn't know it
+func (p *taskPool) find(taskID int) *task {
+	p.queueLock.RLock()
+	defer p.queueLock.RUnlock()
+
+	if t, ok := p.runningTasks[taskID]; ok {
+		return t
+	}
+
+	for _, t := range p.queue {
+		if t.task.ID == taskID {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// queuePosition returns the 1-based position of a task in the queue, or nil if the task isn't queued
+func (p *taskPool) queuePosition(taskID int) *int {
+	p.queueLock.RLock()
+	defer p.queueLock.RUnlock()
+
+	position := 0
+	for _, t := range p.queue {
+		if t.status() == taskFailStatus || t.isStopped() {
+			continue
+		}
+
+		position++
+		if t.task.ID == taskID {
+			return &position
+		}
+	}
+
+	return nil
+}
+
+// blockedOn returns the resource a queued task waits for, or nil if it doesn't wait for one
+func (p *taskPool) blockedOn(taskID int) *string {
+	p.queueLock.RLock()
+	defer p.queueLock.RUnlock()
+
+	for _, t := range p.queue {
+		if t.task.ID == taskID && len(t.blockedOn) > 0 {
+			resource := t.blockedOn
+			return &resource
+		}
+	}
+
+	return nil
+}
+
+// acceptsRunnerTag reports whether this runner runs tasks with the runner tag, which it does
+// when the task has none or the runner advertises it in runner_tags
+func acceptsRunnerTag(tag *string) bool {
+	if tag == nil {
+		return true
+	}
+
+	for _, t := range util.Config.RunnerTags {
+		if t == *tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockingResource returns the resource of the task if another task holds it
+func (p *taskPool) blockingResource(t *task) string {
+	if len(t.resource) == 0 || p.activeResources[t.resource] == nil {
+		return ""
+	}
+
+	return t.resource
+}
+
 func (p *taskPool) blocks(t *task) bool {
+	// resources serialize tasks whatever the concurrency mode is
+	if len(p.blockingResource(t)) > 0 {
+		return true
+	}
+
 	if p.running >= util.Config.MaxParallelTasks {
 		return true
 	}
@@ -134,5 +288,6 @@ func (p *taskPool) blocks(t *task) bool {
 
 // StartRunner begins the task pool, used as a goroutine
 func StartRunner() {
+	startLogSink()
 	pool.run()
 }
@@ -0,0 +1,73 @@
+package tasks
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// preflight checks that everything a task of the template uses still exists, so a task isn't
+// queued just to fail while it is prepared. It returns a description of each missing resource
+func preflight(template db.Template, taskObj db.Task) []string {
+	var missing []string
+
+	checkKey := func(id int, usedBy string) {
+		var key db.AccessKey
+		err := db.Mysql.SelectOne(&key, "select * from access_key where id=? and (project_id=? or project_id is null)", id, template.ProjectID)
+		if err == sql.ErrNoRows || (err == nil && key.Removed) {
+			missing = append(missing, "access key "+strconv.Itoa(id)+" of "+usedBy)
+		} else if err != nil {
+			panic(err)
+		}
+	}
+
+	checkKey(template.SSHKeyID, "the template")
+
+	var repository db.Repository
+	err := db.Mysql.SelectOne(&repository, "select * from project__repository where id=? and project_id=?", template.RepositoryID, template.ProjectID)
+	if err == sql.ErrNoRows || (err == nil && repository.Removed) {
+		missing = append(missing, "repository "+strconv.Itoa(template.RepositoryID))
+	} else if err != nil {
+		panic(err)
+	} else {
+		checkKey(repository.SSHKeyID, "repository "+repository.Name)
+	}
+
+	inventoryIDs := taskObj.InventoryIDs
+	if len(inventoryIDs) == 0 && taskObj.Inventory == nil {
+		inventoryIDs = template.InventoryIDs()
+	}
+
+	for _, id := range inventoryIDs {
+		var inventory db.Inventory
+		err := db.Mysql.SelectOne(&inventory, "select * from project__inventory where id=? and project_id=?", id, template.ProjectID)
+		if err == sql.ErrNoRows || (err == nil && inventory.Removed) {
+			missing = append(missing, "inventory "+strconv.Itoa(id))
+			continue
+		} else if err != nil {
+			panic(err)
+		}
+
+		if inventory.KeyID != nil {
+			checkKey(*inventory.KeyID, "inventory "+inventory.Name)
+		}
+
+		if inventory.SSHKeyID != nil {
+			checkKey(*inventory.SSHKeyID, "inventory "+inventory.Name)
+		}
+	}
+
+	// an environment passed with the task replaces the one of the template
+	if len(taskObj.Environment) == 0 && template.EnvironmentID != nil {
+		var environment db.Environment
+		err := db.Mysql.SelectOne(&environment, "select * from project__environment where id=? and project_id=?", *template.EnvironmentID, template.ProjectID)
+		if err == sql.ErrNoRows || (err == nil && environment.Removed) {
+			missing = append(missing, "environment "+strconv.Itoa(*template.EnvironmentID))
+		} else if err != nil {
+			panic(err)
+		}
+	}
+
+	return missing
+}
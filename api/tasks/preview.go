@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// TaskPreview is what a task would run with, secrets are masked
+type TaskPreview struct {
+	// the extra vars passed to ansible, the effective vars with the semaphore var
+	Vars    map[string]interface{} `json:"vars"`
+	Command []string               `json:"command"`
+}
+
+// PreviewTask returns the variables and the command line a task with the given options would run with,
+// nothing is stored or run. The task id of the semaphore var is 0 and the commit is unknown
+func PreviewTask(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+
+	var body db.Task
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+	taskObj := requestedTask(body)
+
+	if !checkTask(w, r, project.ID, &taskObj) {
+		return
+	}
+
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", project.ID, taskObj.TemplateID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgTemplateNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	if !applyArguments(w, r, template, &taskObj) {
+		return
+	}
+
+	if !applySurvey(w, r, template, &taskObj) {
+		return
+	}
+
+	taskObj.Created = time.Now()
+	taskObj.Status = taskWaitingStatus
+	taskObj.Forks = effectiveForks(template, taskObj.Forks)
+	taskObj.UserID = &user.ID
+	taskObj.Initiator = db.TaskUserInitiator
+
+	t := &task{
+		task:      taskObj,
+		projectID: project.ID,
+		preview:   true,
+	}
+
+	if err := t.populateDetails(); err != nil {
+		// the reason was logged by the runner, the error itself is often only sql.ErrNoRows
+		msg := err.Error()
+		if len(t.previewLog) > 0 {
+			msg = t.previewLog[len(t.previewLog)-1]
+		}
+		util.WriteError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	command, err := t.maskedCommand()
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, TaskPreview{
+		Vars:    t.maskVars(t.extraVars()),
+		Command: command,
+	})
+}
@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"github.com/fiftin/semaphore/db"
+	"github.com/masterminds/squirrel"
+)
+
+// isProductionRun reports whether a task runs a production template or against a production inventory,
+// which are the inventories of the task or else the inventory of the template. A run with an inline inventory
+// counts as production when the inventory of its template is, the inline hosts may well be the production ones
+func isProductionRun(template db.Template, taskObj db.Task) (bool, error) {
+	if template.Production {
+		return true, nil
+	}
+
+	inventoryIDs := taskObj.InventoryIDs
+	if len(inventoryIDs) == 0 {
+		inventoryIDs = template.InventoryIDs()
+	}
+
+	query, args, err := squirrel.Select("count(1)").
+		From("project__inventory").
+		Where(squirrel.Eq{"id": inventoryIDs}).
+		Where("production=1").
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	count, err := db.Mysql.SelectInt(query, args...)
+	return count > 0, err
+}
+
+// productionRunConfirmed tells if the task confirms a production run, with the confirm flag
+// or with the name of the project typed in
+func productionRunConfirmed(project db.Project, taskObj db.Task) bool {
+	return taskObj.Confirm || (len(taskObj.ConfirmProject) > 0 && taskObj.ConfirmProject == project.Name)
+}
@@ -0,0 +1,89 @@
+package tasks
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// purgeInterval is how often the tasks beyond the keep last N policies are removed
+const purgeInterval = time.Hour
+
+// retainedTemplate is a template with the number of finished tasks it keeps,
+// its own keep_tasks or else the one of its project
+type retainedTemplate struct {
+	ID        int `db:"id"`
+	ProjectID int `db:"project_id"`
+	KeepTasks int `db:"keep_tasks"`
+}
+
+// StartPurger removes the finished tasks templates don't keep anymore, used as a goroutine
+func StartPurger() {
+	for {
+		purgeTasks()
+		time.Sleep(purgeInterval)
+	}
+}
+
+func purgeTasks() {
+	var templates []retainedTemplate
+	if _, err := db.Mysql.Select(&templates, "select pt.id, pt.project_id, coalesce(pt.keep_tasks, p.keep_tasks) as keep_tasks from project__template as pt join project as p on p.id=pt.project_id where coalesce(pt.keep_tasks, p.keep_tasks) is not null"); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot read the task retention of templates"})
+		return
+	}
+
+	for _, template := range templates {
+		deleted, err := purgeTemplateTasks(template)
+		if err != nil {
+			util.LogErrorWithFields(err, log.Fields{"error": "Cannot purge tasks of template " + strconv.Itoa(template.ID)})
+		}
+
+		if deleted == 0 {
+			continue
+		}
+
+		objType := "template"
+		desc := "Template ID " + strconv.Itoa(template.ID) + " purged " + strconv.Itoa(deleted) + " tasks beyond the last " + strconv.Itoa(template.KeepTasks)
+		if err := (db.Event{
+			ProjectID:   &template.ProjectID,
+			ObjectType:  &objType,
+			ObjectID:    &template.ID,
+			Description: &desc,
+		}.Insert()); err != nil {
+			util.LogErrorWithFields(err, log.Fields{"error": "Cannot write new event to database"})
+		}
+	}
+}
+
+// purgeTemplateTasks removes the finished tasks of a template older than the ones it keeps.
+// Waiting and running tasks are never removed and don't count towards the kept ones
+func purgeTemplateTasks(template retainedTemplate) (int, error) {
+	deleted := 0
+	for {
+		var rows []struct {
+			ID int `db:"id"`
+		}
+		if _, err := db.Mysql.Select(&rows, "select id from task where template_id=? and status not in (?, ?) order by created desc, id desc limit ? offset ?",
+			template.ID, taskWaitingStatus, taskRunningStatus, removeTasksBatchSize, template.KeepTasks); err != nil {
+			return deleted, err
+		}
+
+		if len(rows) == 0 {
+			return deleted, nil
+		}
+
+		taskIDs := make([]int, len(rows))
+		for i, row := range rows {
+			taskIDs[i] = row.ID
+		}
+
+		if err := deleteTasks(taskIDs); err != nil {
+			return deleted, err
+		}
+
+		deleted += len(taskIDs)
+	}
+}
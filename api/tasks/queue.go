@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiftin/semaphore/api/sockets"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// defaultQueueStatsWindow is the number of minutes the average wait is computed over by default
+const defaultQueueStatsWindow = 60
+
+// maxQueueStatsWindow is a week in minutes
+const maxQueueStatsWindow = 7 * 24 * 60
+
+// QueueStats describes the load of the task runner
+type QueueStats struct {
+	// tasks running ansible, tasks which are still preparing count as waiting
+	Running int `json:"running"`
+	Waiting int `json:"waiting"`
+	// max_parallel_tasks of the config
+	MaxParallelTasks int    `json:"max_parallel_tasks"`
+	ConcurrencyMode  string `json:"concurrency_mode"`
+	// runner_tags of the config, waiting tasks with another runner tag are left for other runners
+	RunnerTags []string `json:"runner_tags"`
+
+	// minutes the average wait is computed over
+	Window int `json:"window"`
+	// tasks started within the window and the average seconds they waited in the queue,
+	// null when none started. Automatic retries are left out as they wait retry_delay on purpose
+	Started     int      `json:"started"`
+	AverageWait *float64 `json:"average_wait"`
+
+	// websocket clients the task output is streamed to
+	Websockets sockets.Stats `json:"websockets"`
+}
+
+// stats counts the running tasks and the waiting ones, which are the tasks of the queue that weren't failed or stopped
+func (p *taskPool) stats() (running int, waiting int) {
+	p.queueLock.RLock()
+	defer p.queueLock.RUnlock()
+
+	for _, t := range p.queue {
+		if t.status() == taskFailStatus || t.isStopped() {
+			continue
+		}
+		waiting++
+	}
+
+	return len(p.runningTasks), waiting
+}
+
+// GetQueueStats returns the QueueStats of the runner, the window query parameter sets the minutes
+// the average wait is computed over. Only admins can see them
+func GetQueueStats(w http.ResponseWriter, r *http.Request) {
+	window := defaultQueueStatsWindow
+	if param := r.URL.Query().Get("window"); len(param) > 0 {
+		var err error
+		if window, err = strconv.Atoi(param); err != nil || window < 1 || window > maxQueueStatsWindow {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgQueueWindowRange, nil, maxQueueStatsWindow)
+			return
+		}
+	}
+
+	stats := QueueStats{
+		MaxParallelTasks: util.Config.MaxParallelTasks,
+		ConcurrencyMode:  util.Config.ConcurrencyMode,
+		RunnerTags:       util.Config.RunnerTags,
+		Window:           window,
+		Websockets:       sockets.GetStats(time.Now()),
+	}
+	stats.Running, stats.Waiting = pool.stats()
+
+	var wait struct {
+		Started     int             `db:"started"`
+		AverageWait sql.NullFloat64 `db:"average_wait"`
+	}
+	since := time.Now().Add(-time.Duration(window) * time.Minute)
+	if err := db.Mysql.SelectOne(&wait, "select count(1) as started, avg(timestampdiff(second, created, start)) as average_wait "+
+		"from task where start>=? and initiator!=?", since, db.TaskRetryInitiator); err != nil {
+		panic(err)
+	}
+
+	stats.Started = wait.Started
+	if wait.AverageWait.Valid {
+		stats.AverageWait = &wait.AverageWait.Float64
+	}
+
+	util.WriteJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// galaxyServerName is the name of the configured private server in the galaxy server list
+const galaxyServerName = "semaphore"
+
+// hasRequirements reports whether the template pins galaxy requirements
+func (t *task) hasRequirements() bool {
+	return t.template.RequirementsPath != nil || t.template.Requirements != nil
+}
+
+// getCollectionsPath returns the task local directory galaxy collections are installed into
+func (t *task) getCollectionsPath() string {
+	return util.Config.TmpPath + "/collections_" + strconv.Itoa(t.task.ID)
+}
+
+// getRequirementsPath returns the file the inline galaxy requirements of the template are written to
+func (t *task) getRequirementsPath() string {
+	return util.Config.TmpPath + "/requirements_" + strconv.Itoa(t.task.ID) + ".yml"
+}
+
+// removeRequirements removes the collections and the requirements file of the task once it finished
+func (t *task) removeRequirements() {
+	if !t.hasRequirements() {
+		return
+	}
+
+	util.LogWarning(os.RemoveAll(t.getCollectionsPath()))
+	if t.template.Requirements != nil {
+		if err := os.Remove(t.getRequirementsPath()); err != nil && !os.IsNotExist(err) {
+			util.LogWarning(err)
+		}
+	}
+}
+
+// installRequirements installs the galaxy requirements of the template into the task collections path
+func (t *task) installRequirements() error {
+	if !t.hasRequirements() {
+		return nil
+	}
+
+	repoDir := util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
+
+	var requirementsFile string
+	if t.template.RequirementsPath != nil {
+		requirementsFile = filepath.Join(repoDir, *t.template.RequirementsPath)
+	} else {
+		requirementsFile = t.getRequirementsPath()
+		if err := ioutil.WriteFile(requirementsFile, []byte(*t.template.Requirements), 0664); err != nil {
+			return err
+		}
+		if err := chownRunAs(requirementsFile); err != nil {
+			return err
+		}
+	}
+
+	t.log("installing galaxy requirements")
+
+	args := []string{
+		"collection",
+		"install",
+		"-r",
+		requirementsFile,
+		"-p",
+		t.getCollectionsPath(),
+		"--force",
+	}
+
+	cmd := exec.Command("ansible-galaxy", args...) //nolint: gas
+	runAs(cmd)
+	cmd.Dir = repoDir
+	cmd.Env = t.galaxyEnvVars(cmd.Dir)
+
+	t.logCmd(cmd)
+	return cmd.Run()
+}
+
+// galaxyEnvVars returns the environment of ansible-galaxy processes. When a private galaxy server
+// is configured it replaces the default server list, so the token never has to be written to disk
+func (t *task) galaxyEnvVars(pwd string) []string {
+	var gitSSHCommand *string
+	if t.repository.SSHKey.Type == "ssh" {
+		command := "ssh " + t.sshHostKeyOptions() + " -i " + t.repository.SSHKey.GetPath()
+		gitSSHCommand = &command
+	}
+	env := t.envVars(util.Config.TmpPath, pwd, gitSSHCommand)
+
+	if len(util.Config.GalaxyServerURL) == 0 {
+		return env
+	}
+
+	env = append(env,
+		"ANSIBLE_GALAXY_SERVER_LIST="+galaxyServerName,
+		"ANSIBLE_GALAXY_SERVER_"+strings.ToUpper(galaxyServerName)+"_URL="+util.Config.GalaxyServerURL)
+
+	if len(util.Config.GalaxyServerToken) > 0 {
+		env = append(env, "ANSIBLE_GALAXY_SERVER_"+strings.ToUpper(galaxyServerName)+"_TOKEN="+util.Config.GalaxyServerToken)
+	}
+
+	return env
+}
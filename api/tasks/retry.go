@@ -0,0 +1,235 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// getRetryFilesDir returns the directory ansible saves the retry file of the task to
+func (t *task) getRetryFilesDir() string {
+	return util.Config.TmpPath + "/retry_files_" + strconv.Itoa(t.task.ID)
+}
+
+// getRetryLimitPath returns the path of the file with the hosts a retry task is limited to
+func (t *task) getRetryLimitPath() string {
+	return util.Config.TmpPath + "/retry_" + strconv.Itoa(t.task.ID)
+}
+
+// retryFileName returns the name of the retry file ansible writes for a playbook
+func retryFileName(playbook string) string {
+	name := filepath.Base(playbook)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".retry"
+}
+
+// retryEnvVars makes ansible write the failed hosts of the run to the retry files dir of the task
+func (t *task) retryEnvVars() []string {
+	return []string{
+		"ANSIBLE_RETRY_FILES_ENABLED=True",
+		"ANSIBLE_RETRY_FILES_SAVE_PATH=" + t.getRetryFilesDir(),
+	}
+}
+
+// installRetryLimit writes the failed hosts of the retried task to the file the task is limited to
+func (t *task) installRetryLimit() error {
+	if t.task.RetryOf == nil {
+		return nil
+	}
+
+	// the retried task must be one of the project
+	hosts, err := db.Mysql.SelectStr("select task.retry_hosts from task join project__template as pt on pt.id=task.template_id "+
+		"where task.id=? and pt.project_id=?", *t.task.RetryOf, t.projectID)
+	if err != nil {
+		return err
+	}
+
+	if len(strings.TrimSpace(hosts)) == 0 {
+		return errors.New("task " + strconv.Itoa(*t.task.RetryOf) + " has no failed hosts")
+	}
+
+	t.log("Retrying the failed hosts of task " + strconv.Itoa(*t.task.RetryOf))
+	return ioutil.WriteFile(t.getRetryLimitPath(), []byte(hosts), 0664)
+}
+
+// storeRetryHosts stores the hosts of the retry file ansible wrote when the run failed,
+// and removes the retry files of the task
+func (t *task) storeRetryHosts(failed bool) {
+	dir := t.getRetryFilesDir()
+	defer func() {
+		util.LogWarning(os.RemoveAll(dir))
+		if t.task.RetryOf != nil {
+			util.LogWarning(os.Remove(t.getRetryLimitPath()))
+		}
+	}()
+
+	if !failed {
+		return
+	}
+
+	playbook := t.task.Playbook
+	if len(playbook) == 0 {
+		playbook = t.template.Playbook
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, retryFileName(playbook)))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		t.log("Can't read the retry file: " + err.Error())
+		return
+	}
+
+	hosts := strings.TrimSpace(string(content))
+	if len(hosts) == 0 {
+		return
+	}
+
+	t.task.RetryHosts = &hosts
+	if _, err := db.Mysql.Exec("update task set retry_hosts=? where id=?", t.task.RetryHosts, t.task.ID); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot store the retry hosts of the task"})
+	}
+}
+
+// RetryFailedTask queues a task which runs the failed task again, limited to the hosts which failed
+func RetryFailedTask(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	failed := context.Get(r, taskTypeID).(db.Task)
+
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", project.ID, failed.TemplateID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTaskNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	if failed.Status != taskFailStatus || failed.RetryHosts == nil || len(*failed.RetryHosts) == 0 {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgNoFailedHosts, nil)
+		return
+	}
+
+	// the body is optional, it only confirms retries of production runs
+	var confirm struct {
+		Confirm        bool   `json:"confirm"`
+		ConfirmProject string `json:"confirm_project"`
+	}
+	if r.ContentLength > 0 {
+		if err := util.Bind(w, r, &confirm); err != nil {
+			return
+		}
+	}
+
+	taskObj := db.Task{
+		TemplateID:   failed.TemplateID,
+		Debug:        failed.Debug,
+		DryRun:       failed.DryRun,
+		Diff:         failed.Diff,
+		Playbook:     failed.Playbook,
+		Environment:  failed.Environment,
+		Arguments:    failed.Arguments,
+		Env:          failed.Env,
+		Survey:       failed.Survey,
+		Forks:        failed.Forks,
+		RetryOf:      &failed.ID,
+		Labels:       failed.Labels,
+		InventoryIDs: failed.InventoryIDs,
+		Inventory:    failed.Inventory,
+
+		Confirm:        confirm.Confirm,
+		ConfirmProject: confirm.ConfirmProject,
+	}
+
+	startTask(w, r, project, template, taskObj)
+}
+
+// scheduleRetry queues the next attempt of a failed task while its template has retries left. The retry
+// waits retry_delay seconds in the queue, stopping it cancels the retries which would follow it
+func (t *task) scheduleRetry() {
+	if t.finished != nil || t.template.MaxRetries == nil || t.task.RetryCount >= *t.template.MaxRetries {
+		return
+	}
+
+	parentID := t.task.ID
+	if t.task.ParentID != nil {
+		parentID = *t.task.ParentID
+	}
+
+	retry := db.Task{
+		TemplateID:  t.task.TemplateID,
+		Status:      taskWaitingStatus,
+		Debug:       t.task.Debug,
+		DryRun:      t.task.DryRun,
+		Diff:        t.task.Diff,
+		Message:     t.task.Message,
+		Playbook:    t.task.Playbook,
+		Environment: t.task.Environment,
+		Arguments:   t.task.Arguments,
+		Env:         t.task.Env,
+		Survey:      t.task.Survey,
+		Limit:       t.task.Limit,
+		Inventory:   t.task.Inventory,
+		Forks:       t.task.Forks,
+		RetryOf:     t.task.RetryOf,
+		ParentID:    &parentID,
+		RetryCount:  t.task.RetryCount + 1,
+		UserID:      t.task.UserID,
+		Initiator:   db.TaskRetryInitiator,
+		Created:     time.Now(),
+	}
+
+	// the arguments are checked against the flags the template allows now, they may have been narrowed
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where id=?", t.task.TemplateID); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot queue the retry of task " + strconv.Itoa(t.task.ID)})
+		return
+	}
+
+	allowed, err := db.ParseAllowedArgs(template.AllowedArgs)
+	if err == nil {
+		err = checkAllowedArguments(allowed, retry.Arguments)
+	}
+	if err != nil {
+		t.log("Not retrying the task: " + err.Error())
+		return
+	}
+
+	labels, err := getTaskLabels([]int{t.task.ID})
+	if err == nil {
+		retry.InventoryIDs, err = getTaskInventoryIDs(t.task.ID)
+	}
+	if err == nil {
+		retry.Labels = labels[t.task.ID]
+		err = insertTask(&retry)
+	}
+	if err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot queue the retry of task " + strconv.Itoa(t.task.ID)})
+		return
+	}
+
+	delay := 0
+	if t.template.RetryDelay != nil {
+		delay = *t.template.RetryDelay
+	}
+
+	t.log("Retry " + strconv.Itoa(retry.RetryCount) + " of " + strconv.Itoa(*t.template.MaxRetries) + " queued as task " +
+		strconv.Itoa(retry.ID) + ", it runs in " + strconv.Itoa(delay) + " seconds")
+
+	enqueue(&task{
+		task:      retry,
+		projectID: t.projectID,
+		notBefore: time.Now().Add(time.Duration(delay) * time.Second),
+	})
+}
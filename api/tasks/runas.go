@@ -0,0 +1,35 @@
+// +build !windows,!plan9
+
+package tasks
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// runAs makes cmd run as the configured run_as_uid/run_as_gid, it does nothing when they are unset
+func runAs(cmd *exec.Cmd) {
+	if util.Config.RunAsUID == nil {
+		return
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid: uint32(*util.Config.RunAsUID),
+			Gid: uint32(*util.Config.RunAsGID),
+		},
+	}
+}
+
+// chownRunAs hands a file written by semaphore over to the configured run_as user,
+// so task processes which dropped privileges can still read it
+func chownRunAs(path string) error {
+	if util.Config.RunAsUID == nil {
+		return nil
+	}
+
+	return os.Chown(path, *util.Config.RunAsUID, *util.Config.RunAsGID)
+}
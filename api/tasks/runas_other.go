@@ -0,0 +1,12 @@
+// +build windows plan9
+
+package tasks
+
+import "os/exec"
+
+// runAs is not supported on this platform, the config validation rejects run_as_uid here
+func runAs(cmd *exec.Cmd) {}
+
+func chownRunAs(path string) error {
+	return nil
+}
@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -20,28 +23,98 @@ import (
 )
 
 const (
-	taskFailStatus = "error"
-	taskTypeID     = "task"
+	taskFailStatus    = db.TaskErrorStatus
+	taskWaitingStatus = db.TaskWaitingStatus
+	taskRunningStatus = db.TaskRunningStatus
+	taskSuccessStatus = db.TaskSuccessStatus
+	taskStoppedStatus = db.TaskStoppedStatus
+	taskTypeID        = "task"
 )
 
 type task struct {
-	task        db.Task
-	template    db.Template
-	sshKey      db.AccessKey
-	inventory   db.Inventory
-	repository  db.Repository
-	environment db.Environment
-	users       []int
-	projectID   int
-	hosts       []string
-	alertChat   string
-	alert       bool
-	prepared    bool
+	task          db.Task
+	template      db.Template
+	sshKey        db.AccessKey
+	inventories   []db.Inventory
+	repository    db.Repository
+	environment   db.Environment
+	users         []int
+	projectID     int
+	hosts         []string
+	env           map[string]string
+	vars          map[string]interface{}
+	secrets       []string
+	alertChat     string
+	webhookURL    string
+	webhookSecret string
+	alert         bool
+	prepared      bool
+	// custom headers of the project webhook, not sent to the webhooks of template notifications
+	webhookHeaders map[string]string
+	// names of the secret variables of the environment, masked in the stored vars
+	secretVars []string
+	// the pool doesn't start the task before, set for automatic retries which wait retry_delay
+	notBefore time.Time
+	// tasks completed and results by host of the running playbook
+	progress taskProgress
+	// resource of the template, read when the task is queued since the pool locks it before the task is prepared
+	resource string
+	// resource the queued task waits for, guarded by the queueLock of the pool
+	blockedOn string
+	// known_hosts of the project the host keys are verified against, empty leaves it to ansible
+	knownHosts string
+	// username of the user who started the task, passed to ansible in the semaphore var
+	username *string
+	// set for a task which is only previewed, it isn't stored and its output is kept in previewLog
+	preview    bool
+	previewLog []string
+
+	// statusLock guards the status of task, the pool and the stop endpoint read it while the runner sets it
+	statusLock sync.Mutex
+	// stopLock guards stopped and process, which are used by the stop endpoint
+	stopLock sync.Mutex
+	stopped  bool
+	// the running ansible-playbook process
+	process *os.Process
+
+	// output lines waiting to be broadcast
+	output outputBuffer
+	// outputLock guards outputSize, the bytes of output stored so far, task.OutputTruncated and failureMatched
+	outputLock sync.Mutex
+	outputSize int
+	// logLock guards outputSeq, the sequence number of the last output line
+	logLock   sync.Mutex
+	outputSeq int64
+	// the failure pattern of the template, set while the playbook runs
+	failurePattern *regexp.Regexp
+	// whether a line of the playbook output matched failurePattern
+	failureMatched bool
+	// receives the output as well when the task is run from the command line
+	stdout io.Writer
+	// closed once the task is done with, if set
+	finished     chan struct{}
+	finishedOnce sync.Once
+}
+
+// done signals a waiting RunTask that the task won't run anymore
+func (t *task) done() {
+	if t.finished == nil {
+		return
+	}
+
+	t.finishedOnce.Do(func() {
+		close(t.finished)
+	})
 }
 
 func (t *task) fail() {
-	t.task.Status = taskFailStatus
-	t.updateStatus()
+	if t.isStopped() {
+		t.setStatus(taskStoppedStatus)
+		return
+	}
+
+	t.setStatus(taskFailStatus)
+	t.scheduleRetry()
 	t.sendMailAlert()
 	t.sendTelegramAlert()
 }
@@ -64,11 +137,22 @@ func (t *task) prepareRun() {
 		}.Insert()); err != nil {
 			t.panicOnError(err, "Fatal error inserting an event")
 		}
+
+		if t.task.Status == taskFailStatus || t.task.Status == taskStoppedStatus {
+			t.removeRequirements()
+			t.removeKnownHosts()
+			t.sendWebhook()
+			t.sendTemplateNotifications()
+			t.done()
+		}
 	}()
 
 	t.log("Preparing: " + strconv.Itoa(t.task.ID))
 
 	err := checkTmpDir(util.Config.TmpPath)
+	if err == nil {
+		err = chownRunAs(util.Config.TmpPath)
+	}
 	if err != nil {
 		t.log("Creating tmp dir failed: " + err.Error())
 		t.fail()
@@ -81,6 +165,12 @@ func (t *task) prepareRun() {
 		return
 	}
 
+	if err := t.recordCommand(); err != nil {
+		t.log("Error: " + err.Error())
+		t.fail()
+		return
+	}
+
 	objType := taskTypeID
 	desc := "Task ID " + strconv.Itoa(t.task.ID) + " (" + t.template.Alias + ")" + " is preparing"
 	if err := (db.Event{
@@ -95,6 +185,12 @@ func (t *task) prepareRun() {
 
 	t.log("Prepare task with template: " + t.template.Alias + "\n")
 
+	if err := t.installKnownHosts(); err != nil {
+		t.log("Failed installing the known hosts of the project: " + err.Error())
+		t.fail()
+		return
+	}
+
 	if err := t.installKey(t.repository.SSHKey); err != nil {
 		t.log("Failed installing ssh key for repository access: " + err.Error())
 		t.fail()
@@ -107,18 +203,42 @@ func (t *task) prepareRun() {
 		return
 	}
 
+	if err := t.storeCommit(); err != nil {
+		t.log("Failed reading the checked out commit: " + err.Error())
+		t.fail()
+		return
+	}
+
+	if err := t.verifyCommitSignature(); err != nil {
+		t.log("Verifying the commit signature failed: " + err.Error())
+		t.fail()
+		return
+	}
+
 	if err := t.installInventory(); err != nil {
 		t.log("Failed to install inventory: " + err.Error())
 		t.fail()
 		return
 	}
 
+	if err := t.installRetryLimit(); err != nil {
+		t.log("Failed to install the retry limit: " + err.Error())
+		t.fail()
+		return
+	}
+
 	if err := t.runGalaxy(); err != nil {
 		t.log("Running galaxy failed: " + err.Error())
 		t.fail()
 		return
 	}
 
+	if err := t.installRequirements(); err != nil {
+		t.log("Installing galaxy requirements failed: " + err.Error())
+		t.fail()
+		return
+	}
+
 	// todo: write environment
 
 	if stderr, err := t.listPlaybookHosts(); err != nil {
@@ -132,6 +252,7 @@ func (t *task) prepareRun() {
 
 func (t *task) run() {
 	defer func() {
+		pool.finished(t)
 		log.Info("Stopped running task " + strconv.Itoa(t.task.ID))
 		log.Info("Release resourse locker with task " + strconv.Itoa(t.task.ID))
 		resourceLocker <- &resourceLock{lock: false, holder: t}
@@ -151,14 +272,17 @@ func (t *task) run() {
 			t.log("Fatal error inserting an event")
 			panic(err)
 		}
+
+		t.sendWebhook()
+		t.sendTemplateNotifications()
+		t.done()
 	}()
 
 	{
 		now := time.Now()
-		t.task.Status = "running"
 		t.task.Start = &now
 
-		t.updateStatus()
+		t.setStatus(taskRunningStatus)
 	}
 
 	objType := taskTypeID
@@ -176,14 +300,22 @@ func (t *task) run() {
 	t.log("Started: " + strconv.Itoa(t.task.ID))
 	t.log("Run task with template: " + t.template.Alias + "\n")
 
-	if err := t.runPlaybook(); err != nil {
+	err := t.runPlaybook()
+	err = t.applySuccessCriteria(err)
+	t.storeRetryHosts(err != nil)
+	t.removeRequirements()
+	t.removeKnownHosts()
+	t.storeProgress()
+	// reports are often most useful when the run failed
+	t.collectArtifacts()
+
+	if err != nil {
 		t.log("Running playbook failed: " + err.Error())
 		t.fail()
 		return
 	}
 
-	t.task.Status = "success"
-	t.updateStatus()
+	t.setStatus(taskSuccessStatus)
 }
 
 func (t *task) fetch(errMsg string, ptr interface{}, query string, args ...interface{}) error {
@@ -194,7 +326,9 @@ func (t *task) fetch(errMsg string, ptr interface{}, query string, args ...inter
 	}
 
 	if err != nil {
-		t.fail()
+		if !t.preview {
+			t.fail()
+		}
 		panic(err)
 	}
 
@@ -209,12 +343,31 @@ func (t *task) populateDetails() error {
 	}
 
 	var project db.Project
-	// get project alert setting
-	if err := t.fetch("Alert setting not found!", &project, "select alert, alert_chat from project where id=?", t.template.ProjectID); err != nil {
+	// get project alert setting, webhook and vars
+	if err := t.fetch("Alert setting not found!", &project, "select alert, alert_chat, webhook_url, webhook_secret, webhook_headers, vars, known_hosts from project where id=?", t.template.ProjectID); err != nil {
 		return err
 	}
 	t.alert = project.Alert
 	t.alertChat = project.AlertChat
+	if project.KnownHosts != nil {
+		t.knownHosts = *project.KnownHosts
+	}
+	if project.WebhookURL != nil {
+		t.webhookURL = *project.WebhookURL
+	}
+	if project.WebhookSecret != nil {
+		t.webhookSecret = *project.WebhookSecret
+		t.addSecret(t.webhookSecret)
+	}
+	headers, err := project.DecryptWebhookHeaders()
+	if err != nil {
+		t.log("Webhook headers can't be decrypted: " + err.Error())
+		return err
+	}
+	t.webhookHeaders = headers
+	for _, val := range headers {
+		t.addSecret(val)
+	}
 
 	// get project users
 	var users []struct {
@@ -239,23 +392,42 @@ func (t *task) populateDetails() error {
 		return errors.New("unsupported SSH Key")
 	}
 
-	// get inventory
-	if err := t.fetch("Template Inventory not found!", &t.inventory, "select * from project__inventory where id=?", t.template.InventoryID); err != nil {
-		return err
-	}
-
-	// get inventory services key
-	if t.inventory.KeyID != nil {
-		if err := t.fetch("Inventory AccessKey not found!", &t.inventory.Key, "select * from access_key where id=?", *t.inventory.KeyID); err != nil {
+	// get inventories, the ones chosen for the task or else the template inventory
+	inventoryIDs := t.task.InventoryIDs
+	if !t.preview {
+		if inventoryIDs, err = getTaskInventoryIDs(t.task.ID); err != nil {
 			return err
 		}
 	}
+	if len(inventoryIDs) == 0 && t.task.Inventory == nil {
+		inventoryIDs = t.template.InventoryIDs()
+	}
 
-	// get inventory ssh key
-	if t.inventory.SSHKeyID != nil {
-		if err := t.fetch("Inventory Ssh Key not found!", &t.inventory.SSHKey, "select * from access_key where id=?", *t.inventory.SSHKeyID); err != nil {
+	t.inventories = make([]db.Inventory, len(inventoryIDs))
+	for i, inventoryID := range inventoryIDs {
+		inventory := &t.inventories[i]
+		if err := t.fetch("Inventory not found!", inventory, "select * from project__inventory where id=?", inventoryID); err != nil {
 			return err
 		}
+
+		// get inventory services key
+		if inventory.KeyID != nil {
+			if err := t.fetch("Inventory AccessKey not found!", &inventory.Key, "select * from access_key where id=?", *inventory.KeyID); err != nil {
+				return err
+			}
+		}
+
+		// get inventory ssh key
+		if inventory.SSHKeyID != nil {
+			if err := t.fetch("Inventory Ssh Key not found!", &inventory.SSHKey, "select * from access_key where id=?", *inventory.SSHKeyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// inline inventories are installed like static ones
+	if t.task.Inventory != nil {
+		t.inventories = []db.Inventory{{Name: "inline", ProjectID: t.projectID, Type: "static", Inventory: *t.task.Inventory}}
 	}
 
 	// get repository
@@ -267,8 +439,8 @@ func (t *task) populateDetails() error {
 	if err := t.fetch("Repository Access Key not found!", &t.repository.SSHKey, "select * from access_key where id=?", t.repository.SSHKeyID); err != nil {
 		return err
 	}
-	if t.repository.SSHKey.Type != "ssh" {
-		t.log("Repository Access Key is not 'SSH': " + t.repository.SSHKey.Type)
+	if t.repository.SSHKey.Type != "ssh" && t.repository.SSHKey.Type != "login_password" {
+		t.log("Repository Access Key is not 'SSH' or login/password: " + t.repository.SSHKey.Type)
 		return errors.New("unsupported SSH Key")
 	}
 
@@ -282,31 +454,145 @@ func (t *task) populateDetails() error {
 		t.environment.JSON = t.task.Environment
 	}
 
+	// get os environment variables, task values override template values
+	env, err := db.ParseEnv(t.template.Env)
+	if err != nil {
+		t.log("Template env is not a valid JSON object")
+		return err
+	}
+
+	taskEnv, err := db.ParseEnv(t.task.Env)
+	if err != nil {
+		t.log("Task env is not a valid JSON object")
+		return err
+	}
+
+	for key, val := range taskEnv {
+		env[key] = val
+	}
+
+	t.env = env
+	for _, val := range t.env {
+		t.addSecret(val)
+	}
+	t.addSecret(util.Config.GalaxyServerToken)
+
+	vars, err := t.getEffectiveVars(project.Vars)
+	if err != nil {
+		return err
+	}
+
+	if !util.Config.DisableTaskVars {
+		if _, ok := vars[taskVarsKey]; ok {
+			t.log("The variable " + taskVarsKey + " is replaced by the metadata of the task")
+		}
+
+		if t.task.UserID != nil {
+			username, err := db.Mysql.SelectStr("select username from user where id=?", *t.task.UserID)
+			if err != nil {
+				return err
+			}
+			t.username = &username
+		}
+	}
+
+	// the stored copy is shown in the task details, so secret values are masked
+	effectiveVars, err := json.Marshal(t.maskVars(vars))
+	if err != nil {
+		return err
+	}
+
+	t.vars = vars
+	varsJSON := string(effectiveVars)
+	t.task.Vars = &varsJSON
+
+	if t.preview {
+		return nil
+	}
+
+	if _, err := db.Mysql.Exec("update task set vars=? where id=?", t.task.Vars, t.task.ID); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (t *task) installKey(key db.AccessKey) error {
 	t.log("access key " + key.Name + " installed")
+	util.LogWarning(key.MarkUsed())
 
 	path := key.GetPath()
+	if key.Type == "login_password" {
+		return t.installLoginPassword(key)
+	}
+
 	if key.Key != nil {
 		if err := ioutil.WriteFile(path+"-cert.pub", []byte(*key.Key), 0600); err != nil {
 			return err
 		}
+		if err := chownRunAs(path + "-cert.pub"); err != nil {
+			return err
+		}
 	}
 
-	return ioutil.WriteFile(path, []byte(*key.Secret), 0600)
+	if err := ioutil.WriteFile(path, []byte(*key.Secret), 0600); err != nil {
+		return err
+	}
+
+	return chownRunAs(path)
+}
+
+// installLoginPassword writes the credentials of a login_password key as an extra vars file,
+// which getPlaybookArgs passes to ansible instead of a private key
+func (t *task) installLoginPassword(key db.AccessKey) error {
+	login, password, err := key.LoginPassword()
+	if err != nil {
+		return err
+	}
+	t.addSecret(password)
+
+	vars, err := json.Marshal(map[string]string{
+		"ansible_user":     login,
+		"ansible_password": password,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(key.GetPath(), vars, 0600); err != nil {
+		return err
+	}
+
+	return chownRunAs(key.GetPath())
+}
+
+// gitEnvVars returns the environment of git processes, which authenticate with the repository key
+func (t *task) gitEnvVars() ([]string, error) {
+	if t.repository.SSHKey.Type != "ssh" {
+		env := t.envVars(util.Config.TmpPath, util.Config.TmpPath, nil)
+		credentialEnv, err := t.repository.SSHKey.GitCredentialEnv()
+		return append(env, credentialEnv...), err
+	}
+
+	gitSSHCommand := "ssh " + t.sshHostKeyOptions() + " -i " + t.repository.SSHKey.GetPath() + t.repository.SSHProxyOptions()
+	return t.envVars(util.Config.TmpPath, util.Config.TmpPath, &gitSSHCommand), nil
 }
 
 func (t *task) updateRepository() error {
+	env, err := t.gitEnvVars()
+	if err != nil {
+		return err
+	}
+
 	repoName := "repository_" + strconv.Itoa(t.repository.ID)
-	_, err := os.Stat(util.Config.TmpPath + "/" + repoName)
+	_, err = os.Stat(util.Config.TmpPath + "/" + repoName)
 
 	cmd := exec.Command("git") //nolint: gas
+	runAs(cmd)
+	cmd.Args = append(cmd.Args, t.repository.GitProxyArgs()...)
+	cmd.Args = append(cmd.Args, t.repository.SSHKey.GitCredentialArgs()...)
 	cmd.Dir = util.Config.TmpPath
-
-	gitSSHCommand := "ssh -o StrictHostKeyChecking=no -i " + t.repository.SSHKey.GetPath()
-	cmd.Env = t.envVars(util.Config.TmpPath, util.Config.TmpPath, &gitSSHCommand)
+	cmd.Env = env
 
 	repoURL, repoTag := t.repository.GitURL, "master"
 	if split := strings.Split(repoURL, "#"); len(split) > 1 {
@@ -318,6 +604,8 @@ func (t *task) updateRepository() error {
 		cmd.Args = append(cmd.Args, "clone", "--recursive", "--branch", repoTag, repoURL, repoName)
 	} else if err != nil {
 		return err
+	} else if t.repository.CachedClone {
+		return t.refreshCachedRepository(repoURL, repoTag, env)
 	} else {
 		t.log("Updating repository " + repoURL)
 		cmd.Dir += "/" + repoName
@@ -328,6 +616,87 @@ func (t *task) updateRepository() error {
 	return cmd.Run()
 }
 
+// refreshCachedRepository fetches the branch of the repository and only updates the working copy when
+// the branch moved since the last run. Otherwise the working copy is reused as it is
+func (t *task) refreshCachedRepository(repoURL string, repoTag string, env []string) error {
+	git := func(args ...string) *exec.Cmd {
+		cmd := exec.Command("git") //nolint: gas
+		runAs(cmd)
+		cmd.Args = append(cmd.Args, t.repository.GitProxyArgs()...)
+		cmd.Args = append(cmd.Args, t.repository.SSHKey.GitCredentialArgs()...)
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
+		cmd.Env = env
+		return cmd
+	}
+
+	t.log("Fetching repository " + repoURL)
+	fetch := git("fetch", "origin", repoTag)
+	t.logCmd(fetch)
+	if err := fetch.Run(); err != nil {
+		return err
+	}
+
+	head, err := git("rev-parse", "HEAD").Output()
+	if err != nil {
+		return err
+	}
+
+	fetched, err := git("rev-parse", "FETCH_HEAD").Output()
+	if err != nil {
+		return err
+	}
+
+	if string(head) == string(fetched) {
+		t.log("Repository unchanged at " + strings.TrimSpace(string(head)) + ", reusing the cached working copy")
+		return nil
+	}
+
+	t.log("Repository changed, refreshing the working copy to " + strings.TrimSpace(string(fetched)))
+	reset := git("reset", "--hard", "FETCH_HEAD")
+	t.logCmd(reset)
+	if err := reset.Run(); err != nil {
+		return err
+	}
+
+	submodules := git("submodule", "update", "--init", "--recursive")
+	t.logCmd(submodules)
+	return submodules.Run()
+}
+
+// maxCommitMessageLength is how many characters of the commit subject are stored with the task
+const maxCommitMessageLength = 100
+
+// storeCommit stores the commit the repository is checked out at and its subject with the task
+func (t *task) storeCommit() error {
+	cmd := exec.Command("git", "log", "-1", "--format=%H%n%s", "HEAD") //nolint: gas
+	runAs(cmd)
+	cmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
+	cmd.Env = t.envVars(util.Config.TmpPath, util.Config.TmpPath, nil)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)
+	hash := lines[0]
+	message := ""
+	if len(lines) > 1 {
+		message = lines[1]
+	}
+	if runes := []rune(message); len(runes) > maxCommitMessageLength {
+		message = string(runes[:maxCommitMessageLength])
+	}
+
+	t.task.CommitHash = &hash
+	t.task.CommitMessage = &message
+	t.log("Checked out commit " + hash + " " + message)
+
+	_, err = db.Mysql.Exec("update task set commit_hash=?, commit_message=? where id=?", hash, message, t.task.ID)
+	return err
+}
+
 func (t *task) runGalaxy() error {
 	args := []string{
 		"install",
@@ -339,10 +708,9 @@ func (t *task) runGalaxy() error {
 	}
 
 	cmd := exec.Command("ansible-galaxy", args...) //nolint: gas
+	runAs(cmd)
 	cmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
-
-	gitSSHCommand := "ssh -o StrictHostKeyChecking=no -i " + t.repository.SSHKey.GetPath()
-	cmd.Env = t.envVars(util.Config.TmpPath, cmd.Dir, &gitSSHCommand)
+	cmd.Env = t.galaxyEnvVars(cmd.Dir)
 
 	if _, err := os.Stat(cmd.Dir + "/roles/requirements.yml"); err != nil {
 		return nil
@@ -364,9 +732,15 @@ func (t *task) listPlaybookHosts() (string, error) {
 	}
 	args = append(args, "--list-hosts")
 
+	dir, err := t.getPlaybookDir()
+	if err != nil {
+		return "", err
+	}
+
 	cmd := exec.Command("ansible-playbook", args...) //nolint: gas
-	cmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
-	cmd.Env = t.envVars(util.Config.TmpPath, cmd.Dir, nil)
+	runAs(cmd)
+	cmd.Dir = dir
+	cmd.Env = t.ansibleEnvVars(util.Config.TmpPath, cmd.Dir)
 
 	var errb bytes.Buffer
 	cmd.Stderr = &errb
@@ -388,36 +762,189 @@ func (t *task) runPlaybook() error {
 	if err != nil {
 		return err
 	}
+
+	dir, err := t.getPlaybookDir()
+	if err != nil {
+		return err
+	}
+
+	if t.template.FailurePattern != nil {
+		if t.failurePattern, err = regexp.Compile(*t.template.FailurePattern); err != nil {
+			return err
+		}
+	}
+
 	cmd := exec.Command("ansible-playbook", args...) //nolint: gas
-	cmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
-	cmd.Env = t.envVars(util.Config.TmpPath, cmd.Dir, nil)
+	runAs(cmd)
+	cmd.Dir = dir
+	cmd.Env = append(t.ansibleEnvVars(util.Config.TmpPath, cmd.Dir), t.retryEnvVars()...)
+
+	if len(t.knownHosts) > 0 {
+		cmd.Env = append(cmd.Env, t.knownHostsEnvVars()...)
+	}
+
+	// without the callback plugin the progress is read from the output
+	if err := t.installEventsCallback(); err != nil {
+		t.log("Can't install the events callback plugin: " + err.Error())
+	} else {
+		cmd.Env = append(cmd.Env, t.eventsEnvVars()...)
+	}
 
 	t.logCmd(cmd)
 	cmd.Stdin = strings.NewReader("")
-	return cmd.Run()
+	if err := t.startProcess(cmd); err != nil {
+		util.LogWarning(os.RemoveAll(t.getEventsDir()))
+		return err
+	}
+
+	stopEvents := t.followEvents()
+	defer stopEvents()
+
+	return cmd.Wait()
 }
 
-//nolint: gocyclo
+// applySuccessCriteria decides the outcome of a playbook run with the success criteria of the template.
+// Exit codes the template counts as success are checked first, a match of the failure pattern then fails the task
+// whatever the exit code was
+func (t *task) applySuccessCriteria(err error) error {
+	successExitCodes, parseErr := db.ParseSuccessExitCodes(t.template.SuccessExitCodes)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	t.outputLock.Lock()
+	failureMatched := t.failureMatched
+	t.outputLock.Unlock()
+
+	err = playbookResult(err, successExitCodes, failureMatched)
+	if err != nil && failureMatched {
+		t.log("The output matched the failure pattern of the template")
+	}
+
+	return err
+}
+
+// playbookResult returns nil if a playbook run which ended with err counts as success
+func playbookResult(err error, successExitCodes []int, failureMatched bool) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		for _, code := range successExitCodes {
+			if exitErr.ExitCode() == code {
+				err = nil
+				break
+			}
+		}
+	}
+
+	if err == nil && failureMatched {
+		return errors.New("the output matched the failure pattern")
+	}
+
+	return err
+}
+
+// recordCommand logs the ansible-playbook command line of the task and stores it, with the secrets masked,
+// so failures can be reproduced by hand
+func (t *task) recordCommand() error {
+	command, err := t.maskedCommand()
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+
+	commandJSON, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	commandStr := string(commandJSON)
+	t.task.Command = &commandStr
+
+	t.log("Command: " + strings.Join(quoted, " "))
+
+	_, err = db.Mysql.Exec("update task set command=? where id=?", t.task.Command, t.task.ID)
+	return err
+}
+
+// maskedCommand returns the ansible-playbook command line of the task with the secrets masked.
+// The extra vars are masked before they are encoded, json escapes secrets differently than they were registered
+func (t *task) maskedCommand() ([]string, error) {
+	args, err := t.playbookArgs(t.maskVars(t.extraVars()))
+	if err != nil {
+		return nil, err
+	}
+
+	command := []string{"ansible-playbook"}
+	for _, arg := range args {
+		command = append(command, t.maskSecrets(arg))
+	}
+
+	return command, nil
+}
+
+// effectiveForks returns the --forks of a new task: its own value, else the one of the template,
+// else the configured default. Nil leaves the ansible default
+func effectiveForks(template db.Template, forks *int) *int {
+	if forks != nil {
+		return forks
+	}
+
+	if template.Forks != nil {
+		return template.Forks
+	}
+
+	if util.Config.DefaultForks > 0 {
+		defaultForks := util.Config.DefaultForks
+		return &defaultForks
+	}
+
+	return nil
+}
+
+// getPlaybookArgs returns the arguments of ansible-playbook
 func (t *task) getPlaybookArgs() ([]string, error) {
+	return t.playbookArgs(t.extraVars())
+}
+
+// playbookArgs returns the arguments of ansible-playbook with the given extra vars
+//nolint: gocyclo
+func (t *task) playbookArgs(extraVars map[string]interface{}) ([]string, error) {
 	playbookName := t.task.Playbook
 	if len(playbookName) == 0 {
 		playbookName = t.template.Playbook
 	}
 
-	var inventory string
-	switch t.inventory.Type {
-	case "file":
-		inventory = t.inventory.Inventory
-	default:
-		inventory = util.Config.TmpPath + "/inventory_" + strconv.Itoa(t.task.ID)
+	if !util.IsSubPath(playbookName) {
+		return nil, errors.New("playbook " + playbookName + " is outside of the repository")
 	}
 
-	args := []string{
-		"-i", inventory,
+	args := t.inventoryArgs()
+
+	// validateInventories ensures inventories with an ssh key share it
+	for _, inventory := range t.inventories {
+		if inventory.SSHKeyID == nil {
+			continue
+		}
+
+		if inventory.SSHKey.Type == "login_password" {
+			args = append(args, "--extra-vars", "@"+inventory.SSHKey.GetPath())
+		} else {
+			args = append(args, "--private-key="+inventory.SSHKey.GetPath())
+		}
+		break
+	}
+
+	if t.task.RetryOf != nil {
+		args = append(args, "--limit", "@"+t.getRetryLimitPath())
+	} else if t.task.Limit != nil {
+		args = append(args, "--limit", *t.task.Limit)
 	}
 
-	if t.inventory.SSHKeyID != nil {
-		args = append(args, "--private-key="+t.inventory.SSHKey.GetPath())
+	if t.task.Forks != nil {
+		args = append(args, "--forks", strconv.Itoa(*t.task.Forks))
 	}
 
 	if t.task.Debug {
@@ -428,20 +955,16 @@ func (t *task) getPlaybookArgs() ([]string, error) {
 		args = append(args, "--check")
 	}
 
-	if len(t.environment.JSON) > 0 {
-		var js map[string]interface{}
-		err := json.Unmarshal([]byte(t.environment.JSON), &js)
-		if err != nil {
-			t.log("JSON is not valid")
-			return nil, err
-		}
+	if t.task.Diff {
+		args = append(args, "--diff")
+	}
 
-		extraVar, err := removeCommandEnvironment(t.environment.JSON, js)
+	if len(extraVars) > 0 {
+		vars, err := json.Marshal(extraVars)
 		if err != nil {
-			t.log("Could not remove command environment, if existant it will be passed to --extra-vars. This is not fatal but be aware of side effects")
+			return nil, err
 		}
-
-		args = append(args, "--extra-vars", extraVar)
+		args = append(args, "--extra-vars", string(vars))
 	}
 
 	var templateExtraArgs []string
@@ -467,11 +990,30 @@ func (t *task) getPlaybookArgs() ([]string, error) {
 	} else {
 		args = append(args, templateExtraArgs...)
 		args = append(args, taskExtraArgs...)
-		args = append(args, playbookName)
+		args = append(args, filepath.Join(t.getRepositoryPath(), playbookName))
 	}
 	return args, nil
 }
 
+// getRepositoryPath returns the directory the repository is cloned into
+func (t *task) getRepositoryPath() string {
+	return util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
+}
+
+// getPlaybookDir returns the directory ansible-playbook runs in,
+// which is the template working directory inside of the repository
+func (t *task) getPlaybookDir() (string, error) {
+	if t.template.WorkingDirectory == nil {
+		return t.getRepositoryPath(), nil
+	}
+
+	if !util.IsSubPath(*t.template.WorkingDirectory) {
+		return "", errors.New("working directory " + *t.template.WorkingDirectory + " is outside of the repository")
+	}
+
+	return filepath.Join(t.getRepositoryPath(), *t.template.WorkingDirectory), nil
+}
+
 func (t *task) envVars(home string, pwd string, gitSSHCommand *string) []string {
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("HOME=%s", home))
@@ -488,6 +1030,22 @@ func (t *task) envVars(home string, pwd string, gitSSHCommand *string) []string
 	return env
 }
 
+// ansibleEnvVars returns the environment of ansible-playbook processes,
+// which in addition to envVars contains the collections path and the template and task env
+func (t *task) ansibleEnvVars(home string, pwd string) []string {
+	env := t.envVars(home, pwd, nil)
+
+	if t.hasRequirements() {
+		env = append(env, fmt.Sprintf("ANSIBLE_COLLECTIONS_PATHS=%s", t.getCollectionsPath()))
+	}
+
+	for key, val := range t.env {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+
+	return env
+}
+
 // extractCommandEnvironment unmarshalls a json string, extracts the ENV key from it and returns it as
 // []string where strings are in key=value format
 func extractCommandEnvironment(envJSON string) []string {
@@ -507,22 +1065,6 @@ func extractCommandEnvironment(envJSON string) []string {
 	return env
 }
 
-// removeCommandEnvironment removes the ENV key from task environments and returns the resultant json encoded string
-// which can be passed as the --extra-vars flag values
-func removeCommandEnvironment(envJSON string, envJs map[string]interface{}) (string, error) {
-	if _, ok := envJs["ENV"]; ok {
-		delete(envJs, "ENV")
-		ev, err := json.Marshal(envJs)
-		if err != nil {
-			return envJSON, err
-		}
-		envJSON = string(ev)
-	}
-
-	return envJSON, nil
-
-}
-
 // checkTmpDir checks to see if the temporary directory exists
 // and if it does not attempts to create it
 func checkTmpDir(path string) error {
@@ -1,10 +1,18 @@
 package tasks
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"math/rand"
 	"time"
 	"os"
+	"os/exec"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
 )
 
 
@@ -71,4 +79,369 @@ func randString(n int) string {
 		remain--
 	}
 	return string(b)
-}
\ No newline at end of file
+}
+func TestMaskSecrets(t *testing.T) {
+	tsk := task{}
+	tsk.addSecret("s3cr3t-value")
+	tsk.addSecret("abc")
+
+	masked := tsk.maskSecrets("token=s3cr3t-value abc")
+	if masked != "token="+secretMask+" abc" {
+		t.Fatal("secrets must be masked and short values left untouched, got: " + masked)
+	}
+}
+
+func TestPlaybookResult(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 2").Run()
+	if exitErr == nil {
+		t.Fatal("expected the command to fail")
+	}
+
+	if playbookResult(nil, nil, false) != nil {
+		t.Fatal("exit code 0 without a failure match must succeed")
+	}
+
+	if playbookResult(nil, nil, true) == nil {
+		t.Fatal("a failure pattern match must fail a run which exited with 0")
+	}
+
+	if playbookResult(exitErr, nil, false) == nil {
+		t.Fatal("a non-zero exit code must fail by default")
+	}
+
+	if playbookResult(exitErr, []int{4, 2}, false) != nil {
+		t.Fatal("an exit code counted as success must succeed")
+	}
+
+	if playbookResult(exitErr, []int{4, 2}, true) == nil {
+		t.Fatal("a failure pattern match must take precedence over success exit codes")
+	}
+
+	if playbookResult(exitErr, []int{4}, false) == nil {
+		t.Fatal("exit codes not counted as success must fail")
+	}
+
+	if playbookResult(errors.New("could not start"), []int{1, 2}, false) == nil {
+		t.Fatal("errors which aren't exit codes must fail")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"--forks":          "--forks",
+		"/tmp/inventory_1": "/tmp/inventory_1",
+		"":                 "''",
+		`{"a": "b"}`:       `'{"a": "b"}'`,
+		"it's":             `'it'\''s'`,
+		"web-*:!web-3":     "'web-*:!web-3'",
+	}
+
+	for arg, expected := range cases {
+		if quoted := shellQuote(arg); quoted != expected {
+			t.Fatal("expected " + arg + " to be quoted as " + expected + ", got " + quoted)
+		}
+	}
+}
+
+func TestGetEffectiveVars(t *testing.T) {
+	projectVars := `{"region": "project", "project_only": 1}`
+	inventoryVars := `{"region": "inventory", "user": "inventory", "zone": "first"}`
+	mergedInventoryVars := `{"zone": "second"}`
+
+	tsk := task{}
+	tsk.inventories = []db.Inventory{{Vars: &inventoryVars}, {}, {Vars: &mergedInventoryVars}}
+	tsk.environment.JSON = `{"user": "template", "ENV": {"AWS_PROFILE": "prod"}}`
+
+	vars, err := tsk.getEffectiveVars(&projectVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars["region"] != "inventory" {
+		t.Error("inventory vars should override project vars")
+	}
+
+	if vars["zone"] != "second" {
+		t.Error("vars of later inventories should override earlier ones")
+	}
+
+	if vars["user"] != "template" {
+		t.Error("template environment should override inventory vars")
+	}
+
+	if vars["project_only"] != float64(1) {
+		t.Error("project vars should be kept when not overridden")
+	}
+
+	if _, ok := vars["ENV"]; ok {
+		t.Error("ENV key should not be passed as a variable")
+	}
+}
+
+func TestPlaybookArgsTaskVars(t *testing.T) {
+	config := util.Config
+	defer func() { util.Config = config }()
+	util.Config = util.NewConfig()
+
+	commit := "0123abcd"
+	tsk := task{projectID: 3, vars: map[string]interface{}{"semaphore": "user", "region": "eu"}}
+	tsk.task.ID = 7
+	tsk.task.CommitHash = &commit
+	tsk.template.Playbook = "site.yml"
+
+	extraVars := func() map[string]interface{} {
+		args, err := tsk.getPlaybookArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vars := make(map[string]interface{})
+		for i, arg := range args {
+			if arg == "--extra-vars" {
+				if err := json.Unmarshal([]byte(args[i+1]), &vars); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return vars
+	}
+
+	vars := extraVars()
+	meta, ok := vars["semaphore"].(map[string]interface{})
+	if !ok || meta["task_id"] != float64(7) || meta["project_id"] != float64(3) || meta["commit"] != commit {
+		t.Errorf("The metadata of the task must replace the semaphore variable, got %v", vars["semaphore"])
+	}
+
+	if vars["region"] != "eu" {
+		t.Error("Other variables must be kept")
+	}
+
+	util.Config.DisableTaskVars = true
+	if vars = extraVars(); vars["semaphore"] != "user" {
+		t.Errorf("The semaphore variable must be kept when task vars are disabled, got %v", vars["semaphore"])
+	}
+}
+
+func TestPreviewLog(t *testing.T) {
+	tsk := task{preview: true}
+	tsk.addSecret("s3cret")
+	tsk.log("Inventory not found! s3cret")
+
+	if len(tsk.previewLog) != 1 || tsk.previewLog[0] != "Inventory not found! "+secretMask {
+		t.Errorf("The output of a preview must be kept masked, got %v", tsk.previewLog)
+	}
+}
+
+func TestRequestedTask(t *testing.T) {
+	retryOf, hosts, limit := 12, "web1", "web*"
+	taskObj := requestedTask(db.Task{
+		TemplateID: 3,
+		Limit:      &limit,
+		Status:     taskSuccessStatus,
+		RetryOf:    &retryOf,
+		RetryHosts: &hosts,
+		TasksDone:  5,
+	})
+
+	if taskObj.TemplateID != 3 || taskObj.Limit == nil || *taskObj.Limit != limit {
+		t.Error("The options of the task must be kept")
+	}
+
+	if taskObj.Status != "" || taskObj.RetryOf != nil || taskObj.RetryHosts != nil || taskObj.TasksDone != 0 {
+		t.Errorf("Fields owned by the server must be dropped, got %+v", taskObj)
+	}
+}
+
+func TestMaskedCommand(t *testing.T) {
+	config := util.Config
+	defer func() { util.Config = config }()
+	util.Config = util.NewConfig()
+	util.Config.DisableTaskVars = true
+
+	// json escapes the quote and the ampersand, and the short secret is too short to be registered
+	secret := `pa"ss&word`
+	tsk := task{vars: map[string]interface{}{"db_password": secret, "api_pin": "12", "region": "eu"}}
+	tsk.template.Playbook = "site.yml"
+	tsk.addSecret(secret)
+	tsk.secretVars = []string{"db_password", "api_pin"}
+
+	command, err := tsk.maskedCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, arg := range command {
+		if arg != "--extra-vars" {
+			continue
+		}
+
+		vars := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(command[i+1]), &vars); err != nil {
+			t.Fatal(err)
+		}
+		if vars["db_password"] != secretMask || vars["api_pin"] != secretMask || vars["region"] != "eu" {
+			t.Errorf("Secret variables must be masked, got %v", vars)
+		}
+		return
+	}
+
+	t.Error("The command must pass the extra vars")
+}
+
+func TestDiffTracker(t *testing.T) {
+	lines := []struct {
+		line string
+		diff bool
+	}{
+		{"TASK [copy config] ***", false},
+		{"--- before: /etc/app.conf", true},
+		{"+++ after: /etc/app.conf", true},
+		{"@@ -1 +1 @@", true},
+		{"-port=80", true},
+		{"+port=8080", true},
+		{"changed: [web1]", false},
+		{"", false},
+		{"+not a diff", false},
+	}
+
+	var tracker diffTracker
+	for _, l := range lines {
+		if tracker.isDiff(l.line) != l.diff {
+			t.Errorf("%q should have diff=%v", l.line, l.diff)
+		}
+	}
+}
+
+func TestRetryFileName(t *testing.T) {
+	names := map[string]string{
+		"site.yml":            "site.retry",
+		"deploy/app.yaml":     "app.retry",
+		"playbooks/db.backup": "db.retry",
+		"noext":               "noext.retry",
+	}
+
+	for playbook, expected := range names {
+		if name := retryFileName(playbook); name != expected {
+			t.Errorf("%q should have retry file %q, got %q", playbook, expected, name)
+		}
+	}
+}
+
+func TestMaskVars(t *testing.T) {
+	tsk := task{secretVars: []string{"db_password", "missing"}}
+
+	masked := tsk.maskVars(map[string]interface{}{"db_password": "pw", "region": "eu"})
+	if masked["db_password"] != secretMask || masked["region"] != "eu" {
+		t.Errorf("Only secret variables should be masked, got %v", masked)
+	}
+	if _, ok := masked["missing"]; ok {
+		t.Error("Secrets which aren't variables should not be added")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	stopped := &task{stopped: true}
+	failed := &task{}
+	failed.task.Status = taskFailStatus
+
+	p := taskPool{
+		queue:        []*task{{}, stopped, failed, {}},
+		runningTasks: map[int]*task{1: {}},
+	}
+
+	running, waiting := p.stats()
+	if running != 1 || waiting != 2 {
+		t.Errorf("Expected 1 running and 2 waiting tasks, got %d and %d", running, waiting)
+	}
+}
+
+func TestPoolResources(t *testing.T) {
+	holder := &task{resource: "db-migrate"}
+	waiting := &task{resource: "db-migrate", blockedOn: "db-migrate"}
+	waiting.task.ID = 2
+	other := &task{resource: "cache"}
+
+	p := taskPool{
+		queue:           []*task{waiting, other},
+		activeResources: map[string]*task{"db-migrate": holder},
+	}
+
+	if p.blockingResource(waiting) != "db-migrate" {
+		t.Error("A task must wait for the resource another task holds")
+	}
+
+	if p.blockingResource(other) != "" || p.blockingResource(&task{}) != "" {
+		t.Error("Tasks without a held resource must not wait for one")
+	}
+
+	if resource := p.blockedOn(2); resource == nil || *resource != "db-migrate" {
+		t.Errorf("Expected the waiting task to be blocked on db-migrate, got %v", resource)
+	}
+}
+
+func TestAcceptsRunnerTag(t *testing.T) {
+	config := util.Config
+	defer func() { util.Config = config }()
+
+	util.Config = util.NewConfig()
+	util.Config.RunnerTags = []string{"region=eu", "gpu"}
+
+	eu, us := "region=eu", "region=us"
+	if !acceptsRunnerTag(nil) || !acceptsRunnerTag(&eu) {
+		t.Error("Tasks without a runner tag or with an advertised one must be accepted")
+	}
+
+	if acceptsRunnerTag(&us) {
+		t.Error("Tasks with a runner tag the runner doesn't advertise must be left for another runner")
+	}
+}
+
+func TestGrepOutput(t *testing.T) {
+	var output []db.TaskOutput
+	for _, line := range []string{"a", "b", "match 1", "c", "d", "match 2", "e", "f", "g"} {
+		output = append(output, db.TaskOutput{Output: line})
+	}
+
+	contains := func(line string) bool {
+		return len(line) > 5 && line[:5] == "match"
+	}
+
+	lines := func(records []db.TaskOutput) string {
+		var s string
+		for _, r := range records {
+			s += r.Output + ","
+		}
+		return s
+	}
+
+	if got := lines(grepOutput(output, contains, 0)); got != "match 1,match 2," {
+		t.Errorf("unexpected matches %q", got)
+	}
+
+	// context around close matches must not repeat records
+	if got := lines(grepOutput(output, contains, 2)); got != "a,b,match 1,c,d,match 2,e,f," {
+		t.Errorf("unexpected matches with context %q", got)
+	}
+}
+
+func TestParseOutputRange(t *testing.T) {
+	for query, expected := range map[string][2]int64{
+		"":              {0, 0},
+		"from=10":       {10, 0},
+		"from=10&to=20": {10, 20},
+		"to=20":         {0, 20},
+	} {
+		r := httptest.NewRequest("GET", "/output?"+query, nil)
+		from, to, ok := parseOutputRange(httptest.NewRecorder(), r)
+		if !ok || from != expected[0] || to != expected[1] {
+			t.Errorf("%q: expected %v, got %d %d %v", query, expected, from, to, ok)
+		}
+	}
+
+	for _, query := range []string{"from=0", "from=x", "to=-1", "from=20&to=10"} {
+		w := httptest.NewRecorder()
+		if _, _, ok := parseOutputRange(w, httptest.NewRequest("GET", "/output?"+query, nil)); ok || w.Code != http.StatusBadRequest {
+			t.Errorf("%q must be rejected", query)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// scheduledTemplate is a schedule with the project of its template
+type scheduledTemplate struct {
+	TemplateID int     `db:"template_id"`
+	ProjectID  int     `db:"project_id"`
+	CronFormat string  `db:"cron_format"`
+	Timezone   *string `db:"timezone"`
+}
+
+// StartScheduler runs the tasks of template schedules, used as a goroutine
+func StartScheduler() {
+	// the minute each template was last run in, so a schedule never fires twice in a minute
+	fired := make(map[int]time.Time)
+
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+
+		runSchedules(time.Now().Truncate(time.Minute), fired)
+	}
+}
+
+func runSchedules(minute time.Time, fired map[int]time.Time) {
+	// schedules missed in maintenance mode or while the scheduler is paused don't fire afterwards
+	if GetMaintenance().Enabled || isSchedulerPaused() {
+		return
+	}
+
+	schedules, err := getSchedules()
+	if err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot read schedules"})
+		return
+	}
+
+	for _, schedule := range schedules {
+		cron, err := util.ParseCron(schedule.CronFormat)
+		if err != nil {
+			util.LogWarningWithFields(err, log.Fields{"template_id": schedule.TemplateID})
+			continue
+		}
+
+		loc, err := util.ScheduleLocation(schedule.Timezone)
+		if err != nil {
+			util.LogWarningWithFields(err, log.Fields{"template_id": schedule.TemplateID})
+			continue
+		}
+
+		if !cron.Matches(minute.In(loc)) || fired[schedule.TemplateID].Equal(minute) {
+			continue
+		}
+		fired[schedule.TemplateID] = minute
+
+		if err := runScheduledTask(schedule); err != nil {
+			util.LogErrorWithFields(err, log.Fields{"error": "Cannot run scheduled task of template " + strconv.Itoa(schedule.TemplateID)})
+		}
+	}
+}
+
+// getSchedules returns the schedules of the templates of unarchived projects
+func getSchedules() ([]scheduledTemplate, error) {
+	var schedules []scheduledTemplate
+	_, err := db.Mysql.Select(&schedules, "select s.template_id, s.cron_format, s.timezone, pt.project_id from project__template_schedule as s join project__template as pt on pt.id=s.template_id join project as p on p.id=pt.project_id where p.archived=0 order by s.template_id")
+	return schedules, err
+}
+
+// runScheduledTask queues a task of the template, with the defaults of its survey variables
+func runScheduledTask(schedule scheduledTemplate) error {
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where id=?", schedule.TemplateID); err != nil {
+		return err
+	}
+
+	if _, err := checkRequiredTemplate(template); err != nil {
+		return err
+	}
+
+	if window, err := checkRunWindow(template, time.Now()); err != nil {
+		return err
+	} else if window != nil {
+		return errors.New("schedule fired outside the run window of the template")
+	}
+
+	taskObj := db.Task{
+		TemplateID: template.ID,
+		Status:     taskWaitingStatus,
+		Initiator:  db.TaskScheduleInitiator,
+		Created:    time.Now(),
+		Forks:      effectiveForks(template, nil),
+	}
+
+	var err error
+	if taskObj.Survey, err = surveyDefaults(template); err != nil {
+		return err
+	}
+
+	if err := db.Mysql.Insert(&taskObj); err != nil {
+		return err
+	}
+
+	taskObj.Labels = []string{}
+	queueTask(taskObj, schedule.ProjectID)
+
+	return nil
+}
+
+// surveyDefaults returns the json survey values of a task started without user input,
+// it fails if a required survey variable has no default
+func surveyDefaults(template db.Template) (*string, error) {
+	survey, err := db.ParseSurveyVars(template.SurveyVars)
+	if err != nil {
+		return nil, err
+	}
+
+	values, fieldErrors := resolveSurvey(survey, nil)
+	if fieldErrors != nil {
+		js, _ := json.Marshal(fieldErrors)
+		return nil, errors.New("survey variables without defaults need a value: " + string(js))
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	js, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	str := string(js)
+	return &str, nil
+}
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// schedulerPause is the pause of the scheduler, kept in memory only like maintenance mode.
+// Schedules don't fire while it is paused, and the runs missed in the pause don't fire on resume
+var schedulerPause struct {
+	lock   sync.RWMutex
+	paused bool
+	since  *time.Time
+}
+
+// SchedulerState is the state of the scheduler with the schedules of the templates of unarchived projects
+type SchedulerState struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+	// schedules don't fire in maintenance mode either
+	Maintenance bool            `json:"maintenance"`
+	Schedules   []ScheduleState `json:"schedules"`
+}
+
+// ScheduleState is a schedule with the next time it fires in UTC, nil if the cron expression never matches
+type ScheduleState struct {
+	TemplateID int        `json:"template_id"`
+	ProjectID  int        `json:"project_id"`
+	CronFormat string     `json:"cron_format"`
+	Timezone   *string    `json:"timezone"`
+	NextRun    *time.Time `json:"next_run"`
+}
+
+// isSchedulerPaused reports whether schedules are paused
+func isSchedulerPaused() bool {
+	schedulerPause.lock.RLock()
+	defer schedulerPause.lock.RUnlock()
+
+	return schedulerPause.paused
+}
+
+// pauseScheduler pauses or resumes the scheduler, pausing it again keeps the time it was paused at
+func pauseScheduler(paused bool) {
+	schedulerPause.lock.Lock()
+	defer schedulerPause.lock.Unlock()
+
+	if !paused {
+		schedulerPause.paused = false
+		schedulerPause.since = nil
+		return
+	}
+
+	if !schedulerPause.paused {
+		now := time.Now()
+		schedulerPause.since = &now
+	}
+	schedulerPause.paused = true
+}
+
+// getSchedulerState returns the state of the scheduler and the next runs of the schedules at now
+func getSchedulerState(now time.Time) (SchedulerState, error) {
+	schedulerPause.lock.RLock()
+	state := SchedulerState{
+		Paused:      schedulerPause.paused,
+		Since:       schedulerPause.since,
+		Maintenance: GetMaintenance().Enabled,
+		Schedules:   []ScheduleState{},
+	}
+	schedulerPause.lock.RUnlock()
+
+	schedules, err := getSchedules()
+	if err != nil {
+		return state, err
+	}
+
+	for _, schedule := range schedules {
+		s := ScheduleState{
+			TemplateID: schedule.TemplateID,
+			ProjectID:  schedule.ProjectID,
+			CronFormat: schedule.CronFormat,
+			Timezone:   schedule.Timezone,
+		}
+
+		if cron, err := util.ParseCron(schedule.CronFormat); err == nil {
+			if loc, err := util.ScheduleLocation(schedule.Timezone); err == nil {
+				if next, ok := cron.Next(now.In(loc)); ok {
+					next = next.UTC()
+					s.NextRun = &next
+				}
+			}
+		}
+
+		state.Schedules = append(state.Schedules, s)
+	}
+
+	return state, nil
+}
+
+// GetSchedulerState returns whether the scheduler is paused and the next runs of the schedules, admins only
+func GetSchedulerState(w http.ResponseWriter, r *http.Request) {
+	state, err := getSchedulerState(time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, state)
+}
+
+// SetSchedulerPaused pauses or resumes the scheduler, admins only
+func SetSchedulerPaused(w http.ResponseWriter, r *http.Request) {
+	user := context.Get(r, "user").(*db.User)
+
+	var body struct {
+		Paused bool `json:"paused"`
+	}
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	pauseScheduler(body.Paused)
+	if body.Paused {
+		log.Warn(user.Username + " paused the scheduler")
+	} else {
+		log.Info(user.Username + " resumed the scheduler")
+	}
+
+	state, err := getSchedulerState(time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, state)
+}
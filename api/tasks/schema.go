@@ -0,0 +1,202 @@
+package tasks
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// surveySchema returns the JSON schema of the survey values of a template
+func surveySchema(survey []db.SurveyVar) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for _, v := range survey {
+		property := map[string]interface{}{
+			"type": v.Type,
+		}
+
+		if len(v.Description) > 0 {
+			property["description"] = v.Description
+		}
+
+		if v.Default != nil {
+			property["default"] = v.Default
+		}
+
+		if len(v.Choices) > 0 {
+			property["enum"] = v.Choices
+		}
+
+		properties[v.Name] = property
+
+		// resolveSurvey fills in the default of a required variable which isn't submitted
+		if v.Required && v.Default == nil {
+			required = append(required, v.Name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// taskSchema returns the JSON schema of the AddTask payload, with the survey of the template if one is given
+func taskSchema(template *db.Template, survey []db.SurveyVar) map[string]interface{} {
+	templateID := map[string]interface{}{
+		"type":    "integer",
+		"minimum": 1,
+	}
+	if template != nil {
+		templateID["const"] = template.ID
+	}
+
+	content := surveySchema(survey)
+	surveyProperty := map[string]interface{}{
+		"type":             "string",
+		"description":      "JSON object of the values of the survey variables of the template",
+		"contentMediaType": "application/json",
+		"contentSchema":    content,
+	}
+
+	required := []string{"template_id"}
+	if len(content["required"].([]string)) > 0 {
+		required = append(required, "survey")
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2019-09/schema",
+		"title":       "Task",
+		"description": "Payload which starts a task of a template",
+		"type":        "object",
+		"required":    required,
+		"properties": map[string]interface{}{
+			"template_id": templateID,
+			"debug":       map[string]interface{}{"type": "boolean"},
+			"dry_run":     map[string]interface{}{"type": "boolean", "description": "Runs ansible-playbook with --check"},
+			"diff":        map[string]interface{}{"type": "boolean", "description": "Runs ansible-playbook with --diff"},
+			"playbook": map[string]interface{}{
+				"type":        "string",
+				"description": "Playbook run instead of the one of the template, relative to the repository",
+			},
+			"environment": map[string]interface{}{
+				"type":             "string",
+				"description":      "JSON environment used instead of the one of the template",
+				"contentMediaType": "application/json",
+			},
+			"arguments": map[string]interface{}{
+				"type":             []string{"string", "null"},
+				"description":      "JSON array of extra arguments of ansible-playbook",
+				"contentMediaType": "application/json",
+			},
+			"args": map[string]interface{}{
+				"type":        "array",
+				"description": "Extra arguments of ansible-playbook as an array, can't be combined with arguments",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+			"env": map[string]interface{}{
+				"type":             []string{"string", "null"},
+				"description":      "JSON object of os environment variables, merged over the ones of the template",
+				"contentMediaType": "application/json",
+			},
+			"limit": map[string]interface{}{
+				"type":        []string{"string", "null"},
+				"description": "Host pattern the playbook is limited to, passed as --limit",
+			},
+			"forks": map[string]interface{}{
+				"type":    []string{"integer", "null"},
+				"minimum": 1,
+				"maximum": db.MaxForks,
+			},
+			"message": map[string]interface{}{
+				"type":      []string{"string", "null"},
+				"maxLength": maxTaskMessageLength,
+			},
+			"labels": map[string]interface{}{
+				"type":        "array",
+				"maxItems":    maxTaskLabels,
+				"uniqueItems": true,
+				"items": map[string]interface{}{
+					"type":      "string",
+					"minLength": 1,
+					"maxLength": maxTaskLabelLength,
+					"pattern":   labelRegexp.String(),
+				},
+			},
+			"inventory": map[string]interface{}{
+				"type":        []string{"string", "null"},
+				"maxLength":   db.MaxInlineInventorySize,
+				"description": "Inline ini or yaml inventory used instead of the one of the template, can't be combined with inventory_ids",
+			},
+			"inventory_ids": map[string]interface{}{
+				"type":        "array",
+				"maxItems":    maxTaskInventories,
+				"uniqueItems": true,
+				"items":       map[string]interface{}{"type": "integer"},
+			},
+			"external_id": map[string]interface{}{
+				"type":      []string{"string", "null"},
+				"maxLength": maxExternalIDLength,
+			},
+			"source": map[string]interface{}{
+				"type":      []string{"string", "null"},
+				"maxLength": maxExternalIDLength,
+			},
+			"override_run_window": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Lets admins start the task outside the run window of the template",
+			},
+			"confirm": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Confirms a run of a production template or inventory",
+			},
+			"confirm_project": map[string]interface{}{
+				"type":        "string",
+				"description": "Confirms a run of a production template or inventory when it is the name of the project",
+			},
+			"survey": surveyProperty,
+		},
+	}
+}
+
+// GetTaskSchema returns the JSON schema of the payload which starts a task. With template_id
+// the survey of that template is part of the schema
+func GetTaskSchema(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	param := r.URL.Query().Get("template_id")
+	if len(param) == 0 {
+		util.WriteJSON(w, http.StatusOK, taskSchema(nil, nil))
+		return
+	}
+
+	templateID, err := strconv.Atoi(param)
+	if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNotInteger, nil, "template_id")
+		return
+	}
+
+	var template db.Template
+	if err := db.Mysql.SelectOne(&template, "select * from project__template where project_id=? and id=?", project.ID, templateID); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgTemplateNotFound, nil)
+			return
+		}
+
+		panic(err)
+	}
+
+	survey, err := db.ParseSurveyVars(template.SurveyVars)
+	if err != nil {
+		panic(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, taskSchema(&template, survey))
+}
@@ -0,0 +1,68 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// getGnupgHome returns the gpg home the trusted keys of the repository are imported to for the task
+func (t *task) getGnupgHome() string {
+	return util.Config.TmpPath + "/gnupg_" + strconv.Itoa(t.task.ID)
+}
+
+// verifyCommitSignature fails if the repository requires signed commits and the checked out commit
+// isn't signed by one of its trusted keys. The keys are imported to a keyring of the task only,
+// so a valid signature can only come from them
+func (t *task) verifyCommitSignature() error {
+	if !t.repository.RequireSignature {
+		return nil
+	}
+
+	if t.repository.TrustedKeys == nil {
+		return errors.New("the repository requires signed commits but has no trusted keys")
+	}
+
+	home := t.getGnupgHome()
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return err
+	}
+	defer func() {
+		util.LogWarning(os.RemoveAll(home))
+	}()
+
+	if err := chownRunAs(home); err != nil {
+		return err
+	}
+
+	env := append(t.envVars(util.Config.TmpPath, util.Config.TmpPath, nil), "GNUPGHOME="+home)
+
+	importCmd := exec.Command("gpg", "--batch", "--import") //nolint: gas
+	runAs(importCmd)
+	importCmd.Env = env
+	importCmd.Stdin = strings.NewReader(*t.repository.TrustedKeys)
+	if out, err := importCmd.CombinedOutput(); err != nil {
+		t.log(string(out))
+		return errors.New("importing the trusted keys failed: " + err.Error())
+	}
+
+	verifyCmd := exec.Command("git", "verify-commit", "--verbose", "HEAD") //nolint: gas
+	runAs(verifyCmd)
+	verifyCmd.Dir = util.Config.TmpPath + "/repository_" + strconv.Itoa(t.repository.ID)
+	verifyCmd.Env = env
+
+	out, err := verifyCmd.CombinedOutput()
+	if len(out) > 0 {
+		t.log(strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		return errors.New("the checked out commit isn't signed by a trusted key of the repository")
+	}
+
+	t.log("The commit is signed by a trusted key")
+	return nil
+}
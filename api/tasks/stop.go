@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"os/exec"
+	"strconv"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+func (t *task) isStopped() bool {
+	t.stopLock.Lock()
+	defer t.stopLock.Unlock()
+
+	return t.stopped
+}
+
+// startProcess starts cmd unless the task was stopped, so stop can kill the process
+func (t *task) startProcess(cmd *exec.Cmd) error {
+	t.stopLock.Lock()
+	defer t.stopLock.Unlock()
+
+	if t.stopped {
+		return errors.New("task was stopped")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	t.process = cmd.Process
+	return nil
+}
+
+// stop kills the playbook of a running task. A task which has not started yet has no process,
+// it is marked as stopped right away and the pool drops it from the queue on its next tick
+func (t *task) stop() {
+	t.stopLock.Lock()
+	defer t.stopLock.Unlock()
+
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+
+	if t.process != nil {
+		t.log("Stopping task")
+		// run() marks the task as stopped once the playbook exits
+		util.LogWarning(t.process.Kill())
+		return
+	}
+
+	if t.status() == taskWaitingStatus {
+		t.log("Task stopped before it started")
+		t.setStatus(taskStoppedStatus)
+	}
+}
+
+// StopTask stops a waiting or running task
+func StopTask(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	taskObj := context.Get(r, taskTypeID).(db.Task)
+
+	if taskObj.Status != taskWaitingStatus && taskObj.Status != taskRunningStatus {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgStopFinishedTask, nil)
+		return
+	}
+
+	if t := pool.find(taskObj.ID); t != nil {
+		t.stop()
+	} else {
+		// the task is not known to the runner anymore, e.g. it was lost in a restart
+		lost := &task{task: taskObj, projectID: project.ID}
+		lost.setStatus(taskStoppedStatus)
+	}
+
+	objType := taskTypeID
+	desc := "Task ID " + strconv.Itoa(taskObj.ID) + " stopped"
+	if err := (db.Event{
+		ProjectID:   &project.ID,
+		ObjectType:  &objType,
+		ObjectID:    &taskObj.ID,
+		Description: &desc,
+	}.Insert()); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
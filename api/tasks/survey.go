@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// resolveSurvey checks the values submitted for the survey of a template and fills in defaults.
+// It returns the resolved values or the errors keyed by variable name
+func resolveSurvey(survey []db.SurveyVar, values map[string]interface{}) (map[string]interface{}, map[string]string) {
+	resolved := make(map[string]interface{})
+	fieldErrors := make(map[string]string)
+
+	known := make(map[string]bool)
+	for _, v := range survey {
+		known[v.Name] = true
+
+		value, ok := values[v.Name]
+		if !ok || value == nil || value == "" {
+			if v.Default != nil {
+				resolved[v.Name] = v.Default
+			} else if v.Required {
+				fieldErrors[v.Name] = "is required"
+			}
+			continue
+		}
+
+		if err := v.CheckValue(value); err != nil {
+			fieldErrors[v.Name] = err.Error()
+			continue
+		}
+
+		resolved[v.Name] = value
+	}
+
+	for name := range values {
+		if !known[name] {
+			fieldErrors[name] = "is not a survey variable"
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+
+	return resolved, nil
+}
+
+// applySurvey replaces the submitted survey values of the task with the resolved ones
+// and writes a bad request response with field level errors if they are invalid
+func applySurvey(w http.ResponseWriter, r *http.Request, template db.Template, taskObj *db.Task) bool {
+	survey, err := db.ParseSurveyVars(template.SurveyVars)
+	if err != nil {
+		panic(err)
+	}
+
+	values := make(map[string]interface{})
+	if taskObj.Survey != nil && len(*taskObj.Survey) > 0 {
+		if err := json.Unmarshal([]byte(*taskObj.Survey), &values); err != nil {
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgSurveyNotObject, nil)
+			return false
+		}
+	}
+
+	resolved, fieldErrors := resolveSurvey(survey, values)
+	if fieldErrors != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidSurvey, map[string]interface{}{
+			"fields": fieldErrors,
+		})
+		return false
+	}
+
+	taskObj.Survey = nil
+	if len(resolved) > 0 {
+		js, err := json.Marshal(resolved)
+		util.LogPanic(err)
+
+		str := string(js)
+		taskObj.Survey = &str
+	}
+
+	return true
+}
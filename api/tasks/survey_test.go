@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+func TestResolveSurvey(t *testing.T) {
+	survey := []db.SurveyVar{
+		{Name: "version", Type: db.SurveyVarString, Required: true},
+		{Name: "replicas", Type: db.SurveyVarInteger, Default: float64(2)},
+		{Name: "region", Type: db.SurveyVarString, Choices: []interface{}{"eu", "us"}},
+	}
+
+	resolved, fieldErrors := resolveSurvey(survey, map[string]interface{}{
+		"version": "1.2.0",
+		"region":  "eu",
+	})
+	if fieldErrors != nil {
+		t.Fatal(fieldErrors)
+	}
+	if resolved["replicas"] != float64(2) || resolved["region"] != "eu" {
+		t.Errorf("Unexpected resolved values %v", resolved)
+	}
+
+	_, fieldErrors = resolveSurvey(survey, map[string]interface{}{
+		"replicas": 1.5,
+		"region":   "asia",
+		"unknown":  true,
+	})
+	for _, name := range []string{"version", "replicas", "region", "unknown"} {
+		if _, ok := fieldErrors[name]; !ok {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestSurveySchema(t *testing.T) {
+	schema := surveySchema([]db.SurveyVar{
+		{Name: "version", Type: db.SurveyVarString, Required: true},
+		{Name: "replicas", Type: db.SurveyVarInteger, Required: true, Default: float64(2)},
+		{Name: "region", Type: db.SurveyVarString, Choices: []interface{}{"eu", "us"}},
+	})
+
+	required := schema["required"].([]string)
+	if len(required) != 1 || required[0] != "version" {
+		t.Errorf("Only version should be required, got %v", required)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	region := properties["region"].(map[string]interface{})
+	if len(region["enum"].([]interface{})) != 2 {
+		t.Errorf("region should have its choices as enum, got %v", region)
+	}
+	if properties["replicas"].(map[string]interface{})["type"] != db.SurveyVarInteger {
+		t.Errorf("replicas should be an integer")
+	}
+}
@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+	"github.com/gorilla/context"
+)
+
+// taskUpdate is the metadata of a finished task UpdateTask changes, fields which are nil are kept.
+// Notes are added to the comments of the task
+type taskUpdate struct {
+	Labels *[]string `json:"labels"`
+	Notes  *string   `json:"notes"`
+}
+
+// parseTaskUpdate decodes the body of UpdateTask. Only labels and notes can be changed,
+// the other fields of a task describe the run and are rejected
+func parseTaskUpdate(body map[string]json.RawMessage) (taskUpdate, error) {
+	var update taskUpdate
+
+	var immutable []string
+	for key := range body {
+		if key != "labels" && key != "notes" {
+			immutable = append(immutable, key)
+		}
+	}
+	if len(immutable) > 0 {
+		sort.Strings(immutable)
+		return update, errors.New("only labels and notes of a task can be updated, not " + strings.Join(immutable, ", "))
+	}
+
+	if raw, ok := body["labels"]; ok {
+		var labels []string
+		if err := json.Unmarshal(raw, &labels); err != nil {
+			return update, errors.New("labels must be an array of strings")
+		}
+		if labels == nil {
+			labels = []string{}
+		}
+		if err := validateLabels(labels); err != nil {
+			return update, err
+		}
+		update.Labels = &labels
+	}
+
+	if raw, ok := body["notes"]; ok {
+		var notes string
+		if err := json.Unmarshal(raw, &notes); err != nil {
+			return update, errors.New("notes must be a string")
+		}
+
+		text := strings.TrimSpace(notes)
+		if len(text) == 0 || len(text) > maxTaskCommentLength {
+			return update, errors.New("notes must be between 1 and " + strconv.Itoa(maxTaskCommentLength) + " characters long")
+		}
+		update.Notes = &text
+	}
+
+	return update, nil
+}
+
+// UpdateTask changes the labels of a finished task and adds notes to its comments, its run and output stay untouched
+func UpdateTask(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+	task := context.Get(r, taskTypeID).(db.Task)
+
+	var body map[string]json.RawMessage
+	if err := util.Bind(w, r, &body); err != nil {
+		return
+	}
+
+	update, err := parseTaskUpdate(body)
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if task.Status == taskWaitingStatus || task.Status == taskRunningStatus {
+		util.WriteLocalizedError(w, r, http.StatusConflict, util.MsgUpdateUnfinishedTask, nil)
+		return
+	}
+
+	var changes []string
+
+	if update.Labels != nil {
+		if err := replaceLabels(task.ID, *update.Labels); err != nil {
+			panic(err)
+		}
+		changes = append(changes, "labels ["+strings.Join(task.Labels, ", ")+"] to ["+strings.Join(*update.Labels, ", ")+"]")
+	}
+
+	if update.Notes != nil {
+		if _, err := insertTaskComment(task.ID, user, *update.Notes); err != nil {
+			panic(err)
+		}
+		changes = append(changes, "notes")
+	}
+
+	if len(changes) > 0 {
+		objType := taskTypeID
+		desc := "Task ID " + strconv.Itoa(task.ID) + " " + strings.Join(changes, " and ") + " changed by " + user.Username
+		if err := (db.Event{
+			ProjectID:   &project.ID,
+			ObjectType:  &objType,
+			ObjectID:    &task.ID,
+			Description: &desc,
+		}.Insert()); err != nil {
+			panic(err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseTaskUpdate(t *testing.T) {
+	parse := func(js string) (taskUpdate, error) {
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(js), &body); err != nil {
+			t.Fatal(err)
+		}
+		return parseTaskUpdate(body)
+	}
+
+	update, err := parse(`{"labels": ["rollback"], "notes": "  reverted release 2.3 "}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Labels == nil || len(*update.Labels) != 1 || update.Notes == nil || *update.Notes != "reverted release 2.3" {
+		t.Errorf("unexpected update %+v", update)
+	}
+
+	if update, err = parse(`{"notes": "checked the hosts"}`); err != nil || update.Labels != nil || update.Notes == nil {
+		t.Errorf("omitted labels must be kept, got %+v %v", update, err)
+	}
+
+	for _, notes := range []string{`null`, `"  "`} {
+		if _, err = parse(`{"notes": ` + notes + `}`); err == nil {
+			t.Errorf("notes %s must be rejected, they are added as a comment", notes)
+		}
+	}
+
+	if _, err = parse(`{"labels": [], "status": "success", "template_id": 2}`); err == nil ||
+		err.Error() != "only labels and notes of a task can be updated, not status, template_id" {
+		t.Errorf("immutable fields must be rejected, got %v", err)
+	}
+
+	if _, err = parse(`{"labels": ["with space"]}`); err == nil {
+		t.Error("invalid labels must be rejected")
+	}
+}
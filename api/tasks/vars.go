@@ -0,0 +1,163 @@
+package tasks
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// taskVarsKey is the extra var the metadata of the task is passed in, it replaces a variable of the same name
+// which was saved before the name was reserved
+const taskVarsKey = db.TaskVarsName
+
+// taskVars is the metadata of a task passed to ansible, so playbooks can tag what they deploy with who
+// and what deployed it. Fields are only added, playbooks rely on them
+type taskVars struct {
+	TaskID        int     `json:"task_id"`
+	TemplateID    int     `json:"template_id"`
+	Template      string  `json:"template"`
+	ProjectID     int     `json:"project_id"`
+	Initiator     string  `json:"initiator"`
+	User          *string `json:"user"`
+	Message       *string `json:"message"`
+	Commit        *string `json:"commit"`
+	CommitMessage *string `json:"commit_message"`
+	DryRun        bool    `json:"dry_run"`
+	TaskURL       string  `json:"task_url"`
+}
+
+// parseVars decodes a json object of ansible variables, an empty string is an empty set
+func parseVars(js string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	if len(js) == 0 {
+		return vars, nil
+	}
+
+	err := json.Unmarshal([]byte(js), &vars)
+	return vars, err
+}
+
+// mergeVars merges sets of top level ansible variables.
+// Sets are given from lowest to highest precedence, so later sets override earlier ones
+func mergeVars(sets ...map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+
+	for _, set := range sets {
+		for key, val := range set {
+			merged[key] = val
+		}
+	}
+
+	return merged
+}
+
+// getEffectiveVars returns the variables passed to ansible as --extra-vars.
+// The merge order from lowest to highest precedence is:
+//  1. project vars
+//  2. inventory vars, of all inventories of the task
+//  3. template environment with its secrets (or the environment override of the task)
+//  4. survey values of the task
+//
+// The ENV key of the environment is not a variable, it holds the os environment of the process
+func (t *task) getEffectiveVars(projectVars *string) (map[string]interface{}, error) {
+	var project map[string]interface{}
+	var err error
+
+	if projectVars != nil {
+		if project, err = parseVars(*projectVars); err != nil {
+			t.log("Project vars are not valid JSON")
+			return nil, err
+		}
+	}
+
+	// merged in the order ansible merges the inventories
+	inventory := make(map[string]interface{})
+	for _, inv := range t.inventories {
+		if inv.Vars == nil {
+			continue
+		}
+
+		vars, err := parseVars(*inv.Vars)
+		if err != nil {
+			t.log("Inventory vars are not valid JSON")
+			return nil, err
+		}
+		inventory = mergeVars(inventory, vars)
+	}
+
+	environment, err := parseVars(t.environment.JSON)
+	if err != nil {
+		t.log("JSON is not valid")
+		return nil, err
+	}
+	delete(environment, "ENV")
+
+	secrets, err := t.environment.DecryptSecrets()
+	if err != nil {
+		t.log("Secrets of the environment can't be decrypted: " + err.Error())
+		return nil, err
+	}
+	for key, val := range secrets {
+		environment[key] = val
+		t.addSecret(val)
+		t.secretVars = append(t.secretVars, key)
+	}
+
+	var survey map[string]interface{}
+	if t.task.Survey != nil {
+		if survey, err = parseVars(*t.task.Survey); err != nil {
+			t.log("Survey values are not valid JSON")
+			return nil, err
+		}
+	}
+
+	return mergeVars(project, inventory, environment, survey), nil
+}
+
+// taskVars returns the metadata of the task, the commit is only known once the repository is updated
+func (t *task) taskVars() taskVars {
+	return taskVars{
+		TaskID:        t.task.ID,
+		TemplateID:    t.template.ID,
+		Template:      t.template.Alias,
+		ProjectID:     t.projectID,
+		Initiator:     t.task.Initiator,
+		User:          t.username,
+		Message:       t.task.Message,
+		Commit:        t.task.CommitHash,
+		CommitMessage: t.task.CommitMessage,
+		DryRun:        t.task.DryRun,
+		TaskURL:       t.url(),
+	}
+}
+
+// url returns the address of the task in the api, the link webhooks and the metadata of the task give
+func (t *task) url() string {
+	return util.Config.WebHost + "/api/project/" + strconv.Itoa(t.projectID) + "/tasks/" + strconv.Itoa(t.task.ID)
+}
+
+// extraVars returns the variables passed to ansible, the effective vars with the metadata of the task
+func (t *task) extraVars() map[string]interface{} {
+	if util.Config.DisableTaskVars {
+		return t.vars
+	}
+
+	return mergeVars(t.vars, map[string]interface{}{taskVarsKey: t.taskVars()})
+}
+
+// maskVars returns a copy of vars in which the secret variables of the environment are masked
+func (t *task) maskVars(vars map[string]interface{}) map[string]interface{} {
+	masked := make(map[string]interface{})
+
+	for key, val := range vars {
+		masked[key] = val
+	}
+	for _, key := range t.secretVars {
+		if _, ok := masked[key]; ok {
+			masked[key] = secretMask
+		}
+	}
+
+	return masked
+}
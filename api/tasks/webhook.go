@@ -0,0 +1,117 @@
+package tasks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// webhookSignatureHeader carries the HMAC of the payload when the project has a webhook secret
+const webhookSignatureHeader = "X-Semaphore-Signature"
+
+// webhookSignatureScheme documents in the payload how consumers verify it
+const webhookSignatureScheme = webhookSignatureHeader + " is \"sha256=\" followed by the hex encoded HMAC-SHA256 " +
+	"of the raw request body keyed with the project webhook secret. " +
+	"Reject payloads whose timestamp is too old to prevent replays"
+
+// webhookTimeout bounds the time a finished task waits for the webhook consumer
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is posted to the project webhook when a task finishes
+type webhookPayload struct {
+	Event      string     `json:"event"`
+	Timestamp  int64      `json:"timestamp"`
+	ProjectID  int        `json:"project_id"`
+	TemplateID int        `json:"template_id"`
+	TaskID     int        `json:"task_id"`
+	ExternalID *string    `json:"external_id"`
+	Source     *string    `json:"source"`
+	Status     string     `json:"status"`
+	Start      *time.Time `json:"start"`
+	End        *time.Time `json:"end"`
+	TaskURL    string     `json:"task_url"`
+	Signature  string     `json:"signature_scheme,omitempty"`
+}
+
+// signWebhookPayload returns the value of the signature header of body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) //nolint: errcheck
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook notifies the project webhook that the task has finished
+func (t *task) sendWebhook() {
+	if len(t.webhookURL) == 0 {
+		return
+	}
+
+	t.postWebhook(t.webhookURL, t.webhookHeaders)
+}
+
+// postWebhook posts the finished task to the url with the custom headers, signed with the project
+// webhook secret if there is one
+func (t *task) postWebhook(webhookURL string, headers map[string]string) {
+	payload := webhookPayload{
+		Event:      "task_finished",
+		Timestamp:  time.Now().Unix(),
+		ProjectID:  t.projectID,
+		TemplateID: t.template.ID,
+		TaskID:     t.task.ID,
+		ExternalID: t.task.ExternalID,
+		Source:     t.task.Source,
+		Status:     t.task.Status,
+		Start:      t.task.Start,
+		End:        t.task.End,
+		TaskURL:    t.url(),
+	}
+
+	if err := deliverWebhook(webhookURL, headers, t.webhookSecret, payload); err != nil {
+		t.log("Can't send webhook: " + err.Error())
+	}
+}
+
+// deliverWebhook posts the payload to the url and fails unless the consumer accepts it with a 2xx status
+func deliverWebhook(webhookURL string, headers map[string]string, secret string, payload webhookPayload) error {
+	if len(secret) > 0 {
+		payload.Signature = webhookSignatureScheme
+	}
+
+	body, err := json.Marshal(payload)
+	util.LogPanic(err)
+
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for name, val := range headers {
+		req.Header.Set(name, val)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signWebhookPayload(secret, body))
+	}
+
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	status := http.StatusNoContent
+	var signature, header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(webhookSignatureHeader) != signWebhookPayload("secret", body) {
+			signature = "invalid"
+		} else {
+			signature = "valid"
+		}
+		header = r.Header.Get("X-Custom")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	payload := webhookPayload{Event: "test", ProjectID: 1}
+	if err := deliverWebhook(server.URL, map[string]string{"X-Custom": "value"}, "secret", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if signature != "valid" || header != "value" {
+		t.Fatalf("expected a signed payload with the custom header, got %s signature and header %q", signature, header)
+	}
+
+	status = http.StatusUnauthorized
+	if err := deliverWebhook(server.URL, nil, "secret", payload); err == nil {
+		t.Fatal("a webhook responding with 401 must fail")
+	}
+}
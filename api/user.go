@@ -21,7 +21,21 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	util.WriteJSON(w, http.StatusOK, context.Get(r, "user"))
+	user := context.Get(r, "user").(*db.User)
+
+	if user.LastProjectID != nil {
+		// the project may have been deleted or the user may have lost access to it
+		memberC, err := db.Mysql.SelectInt("select count(1) from project__user where project_id=? and user_id=?", *user.LastProjectID, user.ID)
+		if err != nil {
+			panic(err)
+		}
+
+		if memberC == 0 {
+			user.LastProjectID = nil
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, user)
 }
 
 func getAPITokens(w http.ResponseWriter, r *http.Request) {
@@ -53,7 +67,8 @@ func createAPIToken(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	util.WriteJSON(w, http.StatusCreated, token)
+	// a token is not read back by its id, the location is the list of tokens
+	util.WriteCreated(w, "user/tokens", token)
 }
 
 func expireAPIToken(w http.ResponseWriter, r *http.Request) {
@@ -71,7 +86,7 @@ func expireAPIToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if affected == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgAPITokenNotFound, nil)
 		return
 	}
 
@@ -3,36 +3,134 @@ package api
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/fiftin/semaphore/api/projects"
 	"github.com/fiftin/semaphore/db"
 
 	"github.com/fiftin/semaphore/util"
 	"github.com/gorilla/context"
+	"github.com/masterminds/squirrel"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// maxUsersPageSize is the most users a non admin gets per request
+const maxUsersPageSize = 20
+
+// userSummary is what non admins see of other users
+type userSummary struct {
+	ID       int    `db:"id" json:"id"`
+	Username string `db:"username" json:"username"`
+	Name     string `db:"name" json:"name"`
+}
+
+// getUsers lists the users ordered by name, filtered by ?q= over the username, name and email and by ?active=,
+// which tells users with an active session apart. ?limit= and ?offset= page the list, the X-Total-Count header
+// has the number of matching users. Non admins only see the names of the users, at most 20 at a time
 func getUsers(w http.ResponseWriter, r *http.Request) {
-	var users []db.User
-	if _, err := db.Mysql.Select(&users, "select * from user"); err != nil {
+	editor := context.Get(r, "user").(*db.User)
+
+	q := squirrel.Select().From("user as u")
+
+	if search := strings.TrimSpace(r.URL.Query().Get("q")); len(search) > 0 {
+		pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(search) + "%"
+		if editor.Admin {
+			q = q.Where("(u.username like ? or u.name like ? or u.email like ?)", pattern, pattern, pattern)
+		} else {
+			q = q.Where("(u.username like ? or u.name like ?)", pattern, pattern)
+		}
+	}
+
+	if active := r.URL.Query().Get("active"); len(active) > 0 {
+		activeSessions := "exists (select 1 from session as s where s.user_id=u.id and s.expired=0 and s.last_active > ?)"
+		since := time.Now().UTC().Add(-sessionLifetime)
+
+		switch active {
+		case "1", "true":
+			q = q.Where(activeSessions, since)
+		case "0", "false":
+			q = q.Where("not "+activeSessions, since)
+		default:
+			util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgInvalidActive, nil)
+			return
+		}
+	}
+
+	limit, err := getPageParam(r, "limit")
+	if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNotPositive, nil, "limit")
+		return
+	}
+
+	offset, err := getPageParam(r, "offset")
+	if err != nil {
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgNotPositive, nil, "offset")
+		return
+	}
+
+	if !editor.Admin && (limit == 0 || limit > maxUsersPageSize) {
+		limit = maxUsersPageSize
+	}
+
+	countQuery, args, err := q.Column("count(1)").ToSql()
+	util.LogWarning(err)
+
+	total, err := db.Mysql.SelectInt(countQuery, args...)
+	if err != nil {
+		panic(err)
+	}
+
+	q = q.OrderBy("u.name", "u.id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if offset > 0 {
+		q = q.Offset(offset)
+	}
+
+	var users interface{}
+	if editor.Admin {
+		q = q.Column("u.*")
+		users = &[]db.User{}
+	} else {
+		q = q.Columns("u.id", "u.username", "u.name")
+		users = &[]userSummary{}
+	}
+
+	query, args, err := q.ToSql()
+	util.LogWarning(err)
+
+	if _, err := db.Mysql.Select(users, query, args...); err != nil {
 		panic(err)
 	}
 
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
 	util.WriteJSON(w, http.StatusOK, users)
 }
 
+// getPageParam reads a limit or offset query parameter, 0 when it isn't set
+func getPageParam(r *http.Request, name string) (uint64, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 32)
+}
+
 func addUser(w http.ResponseWriter, r *http.Request) {
 	var user db.User
 	if err := util.Bind(w, r, &user); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	editor := context.Get(r, "user").(*db.User)
 	if !editor.Admin {
 		log.Warn(editor.Username + " is not permitted to create users")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgAdminCreateUsers, nil)
 		return
 	}
 
@@ -42,7 +140,7 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	util.WriteJSON(w, http.StatusCreated, user)
+	util.WriteCreated(w, "users/"+strconv.Itoa(user.ID)+"/", user)
 }
 
 func getUserMiddleware(next http.Handler) http.Handler {
@@ -55,7 +153,7 @@ func getUserMiddleware(next http.Handler) http.Handler {
 		var user db.User
 		if err := db.Mysql.SelectOne(&user, "select * from user where id=?", userID); err != nil {
 			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusNotFound)
+				util.WriteLocalizedError(w, r, http.StatusNotFound, util.MsgUserNotFound, nil)
 				return
 			}
 
@@ -65,7 +163,7 @@ func getUserMiddleware(next http.Handler) http.Handler {
 		editor := context.Get(r, "user").(*db.User)
 		if !editor.Admin && editor.ID != user.ID {
 			log.Warn(editor.Username + " is not permitted to edit users")
-			w.WriteHeader(http.StatusUnauthorized)
+			util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgCannotEditUser, nil)
 			return
 		}
 
@@ -85,19 +183,19 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 
 	if !editor.Admin && editor.ID != oldUser.ID {
 		log.Warn(editor.Username + " is not permitted to edit users")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgCannotEditUser, nil)
 		return
 	}
 
 	if editor.ID == oldUser.ID && oldUser.Admin != user.Admin {
 		log.Warn("User can't edit his own role")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgOwnRole, nil)
 		return
 	}
 
 	if oldUser.External && oldUser.Username != user.Username {
 		log.Warn("Username is not editable for external LDAP users")
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgExternalUsername, nil)
 		return
 	}
 
@@ -118,13 +216,13 @@ func updateUserPassword(w http.ResponseWriter, r *http.Request) {
 
 	if !editor.Admin && editor.ID != user.ID {
 		log.Warn(editor.Username + " is not permitted to edit users")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgCannotEditUser, nil)
 		return
 	}
 
 	if user.External {
 		log.Warn("Password is not editable for external LDAP users")
-		w.WriteHeader(http.StatusBadRequest)
+		util.WriteLocalizedError(w, r, http.StatusBadRequest, util.MsgExternalPassword, nil)
 		return
 	}
 
@@ -147,13 +245,14 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 
 	if !editor.Admin && editor.ID != user.ID {
 		log.Warn(editor.Username + " is not permitted to delete users")
-		w.WriteHeader(http.StatusUnauthorized)
+		util.WriteLocalizedError(w, r, http.StatusUnauthorized, util.MsgCannotDeleteUser, nil)
 		return
 	}
 
 	if _, err := db.Mysql.Exec("delete from project__user where user_id=?", user.ID); err != nil {
 		panic(err)
 	}
+	projects.InvalidateUserRoles(user.ID)
 	if _, err := db.Mysql.Exec("delete from user where id=?", user.ID); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/fiftin/semaphore/db"
+	"github.com/fiftin/semaphore/util"
+)
+
+// configCheck is one of the checks run by -check-config
+type configCheck struct {
+	name  string
+	check func() error
+}
+
+// doCheckConfig validates the loaded config against the environment the server would run in,
+// prints a report and returns the exit code
+func doCheckConfig() int {
+	cfg := util.Config.MySQL
+	checks := []configCheck{
+		{"database " + cfg.Username + "@" + cfg.Hostname + " " + cfg.DbName, db.Ping},
+		{"tmp path " + util.Config.TmpPath, checkTmpPathWritable},
+		{"ansible-playbook", lookPath("ansible-playbook")},
+		{"ansible-galaxy", lookPath("ansible-galaxy")},
+		{"git", lookPath("git")},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", c.name, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("ok   %s\n", c.name)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+
+	fmt.Println("Config is valid")
+	return 0
+}
+
+// checkTmpPathWritable creates the tmp path if it is missing, the way the runner does, and writes a file to it
+func checkTmpPathWritable() error {
+	if err := os.MkdirAll(util.Config.TmpPath, 0700); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(util.Config.TmpPath, "check-config")
+	if err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(file.Name())
+}
+
+// lookPath returns a check that the executable is in the PATH of the server
+func lookPath(name string) func() error {
+	return func() error {
+		_, err := exec.LookPath(name)
+		return err
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -27,6 +28,18 @@ func main() {
 		os.Exit(doSetup())
 	}
 
+	if util.CheckConfig {
+		os.Exit(doCheckConfig())
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "task" {
+		os.Exit(doTask(args[1:]))
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		os.Exit(doMigrate(args[1:]))
+	}
+
 	if util.Upgrade {
 		if err := util.DoUpgrade(util.Version); err != nil {
 			panic(err)
@@ -49,7 +62,12 @@ func main() {
 	db.SetupDBLink()
 	defer db.Close()
 
-	if err := db.MigrateAll(); err != nil {
+	if util.Config.DisableAutoMigrate && !util.Migration {
+		if err := checkMigrations(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	} else if err := db.MigrateAll(); err != nil {
 		panic(err)
 	}
 	// legacy
@@ -61,6 +79,8 @@ func main() {
 	go sockets.StartWS()
 	go checkUpdates()
 	go tasks.StartRunner()
+	go tasks.StartScheduler()
+	go tasks.StartPurger()
 
 	var router http.Handler = api.Route()
 	router = handlers.ProxyHeaders(router)
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fiftin/semaphore/db"
+)
+
+// doMigrate runs the pending db migrations, like
+//
+//	semaphore -config config.json migrate
+//
+// for setups which disable the migrations on startup, and returns the exit code
+func doMigrate(args []string) int {
+	if len(args) > 0 {
+		fmt.Println("Usage: semaphore [-config path] migrate")
+		return 2
+	}
+
+	if err := db.Connect(); err != nil {
+		fmt.Println("Cannot connect to the database: " + err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	if err := db.MigrateAll(); err != nil {
+		fmt.Println("Migration failed: " + err.Error())
+		return 1
+	}
+
+	fmt.Println("Database is up to date")
+	return 0
+}
+
+// checkMigrations refuses to run the server against a stale schema when migrations don't run on startup
+func checkMigrations() error {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%d db migrations are pending, the latest is %s. Run `semaphore migrate` before starting the server, "+
+			"auto migration is disabled", len(pending), pending[len(pending)-1].HumanoidVersion())
+	}
+
+	return nil
+}
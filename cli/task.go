@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/fiftin/semaphore/api/tasks"
+	"github.com/fiftin/semaphore/db"
+)
+
+// doTask runs the task subcommands, like
+//
+//	semaphore -config config.json task run --project 1 --template 2
+//
+// and returns the exit code
+func doTask(args []string) int {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Println("Usage: semaphore [-config path] task run --project <id> --template <id>")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("task run", flag.ContinueOnError)
+	projectID := flags.Int("project", 0, "id of the project")
+	templateID := flags.Int("template", 0, "id of the template to run")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *projectID < 1 || *templateID < 1 {
+		fmt.Println("--project and --template are required")
+		return 2
+	}
+
+	if err := db.Connect(); err != nil {
+		fmt.Println("Cannot connect to the database: " + err.Error())
+		return 1
+	}
+
+	db.SetupDBLink()
+	defer db.Close()
+
+	go tasks.StartRunner()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	status, err := tasks.RunTask(*projectID, *templateID, os.Stdout, interrupt)
+	if err != nil {
+		fmt.Println("Cannot run the task: " + err.Error())
+		return 1
+	}
+
+	fmt.Println("Task finished - " + status)
+	if status != db.TaskSuccessStatus {
+		return 1
+	}
+
+	return 0
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/fiftin/semaphore/util"
 )
@@ -10,17 +12,79 @@ import (
 type AccessKey struct {
 	ID   int    `db:"id" json:"id"`
 	Name string `db:"name" json:"name" binding:"required"`
-	// 'aws/do/gcloud/ssh'
+	// what the key is for, helps to tell stale keys apart
+	Description *string `db:"description" json:"description"`
+	// 'aws/do/gcloud/ssh/login_password'
 	Type string `db:"type" json:"type" binding:"required"`
 
-	ProjectID *int    `db:"project_id" json:"project_id"`
-	Key       *string `db:"key" json:"key"`
-	Secret    *string `db:"secret" json:"secret"`
+	ProjectID *int `db:"project_id" json:"project_id"`
+	// the login of login_password keys
+	Key *string `db:"key" json:"key"`
+	// the password of login_password keys, encrypted with util.EncryptSecret
+	Secret *string `db:"secret" json:"secret"`
 
 	Removed bool `db:"removed" json:"removed"`
+
+	// restricted keys are only listed to project admins and to the user who created the key,
+	// templates using them still run for everyone
+	Restricted bool `db:"restricted" json:"restricted"`
+	CreatedBy  *int `db:"created_by" json:"created_by"`
+
+	// null for keys created before these were tracked
+	Created *time.Time `db:"created" json:"created"`
+	// last time a task installed the key, null if it was never used
+	LastUsed *time.Time `db:"last_used" json:"last_used"`
 }
 
 // GetPath returns the location of the access key once written to disk
 func (key AccessKey) GetPath() string {
 	return util.Config.TmpPath + "/access_key_" + strconv.Itoa(key.ID)
 }
+
+// MarkUsed records that a task has installed the key
+func (key AccessKey) MarkUsed() error {
+	_, err := Mysql.Exec("update access_key set last_used=UTC_TIMESTAMP() where id=?", key.ID)
+	return err
+}
+
+// gitCredentialHelper answers the credential requests of git from the environment,
+// so the password never appears on the command line or on disk
+const gitCredentialHelper = `!f() { echo "username=${SEMAPHORE_GIT_LOGIN}"; echo "password=${SEMAPHORE_GIT_PASSWORD}"; }; f`
+
+// LoginPassword returns the login and the decrypted password of a login_password key
+func (key AccessKey) LoginPassword() (string, string, error) {
+	if key.Type != "login_password" || key.Key == nil || key.Secret == nil {
+		return "", "", errors.New("access key " + key.Name + " is not a login/password key")
+	}
+
+	password, err := util.DecryptSecret(*key.Secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return *key.Key, password, nil
+}
+
+// GitCredentialArgs returns the git options which make git authenticate over http with a login_password key,
+// the credentials are passed with GitCredentialEnv
+func (key AccessKey) GitCredentialArgs() []string {
+	if key.Type != "login_password" {
+		return nil
+	}
+
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + gitCredentialHelper}
+}
+
+// GitCredentialEnv returns the environment variables GitCredentialArgs reads the credentials from
+func (key AccessKey) GitCredentialEnv() ([]string, error) {
+	if key.Type != "login_password" {
+		return nil, nil
+	}
+
+	login, password, err := key.LoginPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"SEMAPHORE_GIT_LOGIN=" + login, "SEMAPHORE_GIT_PASSWORD=" + password}, nil
+}
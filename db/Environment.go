@@ -1,5 +1,10 @@
 package db
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 // Environment is used to pass additional arguments, in json form to ansible
 type Environment struct {
 	ID        int     `db:"id" json:"id"`
@@ -8,4 +13,63 @@ type Environment struct {
 	Password  *string `db:"password" json:"password"`
 	JSON      string  `db:"json" json:"json" binding:"required"`
 	Removed   bool    `db:"removed" json:"removed"`
+
+	// json object of the secret variables, values encrypted with util.EncryptSecret
+	EncryptedSecrets *string `db:"secrets" json:"-"`
+	// secret variables sent by clients. They are returned with null values,
+	// a null value on update keeps the stored value and a missing object keeps all of them
+	Secrets map[string]*string `db:"-" json:"secrets"`
+}
+
+// RedactSecrets lists the secret variables of the environment without their values
+func (env *Environment) RedactSecrets() error {
+	secrets, err := redactValues(env.EncryptedSecrets)
+	if err != nil {
+		return err
+	}
+
+	env.Secrets = secrets
+	return nil
+}
+
+// EncryptSecrets validates the secret variables sent by a client and encrypts them into EncryptedSecrets.
+// Secrets with a null value keep the value stored in old, which is nil for new environments,
+// and without secrets at all the stored ones are kept
+func (env *Environment) EncryptSecrets(old *Environment) error {
+	if env.Secrets == nil && old != nil {
+		env.EncryptedSecrets = old.EncryptedSecrets
+		return nil
+	}
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(env.JSON), &vars); err != nil {
+		return errors.New("JSON is not valid")
+	}
+
+	for key := range env.Secrets {
+		if len(key) == 0 || key == "ENV" {
+			return errors.New("Invalid secret name '" + key + "'")
+		}
+		if _, ok := vars[key]; ok {
+			return errors.New("Secret '" + key + "' is also a variable of the JSON")
+		}
+	}
+
+	var stored *string
+	if old != nil {
+		stored = old.EncryptedSecrets
+	}
+
+	encrypted, err := encryptValues(env.Secrets, stored)
+	if err != nil {
+		return err
+	}
+
+	env.EncryptedSecrets = encrypted
+	return nil
+}
+
+// DecryptSecrets returns the values of the secret variables of the environment
+func (env Environment) DecryptSecrets() (map[string]string, error) {
+	return decryptValues(env.EncryptedSecrets)
 }
@@ -12,6 +12,8 @@ type Event struct {
 
 	ObjectName  string  `db:"-" json:"object_name"`
 	ProjectName *string `db:"project_name" json:"project_name"`
+	// relative time of Created like "2 minutes ago", only set when requested with humanize=1
+	CreatedHuman string `db:"-" json:"created_human,omitempty"`
 }
 
 // Insert writes the event to the database
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// maxHookBranches limits how many branches a hook can be restricted to
+const maxHookBranches = 50
+
+// Hook runs tasks of a template when a GitHub or GitLab push event is posted to /api/hooks/{token}
+type Hook struct {
+	TemplateID int `db:"template_id" json:"template_id"`
+	// random part of the hook url, generated when the hook is created
+	Token string `db:"token" json:"token"`
+	// key of the GitHub payload signature, or the GitLab secret token. Never returned by the api
+	Secret string `db:"secret" json:"secret,omitempty"`
+	// json array of the branches whose pushes run the template, all branches when empty
+	Branches *string `db:"branches" json:"branches"`
+}
+
+// ParseHookBranches returns the branches of a hook, none when they aren't set
+func ParseHookBranches(branches *string) ([]string, error) {
+	if branches == nil || len(strings.TrimSpace(*branches)) == 0 {
+		return nil, nil
+	}
+
+	var res []string
+	if err := json.Unmarshal([]byte(*branches), &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ValidateHookBranches checks that the branches of a hook are a JSON array of branch names
+func ValidateHookBranches(branches *string) error {
+	list, err := ParseHookBranches(branches)
+	if err != nil {
+		return errors.New("Branches must be a JSON array of branch names")
+	}
+
+	if len(list) > maxHookBranches {
+		return errors.New("A hook can be restricted to at most " + strconv.Itoa(maxHookBranches) + " branches")
+	}
+
+	for _, branch := range list {
+		if len(strings.TrimSpace(branch)) == 0 || strings.HasPrefix(branch, "refs/") {
+			return errors.New("Branches must be names like main, without refs/heads/")
+		}
+	}
+
+	return nil
+}
+
+// Runs reports whether a push to the branch runs the template of the hook
+func (hook Hook) Runs(branch string) bool {
+	branches, err := ParseHookBranches(hook.Branches)
+	if err != nil {
+		return false
+	}
+
+	if len(branches) == 0 {
+		return true
+	}
+
+	for _, b := range branches {
+		if b == branch {
+			return true
+		}
+	}
+
+	return false
+}
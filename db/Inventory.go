@@ -1,5 +1,21 @@
 package db
 
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxInventoryLimits limits how many saved limits an inventory can have
+const maxInventoryLimits = 50
+
+// MaxInlineInventorySize is the size inline inventories of tasks are refused above
+const MaxInlineInventorySize = 64 << 10
+
 // Inventory is the model of an ansible inventory file
 type Inventory struct {
 	ID        int    `db:"id" json:"id"`
@@ -14,8 +30,123 @@ type Inventory struct {
 	SSHKeyID *int      `db:"ssh_key_id" json:"ssh_key_id"`
 	SSHKey   AccessKey `db:"-" json:"-"`
 
-	// static/aws/do/gcloud
+	// static/file/url. Url inventories are fetched from the url in Inventory for every run,
+	// with the login_password key KeyID as credentials if set
 	Type string `db:"type" json:"type"`
 
+	// extra vars, override project vars and are overridden by the template environment
+	Vars *string `db:"vars" json:"vars"`
+	// json array of InventoryLimit offered when a task is started
+	Limits *string `db:"limits" json:"limits"`
+
+	// tasks running against production inventories must be confirmed when they are started
+	Production bool `db:"production" json:"production"`
+
 	Removed bool `db:"removed" json:"removed"`
 }
+
+// InventoryLimit is a named host pattern passed to ansible as --limit
+type InventoryLimit struct {
+	Label string `json:"label"`
+	Limit string `json:"limit"`
+}
+
+// ParseInventoryLimits decodes the saved limits stored in Inventory.Limits
+func ParseInventoryLimits(limits *string) ([]InventoryLimit, error) {
+	var saved []InventoryLimit
+	if limits == nil || len(*limits) == 0 {
+		return saved, nil
+	}
+
+	err := json.Unmarshal([]byte(*limits), &saved)
+	return saved, err
+}
+
+// ValidateInventoryLimits checks the saved limits stored in Inventory.Limits
+func ValidateInventoryLimits(limits *string) error {
+	saved, err := ParseInventoryLimits(limits)
+	if err != nil {
+		return errors.New("Limits must be a JSON array of objects with label and limit")
+	}
+
+	if len(saved) > maxInventoryLimits {
+		return errors.New("An inventory can have at most 50 saved limits")
+	}
+
+	labels := make(map[string]bool)
+	for _, l := range saved {
+		if len(strings.TrimSpace(l.Label)) == 0 {
+			return errors.New("Saved limits must have a label")
+		}
+
+		if labels[l.Label] {
+			return errors.New("Saved limit " + l.Label + " is defined twice")
+		}
+		labels[l.Label] = true
+
+		if err := ValidateLimit(l.Limit); err != nil {
+			return errors.New("Saved limit " + l.Label + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ValidateLimit checks an ansible host pattern like "web-*:!web-3:~db[0-9]+".
+// Patterns reading hosts from a file with @ are rejected since they refer to the semaphore host
+func ValidateLimit(limit string) error {
+	if len(limit) == 0 {
+		return errors.New("limit is empty")
+	}
+
+	if strings.ContainsAny(limit, " \t\n\"'") {
+		return errors.New("limit must not contain whitespace or quotes")
+	}
+
+	for _, pattern := range strings.FieldsFunc(limit, func(r rune) bool { return r == ':' || r == ',' }) {
+		pattern = strings.TrimLeft(pattern, "!&")
+		if len(pattern) == 0 {
+			return errors.New("limit " + limit + " has an empty pattern")
+		}
+
+		if strings.HasPrefix(pattern, "@") {
+			return errors.New("limit can't read hosts from a file")
+		}
+
+		if strings.HasPrefix(pattern, "~") {
+			if _, err := regexp.Compile(pattern[1:]); err != nil {
+				return errors.New("limit pattern " + pattern + " is not a valid regular expression")
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateInlineInventory checks the inventory a task is started with instead of a stored one. It is written
+// to a file of the task like a static inventory, so it must be text ansible can read
+func ValidateInlineInventory(inventory string) error {
+	if len(strings.TrimSpace(inventory)) == 0 {
+		return errors.New("inline inventory is empty")
+	}
+
+	if len(inventory) > MaxInlineInventorySize {
+		return errors.New("inline inventory can be at most " + strconv.Itoa(MaxInlineInventorySize) + " bytes")
+	}
+
+	if !utf8.ValidString(inventory) || strings.ContainsRune(inventory, 0) {
+		return errors.New("inline inventory must be utf-8 text")
+	}
+
+	return nil
+}
+
+// ValidateInventoryURL checks the url a url inventory is fetched from
+func ValidateInventoryURL(inventoryURL string) error {
+	u, err := url.Parse(inventoryURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("inventory url must be an absolute http or https url")
+	}
+
+	return nil
+}
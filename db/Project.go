@@ -1,6 +1,11 @@
 package db
 
 import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +16,42 @@ type Project struct {
 	Created   time.Time `db:"created" json:"created"`
 	Alert     bool      `db:"alert" json:"alert"`
 	AlertChat string    `db:"alert_chat" json:"alert_chat"`
+	// url notified when a task of the project finishes
+	WebhookURL *string `db:"webhook_url" json:"webhook_url"`
+	// key of the payload signature, never returned by the api
+	WebhookSecret *string `db:"webhook_secret" json:"-"`
+	// json object of custom headers sent to the webhook, values encrypted with util.EncryptSecret
+	EncryptedWebhookHeaders *string `db:"webhook_headers" json:"-"`
+	// custom webhook headers, returned with null values
+	WebhookHeaders map[string]*string `db:"-" json:"webhook_headers,omitempty"`
+	// archived projects are hidden and can't run tasks, but keep all their data
+	Archived bool `db:"archived" json:"archived"`
+	// extra vars of all templates in the project, lowest precedence
+	Vars *string `db:"vars" json:"vars"`
+	// known_hosts lines the host keys of the hosts tasks connect to are verified against.
+	// When unset host key checking is left to the ansible configuration
+	KnownHosts *string `db:"known_hosts" json:"known_hosts"`
+
+	// used by new templates which don't set an inventory, repository or environment
+	DefaultInventoryID   *int `db:"default_inventory_id" json:"default_inventory_id"`
+	DefaultRepositoryID  *int `db:"default_repository_id" json:"default_repository_id"`
+	DefaultEnvironmentID *int `db:"default_environment_id" json:"default_environment_id"`
+
+	// finished tasks kept per template, older ones are purged. Templates can override it, unset keeps all
+	KeepTasks *int `db:"keep_tasks" json:"keep_tasks"`
+
+	// task counts, only set when requested with stats=1
+	Stats *ProjectStats `db:"-" json:"stats,omitempty"`
+}
+
+// ProjectStats counts the tasks of a project which are queued or running, and the ones which finished recently
+type ProjectStats struct {
+	ProjectID int `db:"project_id" json:"-"`
+	Waiting   int `db:"waiting" json:"waiting"`
+	Running   int `db:"running" json:"running"`
+	Success   int `db:"success" json:"success"`
+	Failed    int `db:"failed" json:"failed"`
+	Stopped   int `db:"stopped" json:"stopped"`
 }
 
 // CreateProject writes a project to the database
@@ -31,3 +72,136 @@ func (project *Project) CreateProject() error {
 
 	return nil
 }
+
+// MaxKnownHostsSize limits the size of the known_hosts of a project
+const MaxKnownHostsSize = 64 << 10
+
+// ValidateKnownHosts checks that every line of the known_hosts of a project which isn't empty or a comment
+// is a host key, optionally preceded by a marker like @cert-authority
+func ValidateKnownHosts(knownHosts string) error {
+	if len(knownHosts) > MaxKnownHostsSize {
+		return errors.New("Known hosts can be at most " + strconv.Itoa(MaxKnownHostsSize) + " bytes long")
+	}
+
+	for i, line := range strings.Split(knownHosts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], "@") {
+			fields = fields[1:]
+		}
+
+		if len(fields) < 3 {
+			return errors.New("Line " + strconv.Itoa(i+1) + " of known hosts must be hosts, key type and key")
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(fields[2]); err != nil {
+			return errors.New("Line " + strconv.Itoa(i+1) + " of known hosts has an invalid key")
+		}
+	}
+
+	return nil
+}
+
+// maxWebhookHeaders limits how many custom headers a project webhook sends
+const maxWebhookHeaders = 20
+
+// maxWebhookHeaderLength limits the length of a custom webhook header value
+const maxWebhookHeaderLength = 4096
+
+// forbiddenWebhookHeaders are set by semaphore or by the http client, projects can't override them
+var forbiddenWebhookHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Content-Type",
+	"Expect",
+	"Host",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"X-Semaphore-Signature",
+}
+
+// isHeaderToken tells if name is a valid http header name, a token of RFC 7230
+func isHeaderToken(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for _, c := range name {
+		if c > 127 || !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateWebhookHeaders checks the custom webhook headers sent by a client, null values keep a stored value
+func ValidateWebhookHeaders(headers map[string]*string) error {
+	if len(headers) > maxWebhookHeaders {
+		return errors.New("A webhook can have at most " + strconv.Itoa(maxWebhookHeaders) + " custom headers")
+	}
+
+	seen := make(map[string]bool)
+	for name, val := range headers {
+		if !isHeaderToken(name) {
+			return errors.New("Invalid webhook header name '" + name + "'")
+		}
+
+		canonical := http.CanonicalHeaderKey(name)
+		if seen[canonical] {
+			return errors.New("Duplicate webhook header '" + name + "'")
+		}
+		seen[canonical] = true
+
+		for _, forbidden := range forbiddenWebhookHeaders {
+			if canonical == forbidden {
+				return errors.New("Webhook header '" + name + "' can't be set")
+			}
+		}
+
+		if val == nil {
+			continue
+		}
+		if len(*val) > maxWebhookHeaderLength {
+			return errors.New("Webhook header '" + name + "' is too long")
+		}
+		if strings.ContainsAny(*val, "\r\n\x00") {
+			return errors.New("Webhook header '" + name + "' contains a line break")
+		}
+	}
+
+	return nil
+}
+
+// EncryptWebhookHeaders validates the custom webhook headers sent by a client and returns them encrypted.
+// A null value keeps the value of stored, headers missing from headers are dropped
+func EncryptWebhookHeaders(headers map[string]*string, stored *string) (*string, error) {
+	if err := ValidateWebhookHeaders(headers); err != nil {
+		return nil, err
+	}
+
+	return encryptValues(headers, stored)
+}
+
+// RedactWebhookHeaders lists the custom webhook headers of the project without their values
+func (project *Project) RedactWebhookHeaders() error {
+	headers, err := redactValues(project.EncryptedWebhookHeaders)
+	if err != nil {
+		return err
+	}
+
+	project.WebhookHeaders = headers
+	return nil
+}
+
+// DecryptWebhookHeaders returns the custom webhook headers of the project
+func (project Project) DecryptWebhookHeaders() (map[string]string, error) {
+	return decryptValues(project.EncryptedWebhookHeaders)
+}
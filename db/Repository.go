@@ -1,5 +1,12 @@
 package db
 
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
 // Repository is the model for code stored in a git repository
 type Repository struct {
 	ID        int    `db:"id" json:"id"`
@@ -9,5 +16,77 @@ type Repository struct {
 	SSHKeyID  int    `db:"ssh_key_id" json:"ssh_key_id" binding:"required"`
 	Removed   bool   `db:"removed" json:"removed"`
 
+	// proxy used by git for http(s) urls, e.g. http://proxy:3128
+	HTTPProxy *string `db:"http_proxy" json:"http_proxy"`
+	// jump host ssh connects through for ssh urls, e.g. user@bastion:22
+	SSHProxyJump *string `db:"ssh_proxy_jump" json:"ssh_proxy_jump"`
+
+	// tasks fail unless the checked out commit has a valid gpg signature of one of the trusted keys
+	RequireSignature bool `db:"require_signature" json:"require_signature"`
+	// ascii armored gpg public keys of the signers commits are accepted from
+	TrustedKeys *string `db:"trusted_keys" json:"trusted_keys"`
+
+	// tasks fetch the branch and reuse the working copy when it didn't move since the last run,
+	// instead of pulling it
+	CachedClone bool `db:"cached_clone" json:"cached_clone"`
+
 	SSHKey AccessKey `db:"-" json:"-"`
 }
+
+// proxyJumpRegexp matches ssh ProxyJump values. It excludes whitespace and quotes because the value
+// ends up in GIT_SSH_COMMAND, which git runs through a shell
+var proxyJumpRegexp = regexp.MustCompile(`^[A-Za-z0-9_.@:,\[\]-]+$`)
+
+// ValidateProxy checks the proxy settings of the repository
+func (repo Repository) ValidateProxy() error {
+	if repo.HTTPProxy != nil {
+		u, err := url.Parse(*repo.HTTPProxy)
+		if err != nil || len(u.Host) == 0 {
+			return errors.New("http proxy must be an absolute url")
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return errors.New("http proxy must be an http, https or socks5 url")
+		}
+	}
+
+	if repo.SSHProxyJump != nil && !proxyJumpRegexp.MatchString(*repo.SSHProxyJump) {
+		return errors.New("ssh proxy jump must be a list of [user@]host[:port] separated by commas")
+	}
+
+	return nil
+}
+
+// ValidateSignature checks the trusted keys of a repository which requires signed commits
+func (repo Repository) ValidateSignature() error {
+	if repo.TrustedKeys != nil && !strings.Contains(*repo.TrustedKeys, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		return errors.New("trusted keys must be ascii armored gpg public keys")
+	}
+
+	if repo.RequireSignature && repo.TrustedKeys == nil {
+		return errors.New("trusted keys are required to verify commit signatures")
+	}
+
+	return nil
+}
+
+// GitProxyArgs returns the git options which make a git command use the http proxy of the repository.
+// They only apply to the command they are passed to, so other repositories are not affected
+func (repo Repository) GitProxyArgs() []string {
+	if repo.HTTPProxy == nil {
+		return nil
+	}
+
+	return []string{"-c", "http.proxy=" + *repo.HTTPProxy}
+}
+
+// SSHProxyOptions returns the ssh options which make git connect through the jump host of the repository
+func (repo Repository) SSHProxyOptions() string {
+	if repo.SSHProxyJump == nil {
+		return ""
+	}
+
+	return " -o ProxyJump=" + *repo.SSHProxyJump
+}
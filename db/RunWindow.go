@@ -0,0 +1,122 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// runWindowDays are the day names of RunWindow.Days, indexed by time.Weekday
+var runWindowDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// RunWindow is the time of the week tasks of a template can be started in, stored as json in Template.RunWindow
+type RunWindow struct {
+	// days of the week like "mon", every day when empty
+	Days []string `json:"days,omitempty"`
+	// start and end of the window on each day as HH:MM, the end is exclusive
+	From string `json:"from"`
+	To   string `json:"to"`
+	// timezone the window is in, defaults to the configured timezone
+	Timezone *string `json:"timezone,omitempty"`
+}
+
+// ParseRunWindow decodes the window stored in Template.RunWindow, it returns nil if the template has none
+func ParseRunWindow(window *string) (*RunWindow, error) {
+	if window == nil || len(*window) == 0 {
+		return nil, nil
+	}
+
+	var w RunWindow
+	if err := json.Unmarshal([]byte(*window), &w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// ValidateRunWindow checks the window stored in Template.RunWindow
+func ValidateRunWindow(window *string) error {
+	w, err := ParseRunWindow(window)
+	if err != nil {
+		return errors.New("Run window must be a JSON object with days, from, to and timezone")
+	}
+
+	if w == nil {
+		return nil
+	}
+
+	for _, day := range w.Days {
+		if runWindowDay(day) < 0 {
+			return errors.New("Run window days must be one of " + strings.Join(runWindowDays, ", "))
+		}
+	}
+
+	from, err := time.Parse("15:04", w.From)
+	if err != nil {
+		return errors.New("Run window from must be a time like 09:00")
+	}
+
+	to, err := time.Parse("15:04", w.To)
+	if err != nil {
+		return errors.New("Run window to must be a time like 17:00")
+	}
+
+	if !from.Before(to) {
+		return errors.New("Run window from must be before to")
+	}
+
+	if _, err := util.ScheduleLocation(w.Timezone); err != nil {
+		return errors.New("Unknown run window timezone")
+	}
+
+	return nil
+}
+
+// Contains returns whether the time falls into the window
+func (w RunWindow) Contains(t time.Time) (bool, error) {
+	loc, err := util.ScheduleLocation(w.Timezone)
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+
+	if len(w.Days) > 0 {
+		allowed := false
+		for _, day := range w.Days {
+			if runWindowDay(day) == int(t.Weekday()) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false, nil
+		}
+	}
+
+	from, err := time.Parse("15:04", w.From)
+	if err != nil {
+		return false, err
+	}
+
+	to, err := time.Parse("15:04", w.To)
+	if err != nil {
+		return false, err
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	return minute >= from.Hour()*60+from.Minute() && minute < to.Hour()*60+to.Minute(), nil
+}
+
+func runWindowDay(day string) int {
+	for i, name := range runWindowDays {
+		if strings.ToLower(day) == name {
+			return i
+		}
+	}
+
+	return -1
+}
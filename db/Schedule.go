@@ -0,0 +1,9 @@
+package db
+
+// Schedule runs tasks of a template at the times of a cron expression
+type Schedule struct {
+	TemplateID int    `db:"template_id" json:"template_id"`
+	CronFormat string `db:"cron_format" json:"cron_format"`
+	// zone the cron expression is evaluated in, defaults to the configured timezone
+	Timezone *string `db:"timezone" json:"timezone"`
+}
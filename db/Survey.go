@@ -0,0 +1,110 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+)
+
+// survey variable types
+const (
+	SurveyVarString  = "string"
+	SurveyVarInteger = "integer"
+	SurveyVarBoolean = "boolean"
+)
+
+var surveyVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SurveyVar is a variable the user is prompted for when running a task of a template
+type SurveyVar struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// string/integer/boolean
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	// used when the variable isn't submitted, nil means no default
+	Default interface{} `json:"default"`
+	// if not empty, the submitted value must be one of the choices
+	Choices []interface{} `json:"choices"`
+}
+
+// ParseSurveyVars decodes the json array of survey variables stored in Template.SurveyVars
+func ParseSurveyVars(survey *string) ([]SurveyVar, error) {
+	var vars []SurveyVar
+	if survey == nil || len(*survey) == 0 {
+		return vars, nil
+	}
+
+	err := json.Unmarshal([]byte(*survey), &vars)
+	return vars, err
+}
+
+// Validate checks the definition of the survey variable
+func (v SurveyVar) Validate() error {
+	if !surveyVarNameRegexp.MatchString(v.Name) {
+		return errors.New("name must be a valid variable name")
+	}
+
+	if v.Name == TaskVarsName {
+		return errors.New("name " + TaskVarsName + " is reserved for the metadata of the task")
+	}
+
+	switch v.Type {
+	case SurveyVarString, SurveyVarInteger, SurveyVarBoolean:
+	default:
+		return errors.New("type must be string, integer or boolean")
+	}
+
+	for _, choice := range v.Choices {
+		if err := v.checkType(choice); err != nil {
+			return errors.New("choices " + err.Error())
+		}
+	}
+
+	if v.Default != nil {
+		if err := v.CheckValue(v.Default); err != nil {
+			return errors.New("default " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// CheckValue checks that a submitted value matches the type and choices of the survey variable
+func (v SurveyVar) CheckValue(value interface{}) error {
+	if err := v.checkType(value); err != nil {
+		return err
+	}
+
+	if len(v.Choices) == 0 {
+		return nil
+	}
+
+	for _, choice := range v.Choices {
+		if choice == value {
+			return nil
+		}
+	}
+
+	return errors.New("must be one of the choices")
+}
+
+func (v SurveyVar) checkType(value interface{}) error {
+	switch v.Type {
+	case SurveyVarString:
+		if _, ok := value.(string); !ok {
+			return errors.New("must be a string")
+		}
+	case SurveyVarInteger:
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return errors.New("must be an integer")
+		}
+	case SurveyVarBoolean:
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be a boolean")
+		}
+	}
+
+	return nil
+}
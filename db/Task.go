@@ -1,6 +1,73 @@
 package db
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// initiators of tasks
+const (
+	TaskUserInitiator     = "user"
+	TaskAPITokenInitiator = "api_token"
+	TaskScheduleInitiator = "schedule"
+	TaskCLIInitiator      = "cli"
+	TaskHookInitiator     = "hook"
+	TaskRetryInitiator    = "retry"
+)
+
+// statuses of tasks. A task is created waiting, runs and ends as success, error or stopped.
+// A task which fails or is stopped before its playbook runs goes from waiting to error or stopped
+const (
+	TaskWaitingStatus = "waiting"
+	TaskRunningStatus = "running"
+	TaskSuccessStatus = "success"
+	TaskErrorStatus   = "error"
+	TaskStoppedStatus = "stopped"
+)
+
+// TaskVarsName is the extra var the metadata of tasks is passed to ansible in, vars of users can't use it
+const TaskVarsName = "semaphore"
+
+// TaskStatuses are the statuses tasks can have, no other value is stored
+var TaskStatuses = []string{TaskWaitingStatus, TaskRunningStatus, TaskSuccessStatus, TaskErrorStatus, TaskStoppedStatus}
+
+// taskTransitions are the statuses a task can move to from its status, finished tasks don't change anymore
+var taskTransitions = map[string][]string{
+	TaskWaitingStatus: {TaskRunningStatus, TaskErrorStatus, TaskStoppedStatus},
+	TaskRunningStatus: {TaskSuccessStatus, TaskErrorStatus, TaskStoppedStatus},
+}
+
+// IsTaskStatus returns whether status is one of TaskStatuses
+func IsTaskStatus(status string) bool {
+	for _, s := range TaskStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidTaskTransition returns whether a task can move from one status to another.
+// Staying in a status is valid, updates of the start and end times write it again
+func ValidTaskTransition(from string, to string) bool {
+	if !IsTaskStatus(to) {
+		return false
+	}
+
+	if from == to {
+		return true
+	}
+
+	for _, s := range taskTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
 
 //Task is a model of a task which will be executed by the runner
 type Task struct {
@@ -11,18 +78,105 @@ type Task struct {
 	Debug  bool   `db:"debug" json:"debug"`
 
 	DryRun bool `db:"dry_run" json:"dry_run"`
+	// runs ansible-playbook with --diff
+	Diff bool `db:"diff" json:"diff"`
+
+	// why the task was run, given by whoever started it
+	Message *string `db:"message" json:"message"`
 
 	// override variables
 	Playbook    string `db:"playbook" json:"playbook"`
 	Environment string `db:"environment" json:"environment"`
 	// to fit into []string
 	Arguments *string `db:"arguments" json:"arguments"`
+	// os environment variables of the ansible process, merged over the template ones
+	Env *string `db:"env" json:"env"`
+	// effective extra vars of the run, set by the runner for debugging
+	Vars *string `db:"vars" json:"vars"`
+	// json object of the values of the template survey variables
+	Survey *string `db:"survey" json:"survey"`
+	// hosts the playbook is limited to, passed as --limit
+	Limit *string `db:"host_limit" json:"limit"`
+	// inventory the task runs with instead of the inventories of the task or template, kept with the task only
+	Inventory *string `db:"inventory" json:"inventory"`
+	// --forks the task runs with, overrides the template. Set to the effective value when the task is created
+	Forks *int `db:"forks" json:"forks"`
+	// runner tag of the template, set when the task is queued. Only runners advertising it run the task
+	RunnerTag *string `db:"runner_tag" json:"runner_tag"`
+	// commit of the repository the task checked out and its subject, set by the runner.
+	// They stay what the task ran even when the branch moves on
+	CommitHash    *string `db:"commit_hash" json:"commit_hash"`
+	CommitMessage *string `db:"commit_message" json:"commit_message"`
+	// json array of the ansible-playbook command line with secrets masked, set by the runner
+	Command *string `db:"command" json:"command"`
+	// set when the output exceeded max_output_size and the rest of it wasn't stored
+	OutputTruncated bool `db:"output_truncated" json:"output_truncated"`
+	// hosts which failed or were unreachable, one per line, from the ansible retry file of a failed run
+	RetryHosts *string `db:"retry_hosts" json:"retry_hosts"`
+	// failed task this task retries, it runs with --limit on the retry hosts of that task
+	RetryOf *int `db:"retry_of" json:"retry_of"`
+	// original task of an automatic retry and the number of the retry, 0 for the original task
+	ParentID   *int `db:"parent_id" json:"parent_id"`
+	RetryCount int  `db:"retry_count" json:"retry_count"`
+
+	// ansible tasks of the playbook which completed and how many the started plays have,
+	// the total is unknown when it was read from the output of the playbook
+	TasksDone  int  `db:"tasks_done" json:"tasks_done"`
+	TasksTotal *int `db:"tasks_total" json:"tasks_total"`
 
 	UserID *int `db:"user_id" json:"user_id"`
+	// what started the task, one of the Task*Initiator constants. Scheduled tasks have no user,
+	// the schedule is the one of the template
+	Initiator string `db:"initiator" json:"initiator"`
+	// token the task was started with. The id of a token is the secret itself, so only its
+	// sha256 and the start of it, which is enough for the owner to recognize it, are stored
+	APITokenHash *string `db:"api_token_hash" json:"-"`
+	APITokenHint *string `db:"api_token_hint" json:"api_token"`
+
+	// id of the run in an external system like a ci build, with the name of the system
+	ExternalID *string `db:"external_id" json:"external_id"`
+	Source     *string `db:"source" json:"source"`
 
 	Created time.Time  `db:"created" json:"created"`
 	Start   *time.Time `db:"start" json:"start"`
 	End     *time.Time `db:"end" json:"end"`
+
+	// free-form tags stored in task__label
+	Labels []string `db:"-" json:"labels"`
+	// inventories the task runs with instead of the template inventory, stored in task__inventory.
+	// ansible merges them in order, so later inventories override host vars of earlier ones
+	InventoryIDs []int `db:"-" json:"inventory_ids,omitempty"`
+	// extra cli arguments as an array, stored in Arguments when the task is created
+	Args []string `db:"-" json:"args,omitempty"`
+	// set by admins to start a task outside the run window of its template, not stored
+	OverrideRunWindow bool `db:"-" json:"override_run_window,omitempty"`
+	// confirm a run of a production template or inventory, either flag or the name of the project does
+	Confirm        bool   `db:"-" json:"confirm,omitempty"`
+	ConfirmProject string `db:"-" json:"confirm_project,omitempty"`
+	// comments admins added to the finished task, only set for a single task
+	Comments []TaskComment `db:"-" json:"comments,omitempty"`
+	// position in the runner queue, only set for waiting tasks
+	QueuePosition *int `db:"-" json:"queue_position"`
+	// resource of the template held by another task, which the waiting task waits for
+	BlockedOn *string `db:"-" json:"blocked_on,omitempty"`
+	// results of the run per host, only set for a single task
+	Hosts []TaskHost `db:"-" json:"hosts,omitempty"`
+}
+
+// apiTokenHintLength is how many characters of the api token id are shown
+const apiTokenHintLength = 6
+
+// SetAPIToken records the api token the task is started with by its hash and hint, never the token itself
+func (task *Task) SetAPIToken(tokenID string) {
+	sum := sha256.Sum256([]byte(tokenID))
+	hash := hex.EncodeToString(sum[:])
+	task.APITokenHash = &hash
+
+	hint := tokenID
+	if len(hint) > apiTokenHintLength {
+		hint = hint[:apiTokenHintLength] + "..."
+	}
+	task.APITokenHint = &hint
 }
 
 // TaskOutput is the ansible log output from the task
@@ -31,4 +185,69 @@ type TaskOutput struct {
 	Task   string    `db:"task" json:"task"`
 	Time   time.Time `db:"time" json:"time"`
 	Output string    `db:"output" json:"output"`
+	// part of the --diff output of a changed file
+	Diff bool `db:"diff" json:"diff"`
+	// stdout or stderr, lines semaphore logs itself are stdout
+	Stream string `db:"stream" json:"stream"`
+	// position of the line in the output of the task, 0 for output stored before it was recorded
+	Seq int64 `db:"seq" json:"seq"`
+}
+
+// statuses of the hosts of a task, from the worst result the host had
+const (
+	TaskHostOK          = "ok"
+	TaskHostChanged     = "changed"
+	TaskHostFailed      = "failed"
+	TaskHostUnreachable = "unreachable"
+)
+
+// TaskHost is the result of a run on a host, the counters are the ones of the ansible play recap
+type TaskHost struct {
+	TaskID      int    `db:"task_id" json:"task_id"`
+	Host        string `db:"host" json:"host"`
+	Status      string `db:"status" json:"status"`
+	OK          int    `db:"ok" json:"ok"`
+	Changed     int    `db:"changed" json:"changed"`
+	Failed      int    `db:"failed" json:"failed"`
+	Unreachable int    `db:"unreachable" json:"unreachable"`
+	Skipped     int    `db:"skipped" json:"skipped"`
+	Rescued     int    `db:"rescued" json:"rescued"`
+	Ignored     int    `db:"ignored" json:"ignored"`
+}
+
+// SetStatus sets the status of the host from its counters
+func (host *TaskHost) SetStatus() {
+	switch {
+	case host.Unreachable > 0:
+		host.Status = TaskHostUnreachable
+	case host.Failed > 0:
+		host.Status = TaskHostFailed
+	case host.Changed > 0:
+		host.Status = TaskHostChanged
+	default:
+		host.Status = TaskHostOK
+	}
+}
+
+// TaskComment is a note project admins add to a finished task
+type TaskComment struct {
+	ID      int       `db:"id" json:"id"`
+	TaskID  int       `db:"task_id" json:"task_id"`
+	UserID  *int      `db:"user_id" json:"user_id"`
+	Comment string    `db:"comment" json:"comment"`
+	Created time.Time `db:"created" json:"created"`
+
+	// name of the user, read with the comment
+	UserName *string `db:"user_name" json:"user_name"`
+}
+
+// TaskArtifact is a file a template declared as artifact, collected from the working directory after a run
+type TaskArtifact struct {
+	ID     int `db:"id" json:"id"`
+	TaskID int `db:"task_id" json:"task_id"`
+	// path relative to the working directory
+	Name    string    `db:"name" json:"name"`
+	Size    int       `db:"size" json:"size"`
+	Content []byte    `db:"content" json:"-"`
+	Created time.Time `db:"created" json:"created"`
 }
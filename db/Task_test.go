@@ -0,0 +1,31 @@
+package db
+
+import "testing"
+
+func TestValidTaskTransition(t *testing.T) {
+	for _, c := range []struct {
+		from  string
+		to    string
+		valid bool
+	}{
+		{TaskWaitingStatus, TaskRunningStatus, true},
+		{TaskWaitingStatus, TaskErrorStatus, true},
+		{TaskWaitingStatus, TaskStoppedStatus, true},
+		{TaskWaitingStatus, TaskSuccessStatus, false},
+		{TaskRunningStatus, TaskSuccessStatus, true},
+		{TaskRunningStatus, TaskErrorStatus, true},
+		{TaskRunningStatus, TaskStoppedStatus, true},
+		{TaskRunningStatus, TaskWaitingStatus, false},
+		{TaskSuccessStatus, TaskErrorStatus, false},
+		{TaskErrorStatus, TaskRunningStatus, false},
+		{TaskStoppedStatus, TaskWaitingStatus, false},
+		{TaskRunningStatus, TaskRunningStatus, true},
+		{TaskSuccessStatus, TaskSuccessStatus, true},
+		{TaskWaitingStatus, "paused", false},
+		{"", TaskRunningStatus, false},
+	} {
+		if ValidTaskTransition(c.from, c.to) != c.valid {
+			t.Errorf("transition from %q to %q should be valid: %v", c.from, c.to, c.valid)
+		}
+	}
+}
@@ -1,21 +1,378 @@
 package db
 
+import (
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// maxTemplateArtifacts limits how many artifact paths a template can declare
+const maxTemplateArtifacts = 20
+
+// maxRunnerTagLength is the size of the runner_tag column
+const maxRunnerTagLength = 255
+
+var runnerTagRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+(=[A-Za-z0-9._-]+)?$`)
+
+// maxTemplateNotifications limits how many notification targets a template can declare
+const maxTemplateNotifications = 20
+
+// TemplateNotification is a recipient notified when a task of the template finishes,
+// in addition to the project alerts and webhook
+type TemplateNotification struct {
+	// email address the notification is mailed to
+	Email string `json:"email,omitempty"`
+	// url the finished task is posted to, like the project webhook
+	Webhook string `json:"webhook,omitempty"`
+	// task statuses the target is notified of, all final statuses when empty
+	Statuses []string `json:"statuses,omitempty"`
+}
+
+// Wants returns whether the target is notified of a task finishing with the status
+func (n TemplateNotification) Wants(status string) bool {
+	if len(n.Statuses) == 0 {
+		return true
+	}
+
+	for _, s := range n.Statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Template is a user defined model that is used to run a task
 type Template struct {
 	ID int `db:"id" json:"id"`
 
-	SSHKeyID      int  `db:"ssh_key_id" json:"ssh_key_id"`
-	ProjectID     int  `db:"project_id" json:"project_id"`
-	InventoryID   int  `db:"inventory_id" json:"inventory_id"`
+	SSHKeyID  int `db:"ssh_key_id" json:"ssh_key_id"`
+	ProjectID int `db:"project_id" json:"project_id"`
+	// without an inventory the playbook runs on an implicit localhost inventory with a local connection
+	InventoryID   *int `db:"inventory_id" json:"inventory_id"`
 	RepositoryID  int  `db:"repository_id" json:"repository_id"`
 	EnvironmentID *int `db:"environment_id" json:"environment_id"`
 
 	// Alias as described in https://github.com/fiftin/semaphore/issues/188
 	Alias string `db:"alias" json:"alias"`
+	// free-form folder the template is listed in, groups exist as long as templates are assigned to them
+	Group *string `db:"group_name" json:"group"`
 	// playbook name in the form of "some_play.yml"
 	Playbook string `db:"playbook" json:"playbook"`
 	// to fit into []string
 	Arguments *string `db:"arguments" json:"arguments"`
 	// if true, semaphore will not prepend any arguments to `arguments` like inventory, etc
 	OverrideArguments bool `db:"override_args" json:"override_args"`
+	// json array of the cli flags tasks can pass in their arguments, e.g. ["--check", "--tags="].
+	// Flags ending with = take a value. Tasks can pass any arguments when it is unset
+	AllowedArgs *string `db:"allowed_args" json:"allowed_args"`
+	// os environment variables of the ansible process, json object of strings
+	Env *string `db:"env" json:"env"`
+	// path of a galaxy requirements file in the repository, installed before the playbook runs
+	RequirementsPath *string `db:"requirements_path" json:"requirements_path"`
+	// inline content of a galaxy requirements file, alternative to RequirementsPath
+	Requirements *string `db:"requirements" json:"requirements"`
+	// subdirectory of the repository the playbook is run from, so relative role and var paths resolve
+	WorkingDirectory *string `db:"working_directory" json:"working_directory"`
+	// json array of SurveyVar prompted when a task is run
+	SurveyVars *string `db:"survey_vars" json:"survey_vars"`
+	// json array of files collected after a run, paths or glob patterns relative to the working directory
+	Artifacts *string `db:"artifacts" json:"artifacts"`
+
+	// json array of TemplateNotification
+	Notifications *string `db:"notifications" json:"notifications"`
+
+	// parallel processes ansible uses, the configured default when unset
+	Forks *int `db:"forks" json:"forks"`
+
+	// regular expression which fails a task when a line of the playbook output matches it, even if ansible-playbook exits with 0
+	FailurePattern *string `db:"failure_pattern" json:"failure_pattern"`
+	// json array of the non-zero exit codes of ansible-playbook which count as success
+	SuccessExitCodes *string `db:"success_exit_codes" json:"success_exit_codes"`
+
+	// finished tasks kept, older ones are purged. Overrides the keep_tasks of the project
+	KeepTasks *int `db:"keep_tasks" json:"keep_tasks"`
+
+	// times a failed task is run again automatically
+	MaxRetries *int `db:"max_retries" json:"max_retries"`
+	// seconds a retry waits in the queue before it runs
+	RetryDelay *int `db:"retry_delay" json:"retry_delay"`
+
+	// json RunWindow, tasks can only be started inside it unless an admin overrides it
+	RunWindow *string `db:"run_window" json:"run_window"`
+
+	// template whose last run must have succeeded before tasks of this template can run
+	RequiredTemplateID *int `db:"required_template_id" json:"required_template_id"`
+	// minutes the successful run of the required template stays valid, unset means forever
+	RequiredWithin *int `db:"required_within" json:"required_within"`
+
+	// tasks of production templates must be confirmed when they are started
+	Production bool `db:"production" json:"production"`
+
+	// name of a lock shared across projects, tasks of templates with the same resource run one at a time
+	Resource *string `db:"resource" json:"resource"`
+
+	// label like region=eu, tasks of the template are only run by runners advertising it in runner_tags
+	RunnerTag *string `db:"runner_tag" json:"runner_tag"`
+}
+
+// InventoryIDs returns the inventory of the template as the inventories of a task, none for the implicit localhost inventory
+func (tpl Template) InventoryIDs() []int {
+	if tpl.InventoryID == nil {
+		return nil
+	}
+
+	return []int{*tpl.InventoryID}
+}
+
+// MaxForks is the highest --forks value a template or task can set
+const MaxForks = 500
+
+// ValidateForks checks a --forks value of a template or task
+func ValidateForks(forks *int) error {
+	if forks != nil && (*forks < 1 || *forks > MaxForks) {
+		return errors.New("Forks must be between 1 and 500")
+	}
+
+	return nil
+}
+
+// MaxKeepTasks is the highest number of tasks a keep last N policy can keep
+const MaxKeepTasks = 100000
+
+// ValidateKeepTasks checks the number of tasks a project or template keeps
+func ValidateKeepTasks(keep *int) error {
+	if keep != nil && (*keep < 1 || *keep > MaxKeepTasks) {
+		return errors.New("Keep tasks must be between 1 and " + strconv.Itoa(MaxKeepTasks))
+	}
+
+	return nil
+}
+
+// MaxRetries is the highest number of automatic retries of a template
+const MaxRetries = 10
+
+// MaxRetryDelay is the longest delay in seconds before an automatic retry, a day
+const MaxRetryDelay = 86400
+
+// ValidateRetries checks the automatic retry settings of a template
+func ValidateRetries(maxRetries *int, retryDelay *int) error {
+	if maxRetries != nil && (*maxRetries < 0 || *maxRetries > MaxRetries) {
+		return errors.New("Max retries must be between 0 and " + strconv.Itoa(MaxRetries))
+	}
+
+	if retryDelay != nil && (*retryDelay < 0 || *retryDelay > MaxRetryDelay) {
+		return errors.New("Retry delay must be between 0 and " + strconv.Itoa(MaxRetryDelay) + " seconds")
+	}
+
+	return nil
+}
+
+// maxFailurePatternLength is the size of the failure_pattern column
+const maxFailurePatternLength = 1024
+
+// maxSuccessExitCodes limits how many exit codes a template can count as success
+const maxSuccessExitCodes = 20
+
+// ValidateFailurePattern checks that the failure pattern of a template is a regular expression
+func ValidateFailurePattern(pattern *string) error {
+	if pattern == nil {
+		return nil
+	}
+
+	if len(*pattern) > maxFailurePatternLength {
+		return errors.New("Failure pattern can be at most 1024 characters long")
+	}
+
+	if _, err := regexp.Compile(*pattern); err != nil {
+		return errors.New("Failure pattern is not a valid regular expression: " + err.Error())
+	}
+
+	return nil
+}
+
+// ParseSuccessExitCodes decodes the exit codes stored in Template.SuccessExitCodes
+func ParseSuccessExitCodes(codes *string) ([]int, error) {
+	var res []int
+	if codes == nil || len(*codes) == 0 {
+		return res, nil
+	}
+
+	err := json.Unmarshal([]byte(*codes), &res)
+	return res, err
+}
+
+// ValidateSuccessExitCodes checks that the success exit codes of a template are a JSON array of exit codes
+func ValidateSuccessExitCodes(codes *string) error {
+	list, err := ParseSuccessExitCodes(codes)
+	if err != nil {
+		return errors.New("Success exit codes must be a JSON array of numbers")
+	}
+
+	if len(list) > maxSuccessExitCodes {
+		return errors.New("A template can count at most 20 exit codes as success")
+	}
+
+	for _, code := range list {
+		if code < 1 || code > 255 {
+			return errors.New("Success exit codes must be between 1 and 255")
+		}
+	}
+
+	return nil
+}
+
+// maxAllowedArgs limits how many flags the allow-list of a template can have
+const maxAllowedArgs = 50
+
+// ParseAllowedArgs decodes the flags stored in Template.AllowedArgs, nil when tasks can pass any arguments
+func ParseAllowedArgs(allowed *string) ([]string, error) {
+	if allowed == nil || len(*allowed) == 0 {
+		return nil, nil
+	}
+
+	flags := []string{}
+	err := json.Unmarshal([]byte(*allowed), &flags)
+	return flags, err
+}
+
+// ValidateAllowedArgs checks the flags stored in Template.AllowedArgs
+func ValidateAllowedArgs(allowed *string) error {
+	flags, err := ParseAllowedArgs(allowed)
+	if err != nil {
+		return errors.New("Allowed args must be a JSON array of flags")
+	}
+
+	if len(flags) > maxAllowedArgs {
+		return errors.New("A template can allow at most " + strconv.Itoa(maxAllowedArgs) + " flags")
+	}
+
+	for _, flag := range flags {
+		name := strings.TrimSuffix(flag, "=")
+		if len(name) < 2 || name[0] != '-' || strings.ContainsAny(name, " \t\n=") {
+			return errors.New("Allowed arg " + flag + " must be a flag like --check or --tags=")
+		}
+	}
+
+	return nil
+}
+
+// ParseArtifacts decodes the artifact paths stored in Template.Artifacts
+func ParseArtifacts(artifacts *string) ([]string, error) {
+	var paths []string
+	if artifacts == nil || len(*artifacts) == 0 {
+		return paths, nil
+	}
+
+	err := json.Unmarshal([]byte(*artifacts), &paths)
+	return paths, err
+}
+
+// ParseEnv decodes the json object of os environment variables stored in Template.Env and Task.Env
+func ParseEnv(env *string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if env == nil || len(*env) == 0 {
+		return vars, nil
+	}
+
+	err := json.Unmarshal([]byte(*env), &vars)
+	return vars, err
+}
+
+// ValidateArtifacts checks the artifact paths stored in Template.Artifacts
+func ValidateArtifacts(artifacts *string) error {
+	paths, err := ParseArtifacts(artifacts)
+	if err != nil {
+		return errors.New("Artifacts must be a JSON array of paths")
+	}
+
+	if len(paths) > maxTemplateArtifacts {
+		return errors.New("A template can have at most 20 artifact paths")
+	}
+
+	for _, path := range paths {
+		if len(path) == 0 || !util.IsSubPath(path) {
+			return errors.New("Artifact paths must be relative to the working directory")
+		}
+
+		if _, err := filepath.Match(path, ""); err != nil {
+			return errors.New("Artifact path " + path + " is not a valid pattern")
+		}
+	}
+
+	return nil
+}
+
+// ParseNotifications decodes the notification targets stored in Template.Notifications
+func ParseNotifications(notifications *string) ([]TemplateNotification, error) {
+	var targets []TemplateNotification
+	if notifications == nil || len(*notifications) == 0 {
+		return targets, nil
+	}
+
+	err := json.Unmarshal([]byte(*notifications), &targets)
+	return targets, err
+}
+
+// ValidateNotifications checks the notification targets stored in Template.Notifications
+func ValidateNotifications(notifications *string) error {
+	targets, err := ParseNotifications(notifications)
+	if err != nil {
+		return errors.New("Notifications must be a JSON array of targets")
+	}
+
+	if len(targets) > maxTemplateNotifications {
+		return errors.New("A template can have at most 20 notification targets")
+	}
+
+	for _, target := range targets {
+		if (len(target.Email) == 0) == (len(target.Webhook) == 0) {
+			return errors.New("Each notification target must have either an email or a webhook")
+		}
+
+		if len(target.Email) > 0 {
+			if _, err := mail.ParseAddress(target.Email); err != nil {
+				return errors.New("Notification email " + target.Email + " is not valid")
+			}
+		}
+
+		if len(target.Webhook) > 0 {
+			if u, err := url.Parse(target.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return errors.New("Notification webhook must be an http or https URL")
+			}
+		}
+
+		for _, status := range target.Statuses {
+			if status != TaskSuccessStatus && status != TaskErrorStatus && status != TaskStoppedStatus {
+				return errors.New("Notification statuses can be success, error and stopped")
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateRunnerTag ensures a runner tag is a name or a name=value pair of letters, digits, dots, dashes and underscores
+func ValidateRunnerTag(tag *string) error {
+	if tag == nil {
+		return nil
+	}
+
+	if len(*tag) > maxRunnerTagLength {
+		return errors.New("Runner tag can be at most " + strconv.Itoa(maxRunnerTagLength) + " characters long")
+	}
+
+	if !runnerTagRegexp.MatchString(*tag) {
+		return errors.New("Runner tag must be a name or a name=value pair of letters, digits, dots, dashes and underscores")
+	}
+
+	return nil
 }
@@ -15,6 +15,9 @@ type User struct {
 	Admin    bool      `db:"admin" json:"admin"`
 	External bool      `db:"external" json:"external"`
 	Alert    bool      `db:"alert" json:"alert"`
+
+	// project the user navigated into most recently
+	LastProjectID *int `db:"last_project_id" json:"last_project_id"`
 }
 
 //FetchUser retrieves a user from the database by ID
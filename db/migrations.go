@@ -130,3 +130,29 @@ func MigrateAll() error {
 
 	return nil
 }
+
+// PendingMigrations returns the migrations which haven't run yet, all of them on a fresh database.
+// Unlike MigrateAll it doesn't write to the database
+func PendingMigrations() ([]*Version, error) {
+	var applied []string
+	if _, err := Mysql.Select(&applied, "select version from migrations"); err != nil {
+		// 1146 is mysql table does not exist
+		if mysqlErr, ok := err.(*mysql.MySQLError); !ok || mysqlErr.Number != 1146 {
+			return nil, err
+		}
+	}
+
+	exists := make(map[string]bool, len(applied))
+	for _, version := range applied {
+		exists[version] = true
+	}
+
+	var pending []*Version
+	for _, version := range Versions {
+		if !exists[version.VersionString()] {
+			pending = append(pending, version)
+		}
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD env text null AFTER override_args;
+ALTER TABLE task ADD env text null AFTER arguments;
@@ -0,0 +1,2 @@
+ALTER TABLE user ADD last_project_id int(11) null AFTER alert;
+ALTER TABLE user ADD FOREIGN KEY (`last_project_id`) REFERENCES project(`id`) ON DELETE SET NULL;
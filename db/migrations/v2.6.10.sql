@@ -0,0 +1,2 @@
+ALTER TABLE task ADD diff tinyint(1) not null default 0 AFTER dry_run;
+ALTER TABLE task__output ADD diff tinyint(1) not null default 0 AFTER output;
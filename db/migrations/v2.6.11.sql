@@ -0,0 +1 @@
+ALTER TABLE project ADD archived tinyint(1) not null default 0 AFTER alert_chat;
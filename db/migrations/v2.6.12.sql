@@ -0,0 +1 @@
+ALTER TABLE project__repository ADD http_proxy varchar(255) null, ADD ssh_proxy_jump varchar(255) null;
@@ -0,0 +1 @@
+ALTER TABLE task ADD initiator varchar(20) not null default 'user' AFTER user_id, ADD api_token_id varchar(44) null AFTER initiator;
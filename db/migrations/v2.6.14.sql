@@ -0,0 +1 @@
+ALTER TABLE project__template ADD group_name varchar(255) null AFTER alias;
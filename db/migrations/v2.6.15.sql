@@ -0,0 +1,9 @@
+create table task__inventory (
+	`task_id` int(11) not null,
+	`inventory_id` int(11) not null,
+	`position` int(11) not null,
+
+	unique key `task_inventory` (`task_id`, `inventory_id`),
+	foreign key (`task_id`) references task(`id`) on delete cascade,
+	foreign key (`inventory_id`) references project__inventory(`id`) on delete cascade
+) ENGINE=InnoDB CHARSET=utf8;
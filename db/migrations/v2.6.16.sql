@@ -0,0 +1 @@
+ALTER TABLE access_key ADD description text null AFTER name, ADD created datetime null, ADD last_used datetime null;
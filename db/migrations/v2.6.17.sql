@@ -0,0 +1,12 @@
+ALTER TABLE project__template ADD artifacts text null;
+
+create table task__artifact (
+	`id` int(11) not null primary key auto_increment,
+	`task_id` int(11) not null,
+	`name` varchar(255) not null,
+	`size` int(11) not null,
+	`content` longblob not null,
+	`created` datetime not null,
+
+	foreign key (`task_id`) references task(`id`) on delete cascade
+) ENGINE=InnoDB CHARSET=utf8;
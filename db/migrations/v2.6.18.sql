@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD required_template_id int(11) null, ADD required_within int(11) null,
+	ADD foreign key (`required_template_id`) references project__template(`id`) on delete set null;
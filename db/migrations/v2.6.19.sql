@@ -0,0 +1 @@
+ALTER TABLE project__template ADD notifications text null;
@@ -0,0 +1,8 @@
+create table task__label (
+	`task_id` int(11) not null,
+	`label` varchar(32) not null,
+
+	unique key `task_label` (`task_id`, `label`),
+	key `label` (`label`),
+	foreign key (`task_id`) references task(`id`) on delete cascade
+) ENGINE=InnoDB CHARSET=utf8;
@@ -0,0 +1 @@
+ALTER TABLE project__template ADD run_window text null;
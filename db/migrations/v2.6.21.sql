@@ -0,0 +1,2 @@
+ALTER TABLE project__inventory ADD limits text null;
+ALTER TABLE task ADD host_limit varchar(1000) null;
@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD forks int(11) null;
+ALTER TABLE task ADD forks int(11) null;
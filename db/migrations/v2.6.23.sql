@@ -0,0 +1 @@
+ALTER TABLE task ADD command text null;
@@ -0,0 +1 @@
+ALTER TABLE task ADD output_truncated tinyint(1) not null default 0;
@@ -0,0 +1,4 @@
+ALTER TABLE project ADD default_inventory_id int(11) null, ADD default_repository_id int(11) null, ADD default_environment_id int(11) null,
+	ADD foreign key (`default_inventory_id`) references project__inventory(`id`) on delete set null,
+	ADD foreign key (`default_repository_id`) references project__repository(`id`) on delete set null,
+	ADD foreign key (`default_environment_id`) references project__environment(`id`) on delete set null;
@@ -0,0 +1,9 @@
+create table project__template_hook (
+	`template_id` int(11) not null primary key,
+	`token` varchar(64) not null,
+	`secret` varchar(255) not null,
+	`branches` text null,
+
+	unique key (`token`),
+	foreign key (`template_id`) references project__template(`id`) on delete cascade
+) ENGINE=InnoDB CHARSET=utf8;
@@ -0,0 +1 @@
+ALTER TABLE project__template ADD failure_pattern varchar(1024) null, ADD success_exit_codes varchar(255) null;
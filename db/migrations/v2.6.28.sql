@@ -0,0 +1,2 @@
+ALTER TABLE project ADD keep_tasks int(11) null;
+ALTER TABLE project__template ADD keep_tasks int(11) null;
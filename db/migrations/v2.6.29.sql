@@ -0,0 +1,3 @@
+ALTER TABLE task ADD retry_hosts text null;
+ALTER TABLE task ADD retry_of int(11) null;
+ALTER TABLE task ADD FOREIGN KEY (retry_of) REFERENCES task(id) ON DELETE SET NULL;
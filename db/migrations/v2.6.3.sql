@@ -0,0 +1,3 @@
+ALTER TABLE project ADD vars text null AFTER alert_chat;
+ALTER TABLE project__inventory ADD vars text null AFTER type;
+ALTER TABLE task ADD vars longtext null AFTER env;
@@ -0,0 +1,2 @@
+ALTER TABLE project__repository ADD require_signature boolean not null default false;
+ALTER TABLE project__repository ADD trusted_keys text null;
@@ -0,0 +1,12 @@
+ALTER TABLE task ADD message varchar(1000) null;
+
+create table task__comment (
+	`id` int(11) not null primary key auto_increment,
+	`task_id` int(11) not null,
+	`user_id` int(11) null,
+	`comment` text not null,
+	`created` datetime not null,
+
+	foreign key (`task_id`) references task(`id`) on delete cascade,
+	foreign key (`user_id`) references user(`id`) on delete set null
+) ENGINE=InnoDB CHARSET=utf8;
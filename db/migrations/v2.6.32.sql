@@ -0,0 +1 @@
+ALTER TABLE task__output ADD stream varchar(6) not null default 'stdout';
@@ -0,0 +1,5 @@
+ALTER TABLE project__template ADD max_retries int(11) null;
+ALTER TABLE project__template ADD retry_delay int(11) null;
+ALTER TABLE task ADD parent_id int(11) null;
+ALTER TABLE task ADD retry_count int(11) not null default 0;
+ALTER TABLE task ADD FOREIGN KEY (parent_id) REFERENCES task(id) ON DELETE SET NULL;
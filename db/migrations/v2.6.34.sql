@@ -0,0 +1 @@
+ALTER TABLE project__environment ADD secrets text null;
@@ -0,0 +1 @@
+ALTER TABLE task__output ADD seq bigint not null default 0;
@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD production tinyint(1) not null default 0;
+ALTER TABLE project__inventory ADD production tinyint(1) not null default 0;
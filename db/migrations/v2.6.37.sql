@@ -0,0 +1 @@
+ALTER TABLE project ADD webhook_headers text null;
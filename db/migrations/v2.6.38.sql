@@ -0,0 +1,18 @@
+ALTER TABLE task ADD tasks_done int(11) not null default 0;
+ALTER TABLE task ADD tasks_total int(11) null;
+
+create table task__host (
+	`task_id` int(11) not null,
+	`host` varchar(255) not null,
+	`status` varchar(20) not null,
+	`ok` int(11) not null default 0,
+	`changed` int(11) not null default 0,
+	`failed` int(11) not null default 0,
+	`unreachable` int(11) not null default 0,
+	`skipped` int(11) not null default 0,
+	`rescued` int(11) not null default 0,
+	`ignored` int(11) not null default 0,
+
+	primary key (`task_id`, `host`),
+	foreign key (`task_id`) references task(`id`) on delete cascade
+) ENGINE=InnoDB CHARSET=utf8;
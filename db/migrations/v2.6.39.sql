@@ -0,0 +1 @@
+ALTER TABLE project__template MODIFY inventory_id int(11) null;
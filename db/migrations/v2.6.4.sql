@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD requirements_path varchar(255) null AFTER env;
+ALTER TABLE project__template ADD requirements text null AFTER requirements_path;
@@ -0,0 +1 @@
+ALTER TABLE project__template ADD resource varchar(255) null;
@@ -0,0 +1,2 @@
+ALTER TABLE access_key ADD restricted tinyint(1) not null default 0, ADD created_by int(11) null,
+	ADD foreign key (`created_by`) references user(`id`) on delete set null;
@@ -0,0 +1 @@
+ALTER TABLE task ADD inventory mediumtext null;
@@ -0,0 +1 @@
+ALTER TABLE task ADD commit_hash varchar(64) null, ADD commit_message varchar(100) null;
@@ -0,0 +1 @@
+ALTER TABLE project__repository ADD cached_clone boolean not null default false;
@@ -0,0 +1 @@
+ALTER TABLE project__template ADD allowed_args text null;
@@ -0,0 +1 @@
+ALTER TABLE project ADD known_hosts mediumtext null;
@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD runner_tag varchar(255) null;
+ALTER TABLE task ADD runner_tag varchar(255) null;
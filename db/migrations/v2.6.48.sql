@@ -0,0 +1 @@
+ALTER TABLE task ADD notes text null;
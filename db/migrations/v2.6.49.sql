@@ -0,0 +1,3 @@
+ALTER TABLE task ADD api_token_hint varchar(10) null AFTER api_token_id;
+UPDATE task SET api_token_hint=IF(length(api_token_id) > 6, concat(left(api_token_id, 6), '...'), api_token_id), api_token_id=sha2(api_token_id, 256) WHERE api_token_id is not null;
+ALTER TABLE task CHANGE api_token_id api_token_hash varchar(64) null;
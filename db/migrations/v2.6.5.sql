@@ -0,0 +1 @@
+ALTER TABLE project__template ADD working_directory varchar(255) null AFTER requirements;
@@ -0,0 +1,2 @@
+INSERT INTO task__comment (task_id, user_id, comment, created) SELECT id, null, notes, coalesce(`end`, created) FROM task WHERE notes is not null;
+ALTER TABLE task DROP COLUMN notes;
@@ -0,0 +1,2 @@
+ALTER TABLE project ADD webhook_url varchar(255) null AFTER alert_chat;
+ALTER TABLE project ADD webhook_secret varchar(255) null AFTER webhook_url;
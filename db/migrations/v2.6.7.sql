@@ -0,0 +1,2 @@
+ALTER TABLE project__template ADD survey_vars text null AFTER working_directory;
+ALTER TABLE task ADD survey text null AFTER vars;
@@ -0,0 +1 @@
+ALTER TABLE project__template_schedule ADD timezone varchar(64) null AFTER cron_format;
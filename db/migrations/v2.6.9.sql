@@ -0,0 +1,3 @@
+ALTER TABLE task ADD external_id varchar(255) null AFTER user_id;
+ALTER TABLE task ADD source varchar(255) null AFTER external_id;
+ALTER TABLE task ADD INDEX external_id (external_id);
@@ -10,6 +10,8 @@ func SetupDBLink() {
 	Mysql.AddTableWithName(Repository{}, "project__repository").SetKeys(true, "id")
 	Mysql.AddTableWithName(Task{}, "task").SetKeys(true, "id")
 	Mysql.AddTableWithName(TaskOutput{}, "task__output").SetUniqueTogether("task_id", "time")
+	Mysql.AddTableWithName(TaskArtifact{}, "task__artifact").SetKeys(true, "id")
+	Mysql.AddTableWithName(TaskHost{}, "task__host").SetKeys(false, "task_id", "host")
 	Mysql.AddTableWithName(Template{}, "project__template").SetKeys(true, "id")
 	Mysql.AddTableWithName(User{}, "user").SetKeys(true, "id")
 	Mysql.AddTableWithName(Session{}, "session").SetKeys(true, "id")
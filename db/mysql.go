@@ -55,6 +55,17 @@ func Connect() error {
 	return nil
 }
 
+// Ping checks that the database of the config is reachable. Unlike Connect it doesn't create a missing database
+func Ping() error {
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close() // nolint: errcheck
+
+	return db.Ping()
+}
+
 // Close closes the mysql connection and reports any errors
 // called from main with a defer
 func Close() {
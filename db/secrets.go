@@ -0,0 +1,89 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/fiftin/semaphore/util"
+)
+
+// parseEncryptedValues decodes a json object of values encrypted with util.EncryptSecret, nil is an empty set
+func parseEncryptedValues(js *string) (map[string]string, error) {
+	values := make(map[string]string)
+	if js == nil || len(*js) == 0 {
+		return values, nil
+	}
+
+	err := json.Unmarshal([]byte(*js), &values)
+	return values, err
+}
+
+// redactValues lists the names of the encrypted values with null values, the way the api returns them
+func redactValues(js *string) (map[string]*string, error) {
+	values, err := parseEncryptedValues(js)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := make(map[string]*string)
+	for name := range values {
+		redacted[name] = nil
+	}
+
+	return redacted, nil
+}
+
+// encryptValues encrypts the values sent by a client into the json stored. A null value keeps the value
+// of stored, a name missing from values drops it. Returns nil when there are no values
+func encryptValues(values map[string]*string, stored *string) (*string, error) {
+	old, err := parseEncryptedValues(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make(map[string]string)
+	for name, val := range values {
+		if val == nil {
+			secret, ok := old[name]
+			if !ok {
+				return nil, errors.New("'" + name + "' has no value")
+			}
+			encrypted[name] = secret
+			continue
+		}
+
+		secret, err := util.EncryptSecret(*val)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[name] = secret
+	}
+
+	if len(encrypted) == 0 {
+		return nil, nil
+	}
+
+	js, err := json.Marshal(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	result := string(js)
+	return &result, nil
+}
+
+// decryptValues returns the plain values of a json object of encrypted values
+func decryptValues(js *string) (map[string]string, error) {
+	values, err := parseEncryptedValues(js)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, val := range values {
+		if values[name], err = util.DecryptSecret(val); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
@@ -83,5 +83,56 @@ func init() {
 		{Major: 2, Minor: 4},
 		{Major: 2, Minor: 5},
 		{Major: 2, Minor: 5, Patch: 2},
+		{Major: 2, Minor: 6},
+		{Major: 2, Minor: 6, Patch: 1},
+		{Major: 2, Minor: 6, Patch: 2},
+		{Major: 2, Minor: 6, Patch: 3},
+		{Major: 2, Minor: 6, Patch: 4},
+		{Major: 2, Minor: 6, Patch: 5},
+		{Major: 2, Minor: 6, Patch: 6},
+		{Major: 2, Minor: 6, Patch: 7},
+		{Major: 2, Minor: 6, Patch: 8},
+		{Major: 2, Minor: 6, Patch: 9},
+		{Major: 2, Minor: 6, Patch: 10},
+		{Major: 2, Minor: 6, Patch: 11},
+		{Major: 2, Minor: 6, Patch: 12},
+		{Major: 2, Minor: 6, Patch: 13},
+		{Major: 2, Minor: 6, Patch: 14},
+		{Major: 2, Minor: 6, Patch: 15},
+		{Major: 2, Minor: 6, Patch: 16},
+		{Major: 2, Minor: 6, Patch: 17},
+		{Major: 2, Minor: 6, Patch: 18},
+		{Major: 2, Minor: 6, Patch: 19},
+		{Major: 2, Minor: 6, Patch: 20},
+		{Major: 2, Minor: 6, Patch: 21},
+		{Major: 2, Minor: 6, Patch: 22},
+		{Major: 2, Minor: 6, Patch: 23},
+		{Major: 2, Minor: 6, Patch: 24},
+		{Major: 2, Minor: 6, Patch: 25},
+		{Major: 2, Minor: 6, Patch: 26},
+		{Major: 2, Minor: 6, Patch: 27},
+		{Major: 2, Minor: 6, Patch: 28},
+		{Major: 2, Minor: 6, Patch: 29},
+		{Major: 2, Minor: 6, Patch: 30},
+		{Major: 2, Minor: 6, Patch: 31},
+		{Major: 2, Minor: 6, Patch: 32},
+		{Major: 2, Minor: 6, Patch: 33},
+		{Major: 2, Minor: 6, Patch: 34},
+		{Major: 2, Minor: 6, Patch: 35},
+		{Major: 2, Minor: 6, Patch: 36},
+		{Major: 2, Minor: 6, Patch: 37},
+		{Major: 2, Minor: 6, Patch: 38},
+		{Major: 2, Minor: 6, Patch: 39},
+		{Major: 2, Minor: 6, Patch: 40},
+		{Major: 2, Minor: 6, Patch: 41},
+		{Major: 2, Minor: 6, Patch: 42},
+		{Major: 2, Minor: 6, Patch: 43},
+		{Major: 2, Minor: 6, Patch: 44},
+		{Major: 2, Minor: 6, Patch: 45},
+		{Major: 2, Minor: 6, Patch: 46},
+		{Major: 2, Minor: 6, Patch: 47},
+		{Major: 2, Minor: 6, Patch: 48},
+		{Major: 2, Minor: 6, Patch: 49},
+		{Major: 2, Minor: 6, Patch: 50},
 	}
 }
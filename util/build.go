@@ -0,0 +1,8 @@
+package util
+
+// Commit and BuildDate describe the build, release builds set them with
+// -ldflags "-X github.com/fiftin/semaphore/util.Commit=<sha> -X github.com/fiftin/semaphore/util.BuildDate=<date>"
+var (
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
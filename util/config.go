@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"runtime"
+	"time"
 
 	"net/url"
 
@@ -29,6 +32,9 @@ var InteractiveSetup bool
 // Upgrade indicates that we should perform an upgrade action
 var Upgrade bool
 
+// CheckConfig indicates that the config should be validated instead of starting the server
+var CheckConfig bool
+
 // WebHostURL is the public route to the semaphore server
 var WebHostURL *url.URL
 
@@ -65,10 +71,26 @@ type ConfigType struct {
 	// semaphore stores ephemeral projects here
 	TmpPath string `json:"tmp_path"`
 
+	// uid and gid git and ansible processes of tasks run as, e.g. an unprivileged
+	// service account when semaphore runs as root. Unset runs them as the semaphore user
+	RunAsUID *int `json:"run_as_uid"`
+	RunAsGID *int `json:"run_as_gid"`
+
 	// cookie hashing & encryption
 	CookieHash       string `json:"cookie_hash"`
 	CookieEncryption string `json:"cookie_encryption"`
 
+	// base64 encoded 32 byte key the passwords of login/password access keys are encrypted with
+	AccessKeyEncryption string `json:"access_key_encryption"`
+
+	// session cookie attributes
+	CookieName   string `json:"cookie_name"`
+	CookieDomain string `json:"cookie_domain"`
+	// lax/strict/none, defaults to lax
+	CookieSameSite string `json:"cookie_samesite"`
+	// defaults to true
+	CookieHTTPOnly *bool `json:"cookie_httponly"`
+
 	// email alerting
 	EmailSender string `json:"email_sender"`
 	EmailHost   string `json:"email_host"`
@@ -76,6 +98,8 @@ type ConfigType struct {
 
 	// web host
 	WebHost string `json:"web_host"`
+	// origins besides the one of web_host the websocket accepts, e.g. https://dashboard.example.com
+	WebsocketOrigins []string `json:"websocket_origins"`
 
 	// ldap settings
 	LdapBindDN       string       `json:"ldap_binddn"`
@@ -89,9 +113,45 @@ type ConfigType struct {
 	TelegramChat  string `json:"telegram_chat"`
 	TelegramToken string `json:"telegram_token"`
 
+	// private galaxy server used to install requirements
+	GalaxyServerURL   string `json:"galaxy_server_url"`
+	GalaxyServerToken string `json:"galaxy_server_token"`
+
+	// external sink task output is shipped to, http or syslog
+	LogSink string `json:"log_sink"`
+	// url receiving batches of json entries for the http sink,
+	// address like udp://host:514 for the syslog sink, empty for the local syslog
+	LogSinkURL string `json:"log_sink_url"`
+
+	// default timezone of task schedules, e.g. Europe/Berlin, defaults to UTC
+	Timezone string `json:"timezone"`
+
+	// language of api messages for clients without a supported Accept-Language, and of notifications.
+	// en or fr, defaults to en
+	Language string `json:"language"`
+
+	// milliseconds task output lines are collected for before they are sent to the browser
+	// in a single websocket frame, e.g. 200. Defaults to 0 which sends every line right away
+	OutputFlushInterval int `json:"output_flush_interval"`
+
+	// bytes of artifacts stored per task, defaults to 2MB
+	MaxArtifactsSize int `json:"max_artifacts_size"`
+
+	// bytes of output stored per task, the rest is only streamed. Defaults to 0 which doesn't limit the output
+	MaxOutputSize int `json:"max_output_size"`
+
+	// megabytes free on the tmp_path filesystem below which the system info reports low disk space, defaults to 1024
+	TmpFreeWarning int `json:"tmp_free_warning"`
+
+	// --forks of templates which don't set it, 0 keeps the ansible default
+	DefaultForks int `json:"default_forks"`
+
 	// task concurrency
 	ConcurrencyMode  string `json:"concurrency_mode"`
 	MaxParallelTasks int    `json:"max_parallel_tasks"`
+	// labels like region=eu this runner advertises, tasks of templates with a runner tag wait
+	// in the queue until a runner advertising the tag picks them up
+	RunnerTags []string `json:"runner_tags"`
 
 	// configType field ordering with bools at end reduces struct size
 	// (maligned check)
@@ -101,6 +161,12 @@ type ConfigType struct {
 	TelegramAlert bool `json:"telegram_alert"`
 	LdapEnable    bool `json:"ldap_enable"`
 	LdapNeedTLS   bool `json:"ldap_needtls"`
+	CookieSecure  bool `json:"cookie_secure"`
+	// don't run db migrations on startup, they are run by `semaphore migrate` instead
+	// and the server refuses to start while some are pending
+	DisableAutoMigrate bool `json:"disable_auto_migrate"`
+	// don't pass the metadata of tasks to ansible as the semaphore extra var
+	DisableTaskVars bool `json:"disable_task_vars"`
 }
 
 //Config exposes the application configuration storage for use in the application
@@ -119,6 +185,10 @@ func ConfigInit() {
 	flag.BoolVar(&InteractiveSetup, "setup", false, "perform interactive setup")
 	flag.BoolVar(&Migration, "migrate", false, "execute migrations")
 	flag.BoolVar(&Upgrade, "upgrade", false, "upgrade semaphore")
+	flag.BoolVar(&CheckConfig, "check-config", false, "check the database, tmp path and ansible, then exit")
+
+	var noAutoMigrate bool
+	flag.BoolVar(&noAutoMigrate, "no-auto-migrate", false, "don't run db migrations on startup, like disable_auto_migrate")
 	confPath = flag.String("config", "", "config path")
 
 	var unhashedPwd string
@@ -169,6 +239,10 @@ func ConfigInit() {
 	loadConfig()
 	validateConfig()
 
+	if noAutoMigrate {
+		Config.DisableAutoMigrate = true
+	}
+
 	var encryption []byte
 
 	hash, _ := base64.StdEncoding.DecodeString(Config.CookieHash)
@@ -214,6 +288,137 @@ func validateConfig() {
 	if Config.MaxParallelTasks < 1 {
 		Config.MaxParallelTasks = 10
 	}
+
+	if Config.MaxArtifactsSize < 1 {
+		Config.MaxArtifactsSize = 2 << 20
+	}
+
+	if Config.MaxOutputSize < 0 {
+		Config.MaxOutputSize = 0
+	}
+
+	if Config.TmpFreeWarning < 1 {
+		Config.TmpFreeWarning = 1024
+	}
+
+	tags := make([]string, 0, len(Config.RunnerTags))
+	for _, tag := range Config.RunnerTags {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	Config.RunnerTags = tags
+
+	if Config.DefaultForks < 0 {
+		Config.DefaultForks = 0
+	}
+
+	validateCookie()
+	validateTimezone()
+	validateLanguage()
+	validateRunAs()
+}
+
+func validateRunAs() {
+	if Config.RunAsUID == nil && Config.RunAsGID == nil {
+		return
+	}
+
+	var err string
+	switch {
+	case runtime.GOOS == "windows" || runtime.GOOS == "plan9":
+		err = "run_as_uid and run_as_gid are not supported on " + runtime.GOOS
+	case Config.RunAsUID == nil || Config.RunAsGID == nil:
+		err = "run_as_uid and run_as_gid must be set together"
+	case *Config.RunAsUID < 0 || *Config.RunAsGID < 0:
+		err = "run_as_uid and run_as_gid must not be negative"
+	default:
+		return
+	}
+
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func validateTimezone() {
+	if _, err := time.LoadLocation(Config.Timezone); err != nil {
+		fmt.Println("Unknown timezone " + Config.Timezone + ", schedules default to UTC")
+		Config.Timezone = "UTC"
+	}
+}
+
+func validateLanguage() {
+	if len(Config.Language) == 0 {
+		Config.Language = defaultLanguage
+	} else if !IsSupportedLanguage(Config.Language) {
+		fmt.Println("Unsupported language " + Config.Language + ", messages default to " + defaultLanguage)
+		Config.Language = defaultLanguage
+	}
+}
+
+// ScheduleLocation returns the location cron expressions of a schedule are evaluated in,
+// which is the timezone of the schedule or else the configured default timezone
+func ScheduleLocation(timezone *string) (*time.Location, error) {
+	if timezone != nil && len(*timezone) > 0 {
+		return time.LoadLocation(*timezone)
+	}
+
+	return time.LoadLocation(Config.Timezone)
+}
+
+func validateCookie() {
+	if len(Config.CookieName) == 0 {
+		Config.CookieName = "semaphore"
+	}
+
+	switch strings.ToLower(Config.CookieSameSite) {
+	case "strict", "none":
+		Config.CookieSameSite = strings.ToLower(Config.CookieSameSite)
+	default:
+		Config.CookieSameSite = "lax"
+	}
+
+	if Config.CookieHTTPOnly == nil {
+		httpOnly := true
+		Config.CookieHTTPOnly = &httpOnly
+	}
+}
+
+// WebPath returns the path semaphore is served under, e.g. /semaphore/ when hosted behind
+// a reverse proxy. It always ends with a slash and defaults to the root path
+func WebPath() string {
+	if WebHostURL == nil || len(WebHostURL.Path) == 0 {
+		return "/"
+	}
+
+	if !strings.HasSuffix(WebHostURL.Path, "/") {
+		return WebHostURL.Path + "/"
+	}
+
+	return WebHostURL.Path
+}
+
+// NewSessionCookie returns the session cookie with the attributes set in the configuration.
+// The cookie path follows WebPath so that semaphore can be hosted under a subpath
+func NewSessionCookie(value string, expires time.Time) *http.Cookie {
+	sameSite := http.SameSiteLaxMode
+	switch Config.CookieSameSite {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &http.Cookie{
+		Name:     Config.CookieName,
+		Value:    value,
+		Path:     WebPath(),
+		Domain:   Config.CookieDomain,
+		Expires:  expires,
+		Secure:   Config.CookieSecure,
+		HttpOnly: *Config.CookieHTTPOnly,
+		SameSite: sameSite,
+	}
 }
 
 func validatePort() {
@@ -244,13 +449,15 @@ func decodeConfig(file io.Reader) {
 	}
 }
 
-//GenerateCookieSecrets generates cookie secret during setup
+//GenerateCookieSecrets generates cookie secret and the access key encryption key during setup
 func (conf *ConfigType) GenerateCookieSecrets() {
 	hash := securecookie.GenerateRandomKey(32)
 	encryption := securecookie.GenerateRandomKey(32)
+	accessKeyEncryption := securecookie.GenerateRandomKey(32)
 
 	conf.CookieHash = base64.StdEncoding.EncodeToString(hash)
 	conf.CookieEncryption = base64.StdEncoding.EncodeToString(encryption)
+	conf.AccessKeyEncryption = base64.StdEncoding.EncodeToString(accessKeyEncryption)
 }
 
 // Scan creates configuration.
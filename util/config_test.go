@@ -1,8 +1,10 @@
 package util
 
 import (
+	"net/http"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestValidatePort(t *testing.T) {
@@ -26,3 +28,26 @@ func TestValidatePort(t *testing.T) {
 		t.Error("Port value should be overwritten by env var, and it should be prefixed appropriately")
 	}
 }
+
+func TestValidateCookie(t *testing.T) {
+	Config = new(ConfigType)
+	Config.CookieSameSite = "Strict"
+	validateCookie()
+
+	if Config.CookieName != "semaphore" {
+		t.Error("cookie name should default to semaphore")
+	}
+
+	if Config.CookieSameSite != "strict" {
+		t.Error("cookie samesite value should be normalized")
+	}
+
+	if Config.CookieHTTPOnly == nil || !*Config.CookieHTTPOnly {
+		t.Error("cookie should be http only by default")
+	}
+
+	cookie := NewSessionCookie("value", time.Time{})
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Path != "/" {
+		t.Error("session cookie attributes should follow the configuration")
+	}
+}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed standard 5 field cron expression: minute hour day-of-month month day-of-week
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// cron matches either day field when both are restricted
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 7 is an alias of sunday
+	{"day of week", 0, 7},
+}
+
+// maxCronSearch bounds the search for the next run of schedules which never match, like February 30th
+const maxCronSearch = 366 * 24 * 60
+
+// ParseCron parses a cron expression. Fields support *, numbers, ranges (1-5), steps (*/15, 0-30/5) and lists (1,15)
+func ParseCron(expr string) (*CronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, errors.New("cron expression must have 5 fields: minute hour day-of-month month day-of-week")
+	}
+
+	bits := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseCronField(part, cronFields[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	dow := bits[4]
+	if dow&(1<<7) != 0 {
+		dow |= 1
+	}
+
+	return &CronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     dow,
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(expr, ",") {
+		rangeExpr, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rangeExpr = item[:i]
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, errors.New("invalid step in " + field.name + " field: " + item)
+			}
+		}
+
+		from, to := field.min, field.max
+		if rangeExpr != "*" {
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.New("invalid " + field.name + " field: " + item)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.New("invalid " + field.name + " field: " + item)
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the end in steps of 15
+				to = field.max
+			}
+		}
+
+		if from < field.min || to > field.max || from > to {
+			return 0, errors.New(field.name + " field out of range: " + item)
+		}
+
+		for n := from; n <= to; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+
+	return bits, nil
+}
+
+// Matches reports whether the schedule fires in the minute of t, evaluated in the location of t
+func (s *CronSchedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// Next returns the first minute after t the schedule fires in, evaluated in the location of t
+func (s *CronSchedule) Next(t time.Time) (time.Time, bool) {
+	next := t.Truncate(time.Minute)
+
+	for i := 0; i < maxCronSearch; i++ {
+		next = next.Add(time.Minute)
+		if s.Matches(next) {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
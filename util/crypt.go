@@ -0,0 +1,78 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// accessKeyEncryptionKey decodes the access_key_encryption config, a base64 encoded 32 byte AES key
+func accessKeyEncryptionKey() ([]byte, error) {
+	if len(Config.AccessKeyEncryption) == 0 {
+		return nil, errors.New("access_key_encryption is not configured")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(Config.AccessKeyEncryption)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("access_key_encryption must be 32 bytes encoded as base64")
+	}
+
+	return key, nil
+}
+
+func accessKeyCipher() (cipher.AEAD, error) {
+	key, err := accessKeyEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret encrypts an access key secret with AES-GCM, the nonce is prepended to the
+// ciphertext and the result is encoded as base64 so it can be stored in a text column
+func EncryptSecret(secret string) (string, error) {
+	gcm, err := accessKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(encrypted string) (string, error) {
+	gcm, err := accessKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt secret, was access_key_encryption changed?")
+	}
+
+	return string(secret), nil
+}
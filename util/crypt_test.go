@@ -0,0 +1,34 @@
+package util
+
+import "testing"
+
+func TestEncryptSecret(t *testing.T) {
+	oldConfig := Config
+	Config = &ConfigType{AccessKeyEncryption: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}
+	defer func() {
+		Config = oldConfig
+	}()
+
+	encrypted, err := EncryptSecret("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encrypted == "hunter2" {
+		t.Error("secret should be encrypted")
+	}
+
+	decrypted, err := DecryptSecret(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted != "hunter2" {
+		t.Errorf("decrypted secret should be hunter2, got %s", decrypted)
+	}
+
+	Config.AccessKeyEncryption = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	if _, err := DecryptSecret(encrypted); err == nil {
+		t.Error("decrypting with another key should fail")
+	}
+}
@@ -0,0 +1,19 @@
+// +build linux darwin freebsd
+
+package util
+
+import "syscall"
+
+// DiskUsage returns the free and used bytes of the filesystem the path is on.
+// Free space is what's available to unprivileged users, like semaphore's clones
+func DiskUsage(path string) (free uint64, used uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+
+	bsize := uint64(st.Bsize)
+	free = uint64(st.Bavail) * bsize
+	used = (uint64(st.Blocks) - uint64(st.Bfree)) * bsize
+	return
+}
@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!freebsd
+
+package util
+
+import (
+	"errors"
+	"runtime"
+)
+
+// DiskUsage is not supported on this platform
+func DiskUsage(path string) (free uint64, used uint64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is used when neither the request nor the config select a language of the catalog
+const defaultLanguage = "en"
+
+// Localize returns the message of the catalog in the language, formatted with args.
+// Messages missing in the language fall back to English, unknown ids are returned as they are
+func Localize(lang string, id string, args ...interface{}) string {
+	msg, ok := messages[lang][id]
+	if !ok {
+		if msg, ok = messages[defaultLanguage][id]; !ok {
+			return id
+		}
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// IsSupportedLanguage tells if the catalog has messages in the language
+func IsSupportedLanguage(lang string) bool {
+	_, ok := messages[lang]
+	return ok
+}
+
+// ConfigLanguage returns the language of messages which aren't answers to a request, like notifications
+func ConfigLanguage() string {
+	if Config != nil && IsSupportedLanguage(Config.Language) {
+		return Config.Language
+	}
+
+	return defaultLanguage
+}
+
+// RequestLanguage selects the language of the catalog the client prefers in its Accept-Language header,
+// or the configured language when it accepts none of them
+func RequestLanguage(r *http.Request) string {
+	type accepted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []accepted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+
+		// only the primary subtag is matched, fr-CA selects fr
+		lang := strings.ToLower(strings.SplitN(strings.TrimSpace(fields[0]), "-", 2)[0])
+		if len(lang) == 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if q > 0 {
+			langs = append(langs, accepted{lang, q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	for _, l := range langs {
+		if IsSupportedLanguage(l.lang) {
+			return l.lang
+		}
+	}
+
+	return ConfigLanguage()
+}
+
+// WriteLocalizedError writes an ErrorResponse whose message is the message id of the catalog in the language
+// of the request. The id is returned as well, so clients can tell errors apart whatever the language
+func WriteLocalizedError(w http.ResponseWriter, r *http.Request, code int, id string, details interface{}, args ...interface{}) {
+	WriteJSON(w, code, ErrorResponse{
+		Code:      code,
+		MessageID: id,
+		Message:   Localize(RequestLanguage(r), id, args...),
+		Details:   details,
+	})
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestLanguage(t *testing.T) {
+	Config = new(ConfigType)
+	Config.Language = "fr"
+
+	cases := map[string]string{
+		"":                        "fr",
+		"de-DE, de;q=0.9":         "fr",
+		"fr-CA,fr;q=0.9,en;q=0.8": "fr",
+		"de;q=0.9, en;q=0.5":      "en",
+		"en;q=0.5, fr;q=0.8":      "fr",
+		"fr;q=0, en":              "en",
+		"EN-us":                   "en",
+	}
+
+	for header, expected := range cases {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", header)
+
+		if lang := RequestLanguage(r); lang != expected {
+			t.Errorf("Accept-Language %q selected %s instead of %s", header, lang, expected)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	if msg := Localize("fr", MsgNameTaken, "web", "inventory"); msg != "Le nom web est déjà utilisé par un autre objet (inventory) du projet" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+
+	if msg := Localize("de", MsgProjectNotFound); msg != "Project not found" {
+		t.Errorf("Unsupported languages should fall back to English, got %s", msg)
+	}
+
+	for lang, catalog := range messages {
+		for id := range messages[defaultLanguage] {
+			if _, ok := catalog[id]; !ok {
+				t.Errorf("Message %s is missing in %s", id, lang)
+			}
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package util
+
+// ids of the messages of the catalog
+const (
+	MsgInvalidRequestBody     = "invalid_request_body"
+	MsgInvalidParam           = "invalid_param"
+	MsgAuthenticationRequired = "authentication_required"
+	MsgInvalidCredentials     = "invalid_credentials"
+	MsgInvalidSession         = "invalid_session"
+	MsgNotLoggedIn            = "not_logged_in"
+	MsgSessionExpired         = "session_expired"
+	MsgInvalidAPIToken        = "invalid_api_token"
+	MsgNotFound               = "not_found"
+	MsgProjectNotFound        = "project_not_found"
+	MsgTemplateNotFound       = "template_not_found"
+	MsgTaskNotFound           = "task_not_found"
+	MsgUserNotFound           = "user_not_found"
+	MsgInventoryNotFound      = "inventory_not_found"
+	MsgEnvironmentNotFound    = "environment_not_found"
+	MsgKeyNotFound            = "key_not_found"
+	MsgRepositoryNotFound     = "repository_not_found"
+	MsgProjectArchived        = "project_archived"
+	MsgNameTaken              = "name_taken"
+	MsgVarsNotObject          = "vars_not_object"
+	MsgInvalidJSON            = "invalid_json"
+	MsgMissingResources       = "missing_resources"
+	MsgOutsideRunWindow       = "outside_run_window"
+	MsgProductionNotConfirmed = "production_not_confirmed"
+	MsgOnlyAdminsDeleteTasks  = "only_admins_delete_tasks"
+
+	MsgInvalidInventoryType        = "invalid_inventory_type"
+	MsgAdminRemoveInventoryInUse   = "admin_remove_inventory_in_use"
+	MsgGroupTooLong                = "group_too_long"
+	MsgGroupNotFound               = "group_not_found"
+	MsgNotProjectMember            = "not_project_member"
+	MsgTemplateHasNoSchedule       = "template_has_no_schedule"
+	MsgUnknownTimezone             = "unknown_timezone"
+	MsgProjectAdminRequired        = "project_admin_required"
+	MsgInvalidWebhookURL           = "invalid_webhook_url"
+	MsgDefaultInventoryNotFound    = "default_inventory_not_found"
+	MsgDefaultRepositoryNotFound   = "default_repository_not_found"
+	MsgDefaultEnvironmentNotFound  = "default_environment_not_found"
+	MsgKeyNameEmpty                = "key_name_empty"
+	MsgInvalidForm                 = "invalid_form"
+	MsgInvalidKeyFile              = "invalid_key_file"
+	MsgSSHSecretEmpty              = "ssh_secret_empty"
+	MsgLoginEmpty                  = "login_empty"
+	MsgInvalidKeyType              = "invalid_key_type"
+	MsgPasswordEmpty               = "password_empty"
+	MsgTemplateHasNoHook           = "template_has_no_hook"
+	MsgHookSecretTooShort          = "hook_secret_too_short"
+	MsgEnvironmentInUse            = "environment_in_use"
+	MsgRepositoryInUse             = "repository_in_use"
+	MsgInventoryInUse              = "inventory_in_use"
+	MsgKeyInUse                    = "key_in_use"
+	MsgRequirementsAndPath         = "requirements_and_path"
+	MsgRequirementsPathNotRelative = "requirements_path_not_relative"
+	MsgPlaybookNotRelative         = "playbook_not_relative"
+	MsgWorkingDirectoryNotRelative = "working_directory_not_relative"
+	MsgResourceTooLong             = "resource_too_long"
+	MsgTemplateRequiresItself      = "template_requires_itself"
+	MsgInvalidRequiredWithin       = "invalid_required_within"
+	MsgRequiredTemplateNotFound    = "required_template_not_found"
+	MsgTimedOut                    = "timed_out"
+	MsgReservedVar                 = "reserved_var"
+	MsgAdminRequired               = "admin_required"
+	MsgAdminRemoveRepositoryInUse  = "admin_remove_repository_in_use"
+	MsgRepositoryKeyNotFound       = "repository_key_not_found"
+	MsgInvalidRepositoryKeyType    = "invalid_repository_key_type"
+	MsgInvalidHost                 = "invalid_host"
+	MsgInvalidPort                 = "invalid_port"
+	MsgNoHostKeys                  = "no_host_keys"
+	MsgSessionNotFound             = "session_not_found"
+	MsgInvalidActive               = "invalid_active"
+	MsgNotPositive                 = "not_positive"
+	MsgAdminCreateUsers            = "admin_create_users"
+	MsgCannotEditUser              = "cannot_edit_user"
+	MsgOwnRole                     = "own_role"
+	MsgExternalUsername            = "external_username"
+	MsgExternalPassword            = "external_password"
+	MsgCannotDeleteUser            = "cannot_delete_user"
+	MsgNoNotificationChannels      = "no_notification_channels"
+	MsgArgsAndArguments            = "args_and_arguments"
+	MsgNotInteger                  = "not_integer"
+	MsgEnvNotObject                = "env_not_object"
+	MsgInventoryAndInventoryIDs    = "inventory_and_inventory_ids"
+	MsgInvalidLimit                = "invalid_limit"
+	MsgTaskMessageTooLong          = "task_message_too_long"
+	MsgExternalIDTooLong           = "external_id_too_long"
+	MsgCannotCreateTask            = "cannot_create_task"
+	MsgCannotGetTasks              = "cannot_get_tasks"
+	MsgInvalidTaskStatus           = "invalid_task_status"
+	MsgCannotGetTaskOutput         = "cannot_get_task_output"
+	MsgOutputContextRange          = "output_context_range"
+	MsgInvalidRegex                = "invalid_regex"
+	MsgToBeforeFrom                = "to_before_from"
+	MsgCannotDeleteTask            = "cannot_delete_task"
+	MsgRemoveTasksCount            = "remove_tasks_count"
+	MsgCannotDeleteTasks           = "cannot_delete_tasks"
+	MsgTemplateHasActiveTasks      = "template_has_active_tasks"
+	MsgTasksBeingStopped           = "tasks_being_stopped"
+	MsgNoFailedHosts               = "no_failed_hosts"
+	MsgQueueWindowRange            = "queue_window_range"
+	MsgStopFinishedTask            = "stop_finished_task"
+	MsgSurveyNotObject             = "survey_not_object"
+	MsgInvalidSurvey               = "invalid_survey"
+	MsgArtifactNotFound            = "artifact_not_found"
+	MsgHookNotFound                = "hook_not_found"
+	MsgInvalidPayload              = "invalid_payload"
+	MsgInvalidSignature            = "invalid_signature"
+	MsgInvalidHookToken            = "invalid_hook_token"
+	MsgUnsupportedHook             = "unsupported_hook"
+	MsgUpdateUnfinishedTask        = "update_unfinished_task"
+	MsgCommentLength               = "comment_length"
+	MsgCommentUnfinishedTask       = "comment_unfinished_task"
+	MsgAPITokenNotFound            = "api_token_not_found"
+	MsgAlreadySetUp                = "already_set_up"
+	MsgSetupFieldsRequired         = "setup_fields_required"
+	MsgPasswordTooShort            = "password_too_short"
+	MsgToNotAfterFrom              = "to_not_after_from"
+	MsgInvalidDate                 = "invalid_date"
+
+	// templates of notifications, executed with the Alert of the task
+	MsgAlertEmail        = "alert_email"
+	MsgAlertTelegram     = "alert_telegram"
+	MsgNotificationEmail = "notification_email"
+)
+
+// messages is the catalog of user facing messages by language and message id
+var messages = map[string]map[string]string{
+	"en": {
+		MsgInvalidRequestBody:     "Invalid request body: %s",
+		MsgInvalidParam:           "Invalid %s",
+		MsgAuthenticationRequired: "Authentication required",
+		MsgInvalidCredentials:     "Invalid username or password",
+		MsgInvalidSession:         "Invalid session",
+		MsgNotLoggedIn:            "Not logged in",
+		MsgSessionExpired:         "Session expired",
+		MsgInvalidAPIToken:        "Invalid API token",
+		MsgNotFound:               "Not found",
+		MsgProjectNotFound:        "Project not found",
+		MsgTemplateNotFound:       "Template not found",
+		MsgTaskNotFound:           "Task not found",
+		MsgUserNotFound:           "User not found",
+		MsgInventoryNotFound:      "Inventory not found",
+		MsgEnvironmentNotFound:    "Environment not found",
+		MsgKeyNotFound:            "Access key not found",
+		MsgRepositoryNotFound:     "Repository not found",
+		MsgProjectArchived:        "Project is archived",
+		MsgNameTaken:              "The name %s is already used by another %s in the project",
+		MsgVarsNotObject:          "Vars must be a JSON object",
+		MsgInvalidJSON:            "JSON is not valid",
+		MsgMissingResources:       "The template uses resources which don't exist anymore",
+		MsgOutsideRunWindow:       "Template can only be run within its run window",
+		MsgProductionNotConfirmed: "Production runs must be confirmed with confirm or confirm_project",
+		MsgOnlyAdminsDeleteTasks:  "Only admins can delete tasks",
+
+		MsgInvalidInventoryType:        "Inventory type must be static, file or url",
+		MsgAdminRemoveInventoryInUse:   "Only project admins can remove inventories which are in use",
+		MsgGroupTooLong:                "Group can be at most %d characters long",
+		MsgGroupNotFound:               "Group not found",
+		MsgNotProjectMember:            "User is not a member of the project",
+		MsgTemplateHasNoSchedule:       "Template has no schedule",
+		MsgUnknownTimezone:             "Unknown timezone %s",
+		MsgProjectAdminRequired:        "Project admin rights required",
+		MsgInvalidWebhookURL:           "Webhook url must be an absolute http(s) url",
+		MsgDefaultInventoryNotFound:    "Default inventory not found",
+		MsgDefaultRepositoryNotFound:   "Default repository not found",
+		MsgDefaultEnvironmentNotFound:  "Default environment not found",
+		MsgKeyNameEmpty:                "Key name can't be empty",
+		MsgInvalidForm:                 "Invalid form: %s",
+		MsgInvalidKeyFile:              "Invalid key file: %s",
+		MsgSSHSecretEmpty:              "SSH Secret empty",
+		MsgLoginEmpty:                  "Login empty",
+		MsgInvalidKeyType:              "Invalid key type",
+		MsgPasswordEmpty:               "Password empty",
+		MsgTemplateHasNoHook:           "Template has no hook",
+		MsgHookSecretTooShort:          "Secret must be at least %d characters long",
+		MsgEnvironmentInUse:            "Environment is in use by one or more templates",
+		MsgRepositoryInUse:             "Repository is in use by one or more templates",
+		MsgInventoryInUse:              "Inventory is in use by one or more templates",
+		MsgKeyInUse:                    "Key is in use by one or more templates / inventory / repositories",
+		MsgRequirementsAndPath:         "Only one of requirements_path and requirements can be set",
+		MsgRequirementsPathNotRelative: "Requirements path must be relative to the repository",
+		MsgPlaybookNotRelative:         "Playbook must be relative to the repository",
+		MsgWorkingDirectoryNotRelative: "Working directory must be relative to the repository",
+		MsgResourceTooLong:             "Resource can be at most %d characters long",
+		MsgTemplateRequiresItself:      "A template can't require itself",
+		MsgInvalidRequiredWithin:       "Required within must be a positive number of minutes",
+		MsgRequiredTemplateNotFound:    "Required template not found",
+		MsgTimedOut:                    "%s timed out",
+		MsgReservedVar:                 "The variable %s is reserved for the metadata of the task",
+		MsgAdminRequired:               "Admin rights required",
+		MsgAdminRemoveRepositoryInUse:  "Only project admins can remove repositories which are in use",
+		MsgRepositoryKeyNotFound:       "Repository Access Key not found",
+		MsgInvalidRepositoryKeyType:    "Repository Access Key is not 'SSH' or login/password: %s",
+		MsgInvalidHost:                 "Host must be a host name or ip address",
+		MsgInvalidPort:                 "Port must be between 1 and 65535",
+		MsgNoHostKeys:                  "No host keys found for %s",
+		MsgSessionNotFound:             "Session not found",
+		MsgInvalidActive:               "Active must be 1 or 0",
+		MsgNotPositive:                 "%s must be a positive number",
+		MsgAdminCreateUsers:            "Only admins can create users",
+		MsgCannotEditUser:              "Not permitted to edit the user",
+		MsgOwnRole:                     "Users can't change their own role",
+		MsgExternalUsername:            "Username is not editable for external LDAP users",
+		MsgExternalPassword:            "Password is not editable for external LDAP users",
+		MsgCannotDeleteUser:            "Not permitted to delete the user",
+		MsgNoNotificationChannels:      "The project has no notification channels configured",
+		MsgArgsAndArguments:            "Only one of args and arguments can be set",
+		MsgNotInteger:                  "%s must be an integer",
+		MsgEnvNotObject:                "Env must be a JSON object of strings",
+		MsgInventoryAndInventoryIDs:    "inventory and inventory_ids can't be combined",
+		MsgInvalidLimit:                "Invalid limit: %s",
+		MsgTaskMessageTooLong:          "message can be at most %d characters long",
+		MsgExternalIDTooLong:           "external_id and source can be at most %d characters long",
+		MsgCannotCreateTask:            "Cannot create the task",
+		MsgCannotGetTasks:              "Cannot get the tasks",
+		MsgInvalidTaskStatus:           "Status must be one of %s",
+		MsgCannotGetTaskOutput:         "Cannot get the task output",
+		MsgOutputContextRange:          "context must be between 0 and %d",
+		MsgInvalidRegex:                "Invalid regex: %s",
+		MsgToBeforeFrom:                "to must not be before from",
+		MsgCannotDeleteTask:            "Cannot delete the task",
+		MsgRemoveTasksCount:            "Between 1 and %d task ids can be deleted at once",
+		MsgCannotDeleteTasks:           "Cannot delete the tasks",
+		MsgTemplateHasActiveTasks:      "Template has tasks which are waiting or running",
+		MsgTasksBeingStopped:           "%d tasks of the template are being stopped, delete the history again once they stopped",
+		MsgNoFailedHosts:               "The task has no failed hosts to retry",
+		MsgQueueWindowRange:            "window must be between 1 and %d minutes",
+		MsgStopFinishedTask:            "Only waiting or running tasks can be stopped",
+		MsgSurveyNotObject:             "Survey must be a JSON object",
+		MsgInvalidSurvey:               "Survey values are not valid",
+		MsgArtifactNotFound:            "Artifact not found",
+		MsgHookNotFound:                "Hook not found",
+		MsgInvalidPayload:              "Invalid payload",
+		MsgInvalidSignature:            "Invalid signature",
+		MsgInvalidHookToken:            "Invalid token",
+		MsgUnsupportedHook:             "Only GitHub and GitLab webhooks are supported",
+		MsgUpdateUnfinishedTask:        "Only finished tasks can be updated",
+		MsgCommentLength:               "comment must be between 1 and %d characters long",
+		MsgCommentUnfinishedTask:       "Comments can only be added to finished tasks",
+		MsgAPITokenNotFound:            "API token not found",
+		MsgAlreadySetUp:                "Semaphore is already set up",
+		MsgSetupFieldsRequired:         "name, username and email are required",
+		MsgPasswordTooShort:            "password must be at least %d characters long",
+		MsgToNotAfterFrom:              "to must be after from",
+		MsgInvalidDate:                 "%s must be a date like 2006-01-02 or an RFC 3339 timestamp",
+
+		MsgAlertEmail: `Subject: Task '{{ .Alias }}' failed
+
+Task {{ .TaskID }} with template '{{ .Alias }}' has failed!
+Task log: <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+		MsgAlertTelegram: `<b>Task {{ .TaskID }} with template '{{ .Alias }}' has failed!</b>\nTask log: <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+		MsgNotificationEmail: `Subject: Task '{{ .Alias }}' finished - {{ .Status }}
+
+Task {{ .TaskID }} with template '{{ .Alias }}' finished with status {{ .Status }}.
+Task log: <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+	},
+	"fr": {
+		MsgInvalidRequestBody:     "Corps de requête invalide : %s",
+		MsgInvalidParam:           "Paramètre %s invalide",
+		MsgAuthenticationRequired: "Authentification requise",
+		MsgInvalidCredentials:     "Nom d'utilisateur ou mot de passe invalide",
+		MsgInvalidSession:         "Session invalide",
+		MsgNotLoggedIn:            "Non connecté",
+		MsgSessionExpired:         "Session expirée",
+		MsgInvalidAPIToken:        "Jeton d'API invalide",
+		MsgNotFound:               "Introuvable",
+		MsgProjectNotFound:        "Projet introuvable",
+		MsgTemplateNotFound:       "Modèle introuvable",
+		MsgTaskNotFound:           "Tâche introuvable",
+		MsgUserNotFound:           "Utilisateur introuvable",
+		MsgInventoryNotFound:      "Inventaire introuvable",
+		MsgEnvironmentNotFound:    "Environnement introuvable",
+		MsgKeyNotFound:            "Clé d'accès introuvable",
+		MsgRepositoryNotFound:     "Dépôt introuvable",
+		MsgProjectArchived:        "Le projet est archivé",
+		MsgNameTaken:              "Le nom %s est déjà utilisé par un autre objet (%s) du projet",
+		MsgVarsNotObject:          "Les variables doivent être un objet JSON",
+		MsgInvalidJSON:            "Le JSON n'est pas valide",
+		MsgMissingResources:       "Le modèle utilise des ressources qui n'existent plus",
+		MsgOutsideRunWindow:       "Le modèle ne peut être lancé que pendant sa plage d'exécution",
+		MsgProductionNotConfirmed: "Les exécutions en production doivent être confirmées avec confirm ou confirm_project",
+		MsgOnlyAdminsDeleteTasks:  "Seuls les administrateurs peuvent supprimer des tâches",
+
+		MsgInvalidInventoryType:        "Le type d'inventaire doit être static, file ou url",
+		MsgAdminRemoveInventoryInUse:   "Seuls les administrateurs du projet peuvent supprimer des inventaires utilisés",
+		MsgGroupTooLong:                "Le groupe peut contenir au plus %d caractères",
+		MsgGroupNotFound:               "Groupe introuvable",
+		MsgNotProjectMember:            "L'utilisateur n'est pas membre du projet",
+		MsgTemplateHasNoSchedule:       "Le modèle n'a pas de planification",
+		MsgUnknownTimezone:             "Fuseau horaire inconnu %s",
+		MsgProjectAdminRequired:        "Les droits d'administrateur du projet sont requis",
+		MsgInvalidWebhookURL:           "L'url du webhook doit être une url http(s) absolue",
+		MsgDefaultInventoryNotFound:    "Inventaire par défaut introuvable",
+		MsgDefaultRepositoryNotFound:   "Dépôt par défaut introuvable",
+		MsgDefaultEnvironmentNotFound:  "Environnement par défaut introuvable",
+		MsgKeyNameEmpty:                "Le nom de la clé ne peut pas être vide",
+		MsgInvalidForm:                 "Formulaire invalide : %s",
+		MsgInvalidKeyFile:              "Fichier de clé invalide : %s",
+		MsgSSHSecretEmpty:              "Le secret SSH est vide",
+		MsgLoginEmpty:                  "L'identifiant est vide",
+		MsgInvalidKeyType:              "Type de clé invalide",
+		MsgPasswordEmpty:               "Le mot de passe est vide",
+		MsgTemplateHasNoHook:           "Le modèle n'a pas de webhook",
+		MsgHookSecretTooShort:          "Le secret doit contenir au moins %d caractères",
+		MsgEnvironmentInUse:            "L'environnement est utilisé par un ou plusieurs modèles",
+		MsgRepositoryInUse:             "Le dépôt est utilisé par un ou plusieurs modèles",
+		MsgInventoryInUse:              "L'inventaire est utilisé par un ou plusieurs modèles",
+		MsgKeyInUse:                    "La clé est utilisée par un ou plusieurs modèles / inventaires / dépôts",
+		MsgRequirementsAndPath:         "Seul requirements_path ou requirements peut être renseigné",
+		MsgRequirementsPathNotRelative: "Le chemin des dépendances doit être relatif au dépôt",
+		MsgPlaybookNotRelative:         "Le playbook doit être relatif au dépôt",
+		MsgWorkingDirectoryNotRelative: "Le répertoire de travail doit être relatif au dépôt",
+		MsgResourceTooLong:             "La ressource peut contenir au plus %d caractères",
+		MsgTemplateRequiresItself:      "Un modèle ne peut pas se requérir lui-même",
+		MsgInvalidRequiredWithin:       "required_within doit être un nombre positif de minutes",
+		MsgRequiredTemplateNotFound:    "Modèle requis introuvable",
+		MsgTimedOut:                    "%s a expiré",
+		MsgReservedVar:                 "La variable %s est réservée aux métadonnées de la tâche",
+		MsgAdminRequired:               "Les droits d'administrateur sont requis",
+		MsgAdminRemoveRepositoryInUse:  "Seuls les administrateurs du projet peuvent supprimer des dépôts utilisés",
+		MsgRepositoryKeyNotFound:       "Clé d'accès du dépôt introuvable",
+		MsgInvalidRepositoryKeyType:    "La clé d'accès du dépôt n'est ni 'SSH' ni identifiant/mot de passe : %s",
+		MsgInvalidHost:                 "L'hôte doit être un nom d'hôte ou une adresse ip",
+		MsgInvalidPort:                 "Le port doit être compris entre 1 et 65535",
+		MsgNoHostKeys:                  "Aucune clé d'hôte trouvée pour %s",
+		MsgSessionNotFound:             "Session introuvable",
+		MsgInvalidActive:               "active doit valoir 1 ou 0",
+		MsgNotPositive:                 "%s doit être un nombre positif",
+		MsgAdminCreateUsers:            "Seuls les administrateurs peuvent créer des utilisateurs",
+		MsgCannotEditUser:              "Modification de l'utilisateur non autorisée",
+		MsgOwnRole:                     "Les utilisateurs ne peuvent pas changer leur propre rôle",
+		MsgExternalUsername:            "Le nom d'utilisateur des utilisateurs LDAP externes n'est pas modifiable",
+		MsgExternalPassword:            "Le mot de passe des utilisateurs LDAP externes n'est pas modifiable",
+		MsgCannotDeleteUser:            "Suppression de l'utilisateur non autorisée",
+		MsgNoNotificationChannels:      "Le projet n'a aucun canal de notification configuré",
+		MsgArgsAndArguments:            "Seul args ou arguments peut être renseigné",
+		MsgNotInteger:                  "%s doit être un entier",
+		MsgEnvNotObject:                "L'environnement doit être un objet JSON de chaînes",
+		MsgInventoryAndInventoryIDs:    "inventory et inventory_ids ne peuvent pas être combinés",
+		MsgInvalidLimit:                "Limite invalide : %s",
+		MsgTaskMessageTooLong:          "message peut contenir au plus %d caractères",
+		MsgExternalIDTooLong:           "external_id et source peuvent contenir au plus %d caractères",
+		MsgCannotCreateTask:            "Impossible de créer la tâche",
+		MsgCannotGetTasks:              "Impossible de récupérer les tâches",
+		MsgInvalidTaskStatus:           "Le statut doit être parmi %s",
+		MsgCannotGetTaskOutput:         "Impossible de récupérer la sortie de la tâche",
+		MsgOutputContextRange:          "context doit être compris entre 0 et %d",
+		MsgInvalidRegex:                "Expression régulière invalide : %s",
+		MsgToBeforeFrom:                "to ne doit pas précéder from",
+		MsgCannotDeleteTask:            "Impossible de supprimer la tâche",
+		MsgRemoveTasksCount:            "Entre 1 et %d identifiants de tâches peuvent être supprimés à la fois",
+		MsgCannotDeleteTasks:           "Impossible de supprimer les tâches",
+		MsgTemplateHasActiveTasks:      "Le modèle a des tâches en attente ou en cours",
+		MsgTasksBeingStopped:           "%d tâches du modèle sont en cours d'arrêt, supprimez à nouveau l'historique une fois qu'elles sont arrêtées",
+		MsgNoFailedHosts:               "La tâche n'a pas d'hôtes en échec à relancer",
+		MsgQueueWindowRange:            "window doit être compris entre 1 et %d minutes",
+		MsgStopFinishedTask:            "Seules les tâches en attente ou en cours peuvent être arrêtées",
+		MsgSurveyNotObject:             "Le questionnaire doit être un objet JSON",
+		MsgInvalidSurvey:               "Les valeurs du questionnaire ne sont pas valides",
+		MsgArtifactNotFound:            "Artefact introuvable",
+		MsgHookNotFound:                "Webhook introuvable",
+		MsgInvalidPayload:              "Contenu invalide",
+		MsgInvalidSignature:            "Signature invalide",
+		MsgInvalidHookToken:            "Jeton invalide",
+		MsgUnsupportedHook:             "Seuls les webhooks GitHub et GitLab sont pris en charge",
+		MsgUpdateUnfinishedTask:        "Seules les tâches terminées peuvent être modifiées",
+		MsgCommentLength:               "comment doit contenir entre 1 et %d caractères",
+		MsgCommentUnfinishedTask:       "Les commentaires ne peuvent être ajoutés qu'aux tâches terminées",
+		MsgAPITokenNotFound:            "Jeton d'API introuvable",
+		MsgAlreadySetUp:                "Semaphore est déjà configuré",
+		MsgSetupFieldsRequired:         "name, username et email sont requis",
+		MsgPasswordTooShort:            "password doit contenir au moins %d caractères",
+		MsgToNotAfterFrom:              "to doit suivre from",
+		MsgInvalidDate:                 "%s doit être une date comme 2006-01-02 ou un horodatage RFC 3339",
+
+		MsgAlertEmail: `Subject: La tâche '{{ .Alias }}' a échoué
+
+La tâche {{ .TaskID }} du modèle '{{ .Alias }}' a échoué !
+Journal de la tâche : <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+		MsgAlertTelegram: `<b>La tâche {{ .TaskID }} du modèle '{{ .Alias }}' a échoué !</b>\nJournal de la tâche : <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+		MsgNotificationEmail: `Subject: Tâche '{{ .Alias }}' terminée - {{ .Status }}
+
+La tâche {{ .TaskID }} du modèle '{{ .Alias }}' s'est terminée avec le statut {{ .Status }}.
+Journal de la tâche : <a href='{{ .TaskURL }}'>{{ .TaskURL }}</a>`,
+	},
+}
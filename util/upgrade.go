@@ -20,6 +20,9 @@ import (
 // UpdateAvailable contains the full repository information for the latest release of Semaphore
 var UpdateAvailable *github.RepositoryRelease
 
+// UpdateChecked is when the releases were last fetched successfully, zero if they never were
+var UpdateChecked time.Time
+
 // DoUpgrade checks for an update, and if available downloads the binary and installs it
 func DoUpgrade(version string) error {
 	fmt.Printf("current release is v%s\n", version)
@@ -113,6 +116,7 @@ func CheckUpdate(version string) error {
 	if (*releases[0].TagName)[1:] != version {
 		UpdateAvailable = releases[0]
 	}
+	UpdateChecked = time.Now()
 
 	return nil
 }
@@ -3,8 +3,10 @@ package util
 import (
 	"encoding/json"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -19,11 +21,11 @@ func isXHR(w http.ResponseWriter, r *http.Request) bool {
 // TODO - never called!
 func AuthFailed(w http.ResponseWriter, r *http.Request) {
 	if !isXHR(w, r) {
-		http.Redirect(w, r, "/?hai", http.StatusFound)
+		http.Redirect(w, r, WebPath()+"?hai", http.StatusFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusUnauthorized)
+	WriteLocalizedError(w, r, http.StatusUnauthorized, MsgAuthenticationRequired, nil)
 }
 
 // GetIntParam fetches a parameter from the route variables as an integer
@@ -33,9 +35,9 @@ func GetIntParam(name string, w http.ResponseWriter, r *http.Request) (int, erro
 
 	if err != nil {
 		if !isXHR(w, r) {
-			http.Redirect(w, r, "/404", http.StatusFound)
+			http.Redirect(w, r, WebPath()+"404", http.StatusFound)
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
+			WriteLocalizedError(w, r, http.StatusBadRequest, MsgInvalidParam, nil, name)
 		}
 
 		return 0, err
@@ -60,12 +62,38 @@ type H map[string]interface{}
 func Bind(w http.ResponseWriter, r *http.Request, out interface{}) error {
 	err := json.NewDecoder(r.Body).Decode(out)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		WriteLocalizedError(w, r, http.StatusBadRequest, MsgInvalidRequestBody, nil, err.Error())
 	}
 
 	return err
 }
 
+// WriteCreated writes a created object as JSON with a Location header pointing to it,
+// path is the url of the object relative to the api root, e.g. "project/1/keys/2"
+func WriteCreated(w http.ResponseWriter, path string, out interface{}) {
+	w.Header().Set("Location", WebPath()+"api/"+path)
+	WriteJSON(w, http.StatusCreated, out)
+}
+
+// ErrorResponse is the body of every api error response
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// id of the message in the catalog, which doesn't change with the language. Not every error has one
+	MessageID string `json:"message_id,omitempty"`
+	// optional machine readable data about the error, like the objects referencing a resource
+	Details interface{} `json:"details,omitempty"`
+}
+
+// WriteError writes an ErrorResponse with the given status code
+func WriteError(w http.ResponseWriter, code int, message string, details interface{}) {
+	WriteJSON(w, code, ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: details,
+	})
+}
+
 //WriteJSON writes object as JSON
 func WriteJSON(w http.ResponseWriter, code int, out interface{}) {
 	w.Header().Set("content-type", "application/json")
@@ -75,3 +103,47 @@ func WriteJSON(w http.ResponseWriter, code int, out interface{}) {
 		panic(err)
 	}
 }
+
+// IsSubPath checks that a relative path can't escape the directory it is joined to
+func IsSubPath(path string) bool {
+	if filepath.IsAbs(path) {
+		return false
+	}
+
+	clean := filepath.Clean(path)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// RelativeTime describes how long before now t happened, e.g. "2 minutes ago"
+func RelativeTime(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+	if elapsed < time.Minute {
+		return "just now"
+	}
+
+	units := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	for _, unit := range units {
+		n := int(elapsed / unit.duration)
+		if n == 0 {
+			continue
+		}
+
+		if n == 1 {
+			return "1 " + unit.name + " ago"
+		}
+
+		return strconv.Itoa(n) + " " + unit.name + "s ago"
+	}
+
+	return "just now"
+}
@@ -3,7 +3,9 @@ package util
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -29,3 +31,108 @@ func mockParam(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(200)
 }
+
+func TestGetIntParamRedirectsUnderWebPath(t *testing.T) {
+	WebHostURL, _ = url.Parse("http://localhost/semaphore")
+	defer func() {
+		WebHostURL = nil
+	}()
+
+	if WebPath() != "/semaphore/" {
+		t.Fatalf("web path should end with a slash, got %s", WebPath())
+	}
+
+	req, _ := http.NewRequest("GET", "/semaphore/test/abc", nil)
+	req.Header.Set("Accept", "text/html")
+	rr := httptest.NewRecorder()
+
+	if _, err := GetIntParam("test_id", rr, req); err == nil {
+		t.Fatal("invalid parameter should return an error")
+	}
+
+	if location := rr.Header().Get("Location"); location != "/semaphore/404" {
+		t.Errorf("redirect should respect the web path, got %s", location)
+	}
+}
+
+func TestIsSubPath(t *testing.T) {
+	valid := []string{"site.yml", "ansible/playbooks/site.yml", "./ansible", "ansible/../site.yml"}
+	for _, path := range valid {
+		if !IsSubPath(path) {
+			t.Errorf("%s should be a sub path", path)
+		}
+	}
+
+	invalid := []string{"/etc/passwd", "..", "../site.yml", "ansible/../../site.yml"}
+	for _, path := range invalid {
+		if IsSubPath(path) {
+			t.Errorf("%s should not be a sub path", path)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := map[time.Duration]string{
+		10 * time.Second:         "just now",
+		-time.Minute:             "just now",
+		time.Minute:              "1 minute ago",
+		2 * time.Minute:          "2 minutes ago",
+		3 * time.Hour:            "3 hours ago",
+		24 * time.Hour:           "1 day ago",
+		65 * 24 * time.Hour:      "2 months ago",
+		2 * 365 * 24 * time.Hour: "2 years ago",
+	}
+
+	for ago, expected := range cases {
+		if actual := RelativeTime(now.Add(-ago), now); actual != expected {
+			t.Errorf("%v ago should be %q, got %q", ago, expected, actual)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	invalid := []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q should be invalid", expr)
+		}
+	}
+
+	schedule, err := ParseCron("*/15 9-17 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// monday
+	if !schedule.Matches(time.Date(2020, 1, 6, 9, 30, 0, 0, time.UTC)) {
+		t.Error("schedule should match monday 9:30")
+	}
+
+	// sunday
+	if schedule.Matches(time.Date(2020, 1, 5, 9, 30, 0, 0, time.UTC)) {
+		t.Error("schedule should not match sunday")
+	}
+
+	if schedule.Matches(time.Date(2020, 1, 6, 9, 31, 0, 0, time.UTC)) {
+		t.Error("schedule should not match 9:31")
+	}
+}
+
+func TestCronNextInLocation(t *testing.T) {
+	schedule, err := ParseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	next, ok := schedule.Next(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).In(loc))
+	if !ok {
+		t.Fatal("schedule should have a next run")
+	}
+
+	if !next.UTC().Equal(time.Date(2020, 1, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("9:00 in UTC+2 should be 7:00 UTC, got %v", next.UTC())
+	}
+}
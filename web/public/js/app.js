@@ -71,7 +71,13 @@ app.run(['$rootScope', '$window', '$couchPotato', '$injector', '$state', '$http'
 	$rootScope.startWS = function () {
 		var ws_base = 'ws' + document.baseURI.substr(4);
 
-		$rootScope.ws = new WebSocket(ws_base + 'api/ws');
+		var ws_url = ws_base + 'api/ws';
+		if ($rootScope.wsTask) {
+			// replays the output of the open task missed while disconnected
+			ws_url += '?task_id=' + $rootScope.wsTask.id + '&last_seq=' + $rootScope.wsTask.seq;
+		}
+
+		$rootScope.ws = new WebSocket(ws_url);
 		$rootScope.ws.onclose = function () {
 			console.log('WS closed, retrying');
 			setTimeout($rootScope.startWS, 2000);
@@ -81,6 +87,20 @@ app.run(['$rootScope', '$window', '$couchPotato', '$injector', '$state', '$http'
 			try {
 				var d = JSON.parse(e.data);
 				setTimeout(function () {
+					if (d.replay && d.truncated) {
+						// too much output was missed to be replayed
+						$rootScope.$broadcast('task.replayTruncated', d);
+						return;
+					}
+
+					if (d.type == 'log' && d.lines) {
+						// lines batched by the server
+						d.lines.forEach(function (line) {
+							$rootScope.$broadcast('task.log', angular.extend({ task_id: d.task_id, project_id: d.project_id }, line));
+						});
+						return;
+					}
+
 					$rootScope.$broadcast('task.' + d.type, d);
 				}, 3000);
 			} catch (_) { }
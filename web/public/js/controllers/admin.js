@@ -6,7 +6,7 @@ define(function () {
 		}
 
 		$scope.checkUpdate = function () {
-			$http.get('/upgrade').then(function (response) {
+			$http.get('/upgrade?force=1').then(function (response) {
 			  var upgrade = response.data;
 				if (!upgrade) return;
 
@@ -18,6 +18,25 @@ define(function () {
 			});
 		}
 
+		$scope.maintenance = {
+			enabled: !!($scope.upgrade && $scope.upgrade.maintenance && $scope.upgrade.maintenance.enabled),
+			message: $scope.upgrade && $scope.upgrade.maintenance && $scope.upgrade.maintenance.message || ''
+		};
+
+		$scope.setMaintenance = function (enabled) {
+			$http.post('/info/maintenance', {
+				enabled: enabled,
+				message: $scope.maintenance.message
+			}).then(function (response) {
+				$scope.upgrade.maintenance = response.data;
+				$scope.maintenance.enabled = response.data.enabled;
+				$scope.maintenance.message = response.data.message || '';
+				$rootScope.refreshInfo();
+			}).catch(function (response) {
+				SweetAlert.swal('Error', response.data && response.data.message || 'Could not change maintenance mode', 'error');
+			});
+		}
+
 		$scope.doUpgrade = function () {
 			var upgradeModal = $modal.open({
 				template: '<div class="modal-header"><h3 class="modal-title">Upgrade in progress</h3></div><div class="modal-body"><div class="progress"><div class="progress-bar progress-bar-striped active" style="width: 100%;"></div></div><p ng-if="upgraded">Server has upgraded. It was automatically stopped, if it isn\'t restarted automatically by a process manager please log in and start semaphore again.</p></div>',
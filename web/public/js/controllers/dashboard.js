@@ -3,7 +3,7 @@ define(['controllers/projects/edit'], function () {
 		$scope.projects = [];
 
 		$scope.refresh = function ($lastEvents=true) {
-			$http.get('/projects').then(function (response) {
+			$http.get('/projects?stats=1').then(function (response) {
 				$scope.projects = response.data;
 			});
 
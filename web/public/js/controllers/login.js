@@ -6,6 +6,27 @@ define(function () {
 			password: ""
 		};
 
+		// a fresh install has no user, the first admin is created here
+		$scope.setupRequired = false;
+		$scope.admin = {};
+		$http.get('/setup').then(function (response) {
+			$scope.setupRequired = response.data.required;
+		});
+
+		$scope.setup = function (admin) {
+			$http.post('/setup', admin).then(function () {
+				$scope.setupRequired = false;
+				$scope.user.auth = admin.username;
+				$scope.status = "Admin created, sign in with it";
+			}).catch(function (response) {
+				if (response.status === 409) {
+					$scope.setupRequired = false;
+				}
+
+				$scope.status = response.data && response.data.message || response.status + ' Request Failed. Try again later.';
+			});
+		}
+
 		$scope.authenticate = function (user) {
 			$scope.status = "Authenticating..";
 
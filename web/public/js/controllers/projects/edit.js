@@ -3,15 +3,73 @@ define(function () {
 		$scope.projectName = Project.name;
 		$scope.alert = Project.alert;
 		$scope.alert_chat = Project.alert_chat;
+		$scope.defaults = {
+			inventory_id: Project.default_inventory_id,
+			repository_id: Project.default_repository_id,
+			environment_id: Project.default_environment_id
+		};
+		$scope.keep_tasks = Project.keep_tasks;
+		$scope.known_hosts = Project.known_hosts || '';
+
+		$http.get(Project.getURL() + '/inventory').then(function (response) {
+			$scope.inventories = response.data.filter(function (i) { return !i.removed; });
+		});
+		$http.get(Project.getURL() + '/repositories').then(function (response) {
+			$scope.repositories = response.data.filter(function (r) { return !r.removed; });
+		});
+		$http.get(Project.getURL() + '/environment').then(function (response) {
+			$scope.environments = response.data.filter(function (e) { return !e.removed; });
+		});
 
 		$scope.save = function (name, alert, alert_chat) {
-			$http.put(Project.getURL(), {name: name, alert: alert, alert_chat: alert_chat}).then(function () {
+			$http.put(Project.getURL(), {
+				name: name,
+				alert: alert,
+				alert_chat: alert_chat,
+				default_inventory_id: $scope.defaults.inventory_id || null,
+				default_repository_id: $scope.defaults.repository_id || null,
+				default_environment_id: $scope.defaults.environment_id || null,
+				keep_tasks: $scope.keep_tasks || null,
+				known_hosts: $scope.known_hosts
+			}).then(function () {
+				Project.known_hosts = $scope.known_hosts || null;
+				Project.keep_tasks = $scope.keep_tasks || null;
+				Project.default_inventory_id = $scope.defaults.inventory_id || null;
+				Project.default_repository_id = $scope.defaults.repository_id || null;
+				Project.default_environment_id = $scope.defaults.environment_id || null;
 				SweetAlert.swal('Saved', 'Project settings saved.', 'success');
 			}).catch(function () {
 				SweetAlert.swal('Error', 'Project settings were not saved', 'error');
 			});
 		}
 
+		$scope.scanHost = function (host) {
+			var split = host.split(':');
+			$http.post(Project.getURL() + '/known_hosts', {
+				host: split[0],
+				port: split.length > 1 ? parseInt(split[1], 10) : 0
+			}).then(function (response) {
+				$scope.known_hosts = response.data.known_hosts;
+				Project.known_hosts = response.data.known_hosts;
+				$scope.keyscanHost = '';
+				SweetAlert.swal('Host keys', response.data.added.length + ' host keys added', 'success');
+			}).catch(function (response) {
+				SweetAlert.swal('Error', response.data && response.data.message || 'Could not scan the host', 'error');
+			});
+		}
+
+		$scope.testNotifications = function () {
+			$http.post(Project.getURL() + '/notifications/test').then(function (response) {
+				var lines = response.data.results.map(function (r) {
+					return r.channel + ' ' + r.target + ': ' + (r.success ? 'sent' : r.error);
+				});
+
+				SweetAlert.swal(response.data.success ? 'Sent' : 'Failed', lines.join('\n'), response.data.success ? 'success' : 'error');
+			}).catch(function (response) {
+				SweetAlert.swal('Error', response.data && response.data.message || 'Notifications could not be tested', 'error');
+			});
+		}
+
 		$scope.deleteProject = function () {
 			SweetAlert.swal({
 				title: 'Delete Project?',
@@ -13,14 +13,14 @@ define(function () {
 				})
 				.catch(function (response) {
 					var d = response.data;
-					if (!(d && d.inUse)) {
+					if (!(d && d.details && d.details.inUse)) {
 						SweetAlert.swal('error', 'could not delete environment..', 'error');
 						return;
 					}
 
 					SweetAlert.swal({
 						title: 'Environment in use',
-						text: d.error,
+						text: d.message,
 						icon: 'error',
 						buttons: {
 							cancel: true,
@@ -49,11 +49,33 @@ define(function () {
 				});
 		}
 
+		// openScope returns the scope of the environment form, secrets are edited as a list of name/value pairs
+		function openScope(env) {
+			var scope = openScope(env);
+			scope.secrets = Object.keys(env.secrets || {}).map(function (name) {
+				return { name: name, value: '', stored: true };
+			});
+
+			scope.withSecrets = function (env, secrets) {
+				var body = angular.extend({}, env, { secrets: {} });
+				secrets.forEach(function (secret) {
+					if (!secret.name) {
+						return;
+					}
+					// a stored secret without a new value keeps its value
+					body.secrets[secret.name] = secret.value || (secret.stored ? null : '');
+				});
+
+				return body;
+			};
+
+			return scope;
+		}
+
 		$scope.add = function () {
-			var scope = $rootScope.$new();
-			scope.env = {
+			var scope = openScope({
 				json: '{}'
-			};
+			});
 
 			$modal.open({
 				templateUrl: '/tpl/projects/environment/add.html',
@@ -63,15 +85,14 @@ define(function () {
 					.then(function () {
 						$scope.reload();
 					}).catch(function (response) {
-					SweetAlert.swal('Error', 'Environment not added: ' + response.status, 'error');
+					SweetAlert.swal('Error', 'Environment not added: ' + (response.data && response.data.message || response.status), 'error');
 				});
 			}, function () {
 			});
 		}
 
 		$scope.editEnvironment = function (env) {
-			var scope = $rootScope.$new();
-			scope.env = env;
+			var scope = openScope(env);
 
 			$modal.open({
 				templateUrl: '/tpl/projects/environment/add.html',
@@ -85,7 +106,7 @@ define(function () {
 					.then(function () {
 						$scope.reload();
 					}).catch(function (response) {
-					SweetAlert.swal('Error', 'Environment not updated: ' + response.status, 'error');
+					SweetAlert.swal('Error', 'Environment not updated: ' + (response.data && response.data.message || response.status), 'error');
 				});
 			}, function () {
 			});
@@ -13,14 +13,14 @@ define(function () {
 				})
 				.catch(function (response) {
 					var d = response.data;
-					if (!(d && d.inUse)) {
+					if (!(d && d.details && d.details.inUse)) {
 						SweetAlert.swal('error', 'could not delete inventory..', 'error');
 						return;
 					}
 
 					SweetAlert.swal({
 						title: 'Inventory in use',
-						text: d.error,
+						text: d.message,
 						icon: 'error',
 						buttons: {
 							cancel: true,
@@ -120,7 +120,7 @@ define(function () {
 				cb = function () {};
 			}
 
-			$http.get(Project.getURL() + '/keys?type=ssh').then(function (keys) {
+			$http.get(Project.getURL() + '/keys?type=ssh,login_password').then(function (keys) {
 				cb(keys.data);
 			});
 		}
@@ -14,14 +14,14 @@ define(function () {
 				.catch(function (response) {
 					var d = response.data;
 
-					if (!(d && d.inUse)) {
+					if (!(d && d.details && d.details.inUse)) {
 						SweetAlert.swal('error', 'could not delete key..', 'error');
 						return;
 					}
 
 					SweetAlert.swal({
 						title: 'Key in use',
-						text: d.error,
+						text: d.message,
 						icon: 'error',
 						buttons: {
 							cancel: true,
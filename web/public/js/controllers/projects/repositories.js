@@ -1,7 +1,7 @@
 define(function () {
 	app.registerController('ProjectRepositoriesCtrl', ['$scope', '$http', 'Project', '$uibModal', '$rootScope', 'SweetAlert', function ($scope, $http, Project, $modal, $rootScope, SweetAlert) {
 		$scope.reload = function () {
-			$http.get(Project.getURL() + '/keys?type=ssh&sort=name&order=asc').then(function (keys) {
+			$http.get(Project.getURL() + '/keys?type=ssh,login_password&sort=name&order=asc').then(function (keys) {
 				$scope.sshKeys = keys.data;
 
 				$http.get(Project.getURL() + '/repositories?sort=name&order=asc').then(function (repos) {
@@ -26,14 +26,14 @@ define(function () {
 				})
 				.catch(function (response) {
 					var d = response.data;
-					if (!(d && d.templatesUse)) {
+					if (!(d && d.details && d.details.inUse)) {
 						SweetAlert.swal('error', 'could not delete repository..', 'error');
 						return;
 					}
 
 					SweetAlert.swal({
 						title: 'Repository in use',
-						text: d.error,
+						text: d.message,
 						icon: 'error',
 						buttons: {
 							cancel: true,
@@ -2,6 +2,15 @@ define(function () {
 	app.registerController('CreateTaskCtrl', ['$scope', '$http', 'Template', 'Project', 'SweetAlert', function ($scope, $http, Template, Project, SweetAlert) {
 		console.log(Template);
 		$scope.task = {};
+		$scope.savedLimits = [];
+
+		$http.get(Project.getURL() + '/inventory').then(function (response) {
+			response.data.forEach(function (inv) {
+				if (inv.id == Template.inventory_id && inv.limits) {
+					$scope.savedLimits = JSON.parse(inv.limits);
+				}
+			});
+		});
 
 		$scope.run = function (task, dryRun) {
 			task.template_id = Template.id;
@@ -10,9 +19,54 @@ define(function () {
 			if (dryRun) {
 				params.dry_run = true;
 			}
+			launch(params);
+		}
+
+		$scope.preview = function (task) {
+			var params = angular.copy(task);
+			params.template_id = Template.id;
+
+			$http.post(Project.getURL() + '/tasks/preview', params).then(function (response) {
+				$scope.taskPreview = {
+					vars: JSON.stringify(response.data.vars, null, 2),
+					command: response.data.command.join(' ')
+				};
+			}).catch(function (response) {
+				$scope.taskPreview = null;
+				SweetAlert.swal('Error', response.data && response.data.message || 'Could not preview the task', 'error');
+			});
+		}
+
+		function launch(params) {
 			$http.post(Project.getURL() + '/tasks', params).then(function (t) {
 				$scope.$close(t.data);
 			}).catch(function (response) {
+				if (response.status == 412 && !params.confirm_project) {
+					// production runs are confirmed by typing the name of the project
+					return SweetAlert.swal({
+						title: 'Production run',
+						text: 'Type the name of the project to confirm',
+						icon: 'warning',
+						content: 'input',
+						buttons: true
+					}).then(function (name) {
+						if (!name) {
+							return;
+						}
+
+						params.confirm_project = name;
+						launch(params);
+					});
+				}
+
+				if ((response.status == 412 || response.status == 409 || response.status == 403 || response.status == 503) && response.data && response.data.message) {
+					return SweetAlert.swal('Not launched', response.data.message, 'warning');
+				}
+
+				if (response.data && response.data.details && response.data.details.missing) {
+					return SweetAlert.swal('Not launched', response.data.message + ': ' + response.data.details.missing.join(', '), 'error');
+				}
+
 				SweetAlert.swal('Error', 'error launching task: HTTP ' + response.status, 'error');
 			});
 		}
@@ -21,20 +75,38 @@ define(function () {
 	app.registerController('TaskCtrl', ['$scope', '$http', function ($scope, $http) {
 		$scope.raw = false;
 		$scope.task = $scope.task;
+		$scope.command = $scope.task.command ? JSON.parse($scope.task.command).join(' ') : null;
 		var logData = [];
 		var onDestroy = [];
 
+		// the last output line seen, the websocket asks for the lines after it when it reconnects
+		$scope.$root.wsTask = { id: $scope.task.id, seq: 0 };
+
+		// line number and time shown before a line of the output, the line number is its sequence number
+		function linePrefix(o) {
+			if ($scope.raw) {
+				return '';
+			}
+
+			return (o.seq ? 'L' + o.seq + ' ' : '') + moment(o.time).format('HH:mm:ss') + ': ';
+		}
+
 		onDestroy.push($scope.$on('task.log', function (evt, data) {
-			var o = data.output + '\n';
+			var o = linePrefix(data) + data.output + '\n';
 			var d = moment(data.time);
-			if (!$scope.raw) {
-				o = d.format('HH:mm:ss') + ': ' + o;
-			}
 
 			if ($scope.task.id !== data.task_id) {
 				return;
 			}
 
+			// replayed lines may have been received live already
+			if (data.seq) {
+				if (data.seq <= $scope.$root.wsTask.seq) {
+					return;
+				}
+				$scope.$root.wsTask.seq = data.seq;
+			}
+
 			for (var i = 0; i < logData.length; i++) {
 				if (d.isAfter(logData[i].time)) {
 					// too far -- no point scanning rest of data as its in chronological order
@@ -50,24 +122,45 @@ define(function () {
 			if (!$scope.$$phase) $scope.$digest();
 		}));
 
+		onDestroy.push($scope.$on('task.replayTruncated', function (evt, data) {
+			if ($scope.task.id === data.task_id) {
+				$scope.reload();
+			}
+		}));
+
 		onDestroy.push($scope.$on('task.update', function (evt, data) {
 			$scope.task.status = data.status;
 			$scope.task.start = data.start;
 			$scope.task.end = data.end;
+			$scope.loadProgress();
 
 			if (!$scope.$$phase) $scope.$digest();
 		}));
 
+		var outputTail = 500;
+		$scope.fullOutput = false;
+
+		$scope.loadFullOutput = function () {
+			$scope.fullOutput = true;
+			$scope.reload();
+		}
+
 		$scope.reload = function () {
-			$http.get($scope.project.getURL() + '/tasks/' + $scope.task.id + '/output')
+			var url = $scope.project.getURL() + '/tasks/' + $scope.task.id + '/output';
+			if (!$scope.fullOutput) {
+				url += '?tail=' + outputTail;
+			}
+
+			$http.get(url)
 			.then(function (output) {
 				logData = output.data;
+				output.data.forEach(function (o) {
+					$scope.$root.wsTask.seq = Math.max($scope.$root.wsTask.seq, o.seq || 0);
+				});
+				$scope.truncated = !$scope.fullOutput && output.data.length >= outputTail;
 				var out = [];
 				output.data.forEach(function (o) {
-					var pre = '';
-					if (!$scope.raw) pre = moment(o.time).format('HH:mm:ss') + ': ';
-
-					out.push(pre + o.output);
+					out.push(linePrefix(o) + o.output);
 				});
 
 				$scope.output_formatted = out.join('\n') + '\n';
@@ -89,12 +182,114 @@ define(function () {
 			});
 		}
 
+		$scope.stop = function () {
+			$http.post($scope.project.getURL() + '/tasks/' + $scope.task.id + '/stop')
+			.catch(function (response) {
+				SweetAlert.swal("Error", response.data && response.data.message || 'Could not stop task', 'error');
+			});
+		}
+
+		// tasks completed and results by host, live while the task runs, and the resource a waiting task waits for
+		$scope.progress = {};
+		var progressTimer = null;
+
+		$scope.loadProgress = function () {
+			$http.get($scope.project.getURL() + '/tasks/' + $scope.task.id)
+			.then(function (response) {
+				$scope.progress = {
+					tasks_done: response.data.tasks_done,
+					tasks_total: response.data.tasks_total,
+					hosts: response.data.hosts || [],
+					blocked_on: response.data.blocked_on
+				};
+
+				clearTimeout(progressTimer);
+				if (response.data.status == 'running' || response.data.status == 'waiting') {
+					progressTimer = setTimeout($scope.loadProgress, 5000);
+				}
+			});
+		}
+
+		$scope.loadProgress();
+
+		$scope.comments = [];
+		$scope.newComment = {};
+
+		$scope.loadComments = function () {
+			$http.get($scope.project.getURL() + '/tasks/' + $scope.task.id + '/comments')
+			.then(function (response) {
+				$scope.comments = response.data;
+			});
+		}
+
+		$scope.addComment = function () {
+			$http.post($scope.project.getURL() + '/tasks/' + $scope.task.id + '/comments', $scope.newComment)
+			.then(function (response) {
+				$scope.comments.push(response.data);
+				$scope.newComment = {};
+			}).catch(function (response) {
+				SweetAlert.swal('Error', response.data && response.data.message || 'Could not comment the task', 'error');
+			});
+		}
+
+		$scope.loadComments();
+
+		$scope.metadata = {
+			labels: ($scope.task.labels || []).join(', ')
+		};
+
+		$scope.saveMetadata = function () {
+			var labels = $scope.metadata.labels.split(',').map(function (label) {
+				return label.trim();
+			}).filter(function (label) {
+				return label.length > 0;
+			});
+
+			$http.put($scope.project.getURL() + '/tasks/' + $scope.task.id, {
+				labels: labels
+			}).then(function () {
+				$scope.task.labels = labels;
+			}).catch(function (response) {
+				SweetAlert.swal('Error', response.data && response.data.message || 'Could not update the task', 'error');
+			});
+		}
+
+		$scope.retryFailed = function (params) {
+			params = params || {};
+
+			$http.post($scope.project.getURL() + '/tasks/' + $scope.task.id + '/retry-failed', params)
+			.then(function () {
+				$scope.$close();
+			}).catch(function (response) {
+				if (response.status == 412 && !params.confirm_project) {
+					// production runs are confirmed by typing the name of the project
+					return SweetAlert.swal({
+						title: 'Production run',
+						text: 'Type the name of the project to confirm',
+						icon: 'warning',
+						content: 'input',
+						buttons: true
+					}).then(function (name) {
+						if (name) {
+							$scope.retryFailed({ confirm_project: name });
+						}
+					});
+				}
+
+				SweetAlert.swal('Not launched', response.data && response.data.message || 'Could not retry task', 'error');
+			});
+		}
+
 		$scope.$watch('raw', function () {
 			$scope.reload();
 		});
 
 		$scope.$on('$destroy', function () {
 			logData = null;
+			clearTimeout(progressTimer);
+			if ($scope.$root.wsTask && $scope.$root.wsTask.id === $scope.task.id) {
+				$scope.$root.wsTask = null;
+			}
 			onDestroy.forEach(function (f) {
 				f();
 			});
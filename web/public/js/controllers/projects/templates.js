@@ -57,7 +57,7 @@ define(['controllers/projects/taskRunner'], function () {
 		}
 
 		$scope.reload = function () {
-			$http.get(Project.getURL() + '/templates?sort=alias&order=asc').then(function (response) {
+			$http.get(Project.getURL() + '/templates?sort=group&order=asc').then(function (response) {
 			  var templates = response.data;
 				var hiddenTemplates = getHiddenTemplates();
 				for (var i = 0; i < templates.length; i++) {
@@ -84,6 +84,12 @@ define(['controllers/projects/taskRunner'], function () {
 			scope.inventory = $scope.inventory;
 			scope.repositories = $scope.repos;
 			scope.environment = $scope.environment;
+			scope.templates = $scope.templates;
+			scope.tpl = {
+				inventory_id: Project.default_inventory_id,
+				repository_id: Project.default_repository_id,
+				environment_id: Project.default_environment_id
+			};
 
 			$modal.open({
 				templateUrl: '/tpl/projects/templates/add.html',
@@ -105,6 +111,7 @@ define(['controllers/projects/taskRunner'], function () {
 			scope.inventory = $scope.inventory;
 			scope.repositories = $scope.repos;
 			scope.environment = $scope.environment;
+			scope.templates = $scope.templates;
 
 			var modal = $modal.open({
 				templateUrl: '/tpl/projects/templates/add.html',
@@ -190,6 +197,7 @@ define(['controllers/projects/taskRunner'], function () {
 			scope.inventory = $scope.inventory;
 			scope.repositories = $scope.repos;
 			scope.environment = $scope.environment;
+			scope.templates = $scope.templates;
 
 			$modal.open({
 				templateUrl: '/tpl/projects/templates/add.html',
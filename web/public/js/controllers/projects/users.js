@@ -24,32 +24,32 @@ define(function () {
 		}
 
 		$scope.addUser = function () {
-			$http.get('/users').then(function (response) {
-			  var users = response.data;
-				$scope.users.forEach(function (u) {
-					for (var i = 0; i < users.length; i++) {
-						if (u.id == users[i].id) {
-							users.splice(i, 1);
-							break;
-						}
-					}
-				});
-
-				var scope = $rootScope.$new();
-				scope.users = users;
+			var scope = $rootScope.$new();
+			scope.users = [];
 
-				$modal.open({
-					templateUrl: '/tpl/projects/users/add.html',
-					scope: scope
-				}).result.then(function (user) {
-					$http.post(Project.getURL() + '/users', user)
-						.then(function () {
-							$scope.reload();
-						}).catch(function (response) {
-							SweetAlert.swal('Error', 'User not added: ' + response.status, 'error');
+			// the user list is paged for non admins, so candidates are searched by name
+			scope.search = function (query) {
+				$http.get('/users', { params: { q: query, limit: 20 } }).then(function (response) {
+					scope.users = response.data.filter(function (candidate) {
+						return !$scope.users.some(function (u) {
+							return u.id == candidate.id;
 						});
-				}, function () {});
-			});
+					});
+				});
+			}
+			scope.search('');
+
+			$modal.open({
+				templateUrl: '/tpl/projects/users/add.html',
+				scope: scope
+			}).result.then(function (user) {
+				$http.post(Project.getURL() + '/users', user)
+					.then(function () {
+						$scope.reload();
+					}).catch(function (response) {
+						SweetAlert.swal('Error', 'User not added: ' + response.status, 'error');
+					});
+			}, function () {});
 		}
 
 		$scope.setAdmin = function (user) {
@@ -4,6 +4,10 @@ app.factory('ProjectFactory', ['$http', function ($http) {
 		this.name = project.name;
 		this.alert = project.alert;
 		this.alert_chat = project.alert_chat;
+		this.default_inventory_id = project.default_inventory_id;
+		this.default_repository_id = project.default_repository_id;
+		this.default_environment_id = project.default_environment_id;
+		this.keep_tasks = project.keep_tasks;
 	}
 
 	Project.prototype.getURL = function () {